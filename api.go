@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/Kentaro1043/adsb-exporter/internal/collector"
+)
+
+// aircraftView is an Aircraft plus the fields the exporter derives from it.
+type aircraftView struct {
+	collector.Aircraft
+	// Distance from the receiver in km, when both positions are known.
+	Distance *float64 `json:"distance,omitempty"`
+	OnGround bool     `json:"on_ground"`
+	Source   string   `json:"source"`
+}
+
+// api serves the collector's parsed view of the source files as JSON.
+type api struct {
+	c *collector.Collector
+	// receiver is the station's position, if known
+	receiver *collector.Position
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("write api response failed: %v", err)
+	}
+}
+
+func (a *api) handleAircraft(w http.ResponseWriter, r *http.Request) {
+	file, meta := a.c.ParsedAircraft()
+	if file == nil {
+		http.Error(w, "aircraft not loaded yet", http.StatusServiceUnavailable)
+		return
+	}
+	// the aircraft the metrics see: category filtered, with the hex,
+	// flight and category as they appear in the labels
+	views := make([]aircraftView, 0, len(file.Aircraft))
+	for i := range file.Aircraft {
+		ac := &file.Aircraft[i]
+		category := collector.NormalizeCategory(ac.Category)
+		if !a.c.CategoryAllowed(category) {
+			continue
+		}
+		v := aircraftView{Aircraft: *ac, OnGround: collector.OnGround(ac), Source: collector.PositionSource(ac)}
+		v.Hex = collector.SanitizeLabelValue(collector.NormalizeHex(ac.Hex))
+		v.Flight = collector.SanitizeLabelValue(collector.NormalizeFlight(ac.Flight))
+		v.Category = category
+		if a.receiver != nil {
+			if d, ok := a.receiver.Distance(ac); ok {
+				v.Distance = &d
+			}
+		}
+		views = append(views, v)
+	}
+	writeJSON(w, struct {
+		Meta     collector.SourceMeta `json:"meta"`
+		Now      float64              `json:"now"`
+		Messages int                  `json:"messages"`
+		Aircraft []aircraftView       `json:"aircraft"`
+	}{meta, file.Now, file.Messages, views})
+}
+
+func (a *api) handleStats(w http.ResponseWriter, r *http.Request) {
+	stats, meta := a.c.ParsedStats()
+	if stats == nil {
+		http.Error(w, "stats not loaded yet", http.StatusServiceUnavailable)
+		return
+	}
+	writeJSON(w, struct {
+		Meta  collector.SourceMeta `json:"meta"`
+		Stats *collector.Stats     `json:"stats"`
+	}{meta, stats})
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Kentaro1043/adsb-exporter/internal/collector"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestAPIAircraft(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aircraft.json")
+	data := `{"now": 1700000010, "aircraft": [
+		{"hex": "ABC123", "flight": "BAW1  ", "category": " a3", "lat": 51.6, "lon": -0.1},
+		{"hex": "~def456", "category": "C1"},
+		{"hex": "aaaaaa"}
+	]}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	receiver := &collector.Position{Lat: 51.5, Lon: -0.1}
+	c := collector.New(prometheus.NewRegistry(), collector.Options{
+		Receiver:          receiver,
+		ExcludeCategories: []string{"C*"},
+	})
+	if err := c.UpdateAircraftsFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+	a := &api{c: c, receiver: receiver}
+	rec := httptest.NewRecorder()
+	a.handleAircraft(rec, httptest.NewRequest(http.MethodGet, "/api/v1/aircraft", nil))
+
+	var got struct {
+		Aircraft []struct {
+			Hex      string   `json:"hex"`
+			Flight   string   `json:"flight"`
+			Category string   `json:"category"`
+			Distance *float64 `json:"distance"`
+		} `json:"aircraft"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	// the C1 target is filtered out, as it is from the metrics
+	if len(got.Aircraft) != 2 {
+		t.Fatalf("got %d aircraft, want 2: %+v", len(got.Aircraft), got.Aircraft)
+	}
+	first := got.Aircraft[0]
+	if first.Hex != "abc123" || first.Flight != "BAW1" || first.Category != "A3" {
+		t.Errorf("first aircraft %+v, want it normalized", first)
+	}
+	if first.Distance == nil || *first.Distance < 11 || *first.Distance > 11.2 {
+		t.Errorf("distance %v, want about 11.1 km", first.Distance)
+	}
+	if d := got.Aircraft[1].Distance; d != nil {
+		t.Errorf("aircraft without a position has distance %v", *d)
+	}
+}
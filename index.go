@@ -0,0 +1,59 @@
+package main
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+)
+
+// indexPage is the landing page served at /: links to the endpoints and the
+// settings the exporter runs with, for checking a new setup.
+type indexPage struct {
+	ListenAddr    string
+	StatsPath     string
+	AircraftsPath string
+	Interval      time.Duration
+	// HealthAddr is where /healthz and /readyz are served when not on
+	// ListenAddr.
+	HealthAddr string
+}
+
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head><title>ADS-B Exporter</title></head>
+<body>
+<h1>ADS-B Exporter</h1>
+<ul>
+<li><a href="/metrics">/metrics</a></li>
+{{- if .HealthAddr}}
+<li>/healthz and /readyz on {{.HealthAddr}}</li>
+{{- else}}
+<li><a href="/healthz">/healthz</a></li>
+<li><a href="/readyz">/readyz</a></li>
+{{- end}}
+<li><a href="/api/v1/aircraft">/api/v1/aircraft</a></li>
+<li><a href="/api/v1/stats">/api/v1/stats</a></li>
+</ul>
+<h2>Configuration</h2>
+<table>
+<tr><td>Listen address</td><td>{{.ListenAddr}}</td></tr>
+<tr><td>stats.json</td><td>{{.StatsPath}}</td></tr>
+<tr><td>aircraft.json</td><td>{{.AircraftsPath}}</td></tr>
+<tr><td>Interval</td><td>{{.Interval}}</td></tr>
+</table>
+</body>
+</html>
+`))
+
+func (p *indexPage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// "/" matches every path nothing else does
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := indexTemplate.Execute(w, p); err != nil {
+		log.Printf("write index page failed: %v", err)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIndexPage(t *testing.T) {
+	p := &indexPage{
+		ListenAddr:    ":9187",
+		StatsPath:     "/run/readsb/stats.json",
+		AircraftsPath: "/run/readsb/aircraft.json",
+		Interval:      5 * time.Second,
+	}
+
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", rec.Code)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{`href="/metrics"`, `href="/healthz"`, "/run/readsb/aircraft.json", ":9187", "5s"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("index page lacks %q", want)
+		}
+	}
+
+	p.HealthAddr = ":9188"
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if body := rec.Body.String(); strings.Contains(body, `href="/healthz"`) || !strings.Contains(body, ":9188") {
+		t.Errorf("index page with a separate health listener:\n%s", body)
+	}
+
+	rec = httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest("GET", "/nope", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("status for /nope = %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,165 @@
+// Package aircraftdb looks up registration, type and operator by ICAO address
+// in a local aircraft database: a BaseStation.sqb style SQLite file or a CSV
+// export with a header row.
+package aircraftdb
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/Kentaro1043/adsb-exporter/internal/collector"
+	_ "modernc.org/sqlite"
+)
+
+// sqliteMagic starts every SQLite database file.
+var sqliteMagic = []byte("SQLite format 3\x00")
+
+// CSV header names accepted for each column, compared case-insensitively.
+var (
+	hexColumns          = []string{"hex", "icao24", "icao", "modes"}
+	registrationColumns = []string{"registration", "reg"}
+	typeColumns         = []string{"type", "typecode", "icaotypecode", "icao_type"}
+	operatorColumns     = []string{"operator", "owner", "registeredowners"}
+)
+
+// DB holds the entries of a database loaded with Load. Until then, and if
+// loading fails, every lookup misses, so a slow or missing file never holds
+// up the exporter.
+type DB struct {
+	entries atomic.Pointer[map[string]collector.AircraftInfo]
+}
+
+// Lookup returns what the database knows about hex.
+func (db *DB) Lookup(hex string) (collector.AircraftInfo, bool) {
+	m := db.entries.Load()
+	if m == nil {
+		return collector.AircraftInfo{}, false
+	}
+	info, ok := (*m)[collector.NormalizeHex(hex)]
+	return info, ok
+}
+
+// Load reads the database at path, SQLite or CSV by its content, replaces
+// the entries and returns how many there are.
+func (db *DB) Load(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	magic := make([]byte, len(sqliteMagic))
+	n, err := io.ReadFull(f, magic)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return 0, err
+	}
+	var m map[string]collector.AircraftInfo
+	if bytes.Equal(magic[:n], sqliteMagic) {
+		m, err = loadSQLite(path)
+	} else {
+		m, err = loadCSV(io.MultiReader(bytes.NewReader(magic[:n]), f))
+	}
+	if err != nil {
+		return 0, err
+	}
+	db.entries.Store(&m)
+	return len(m), nil
+}
+
+// loadSQLite reads the Aircraft table of a BaseStation database.
+func loadSQLite(path string) (map[string]collector.AircraftInfo, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?mode=ro")
+	if err != nil {
+		return nil, fmt.Errorf("open aircraft db: %w", err)
+	}
+	defer db.Close()
+	rows, err := db.Query(`SELECT ModeS, COALESCE(Registration, ''), COALESCE(ICAOTypeCode, ''),
+		COALESCE(RegisteredOwners, '') FROM Aircraft`)
+	if err != nil {
+		return nil, fmt.Errorf("query aircraft db: %w", err)
+	}
+	defer rows.Close()
+	m := map[string]collector.AircraftInfo{}
+	for rows.Next() {
+		var hex sql.NullString
+		var info collector.AircraftInfo
+		if err := rows.Scan(&hex, &info.Registration, &info.Type, &info.Operator); err != nil {
+			return nil, fmt.Errorf("read aircraft db: %w", err)
+		}
+		add(m, hex.String, info)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("read aircraft db: %w", err)
+	}
+	return m, nil
+}
+
+// loadCSV reads a CSV file whose header names the columns; only the hex one
+// is required.
+func loadCSV(r io.Reader) (map[string]collector.AircraftInfo, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read aircraft csv header: %w", err)
+	}
+	col := func(names []string) int {
+		for i, h := range header {
+			for _, name := range names {
+				if strings.EqualFold(strings.TrimSpace(h), name) {
+					return i
+				}
+			}
+		}
+		return -1
+	}
+	hexCol := col(hexColumns)
+	if hexCol < 0 {
+		return nil, fmt.Errorf("aircraft csv: no hex column (one of %s)", strings.Join(hexColumns, ", "))
+	}
+	regCol, typeCol, opCol := col(registrationColumns), col(typeColumns), col(operatorColumns)
+	m := map[string]collector.AircraftInfo{}
+	for {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return m, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read aircraft csv: %w", err)
+		}
+		field := func(i int) string {
+			if i < 0 || i >= len(rec) {
+				return ""
+			}
+			return rec[i]
+		}
+		add(m, field(hexCol), collector.AircraftInfo{
+			Registration: field(regCol),
+			Type:         field(typeCol),
+			Operator:     field(opCol),
+		})
+	}
+}
+
+// add records info for hex, unless it has nothing worth looking up. Fields
+// become label values, so invalid UTF-8 is replaced.
+func add(m map[string]collector.AircraftInfo, hex string, info collector.AircraftInfo) {
+	clean := func(s string) string {
+		return strings.ToValidUTF8(strings.TrimSpace(s), "\uFFFD")
+	}
+	info.Registration = clean(info.Registration)
+	info.Type = clean(info.Type)
+	info.Operator = clean(info.Operator)
+	hex = collector.NormalizeHex(hex)
+	if hex == "" || info == (collector.AircraftInfo{}) {
+		return
+	}
+	m[hex] = info
+}
@@ -0,0 +1,93 @@
+package aircraftdb
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Kentaro1043/adsb-exporter/internal/collector"
+)
+
+func TestLoadCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aircraft.csv")
+	data := "icao24,Registration,typecode,operator,built\n" +
+		"ABC123,N123AB,B738,Southwest Airlines,2010\n" +
+		"def456, G-ABCD ,A320\n" +
+		"fedcba,,,\n" +
+		",N1,C172,\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var db DB
+	n, err := db.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("loaded %d entries, want 2", n)
+	}
+	for _, tt := range []struct {
+		hex  string
+		want collector.AircraftInfo
+		ok   bool
+	}{
+		{"abc123", collector.AircraftInfo{Registration: "N123AB", Type: "B738", Operator: "Southwest Airlines"}, true},
+		{"DEF456", collector.AircraftInfo{Registration: "G-ABCD", Type: "A320"}, true},
+		{"fedcba", collector.AircraftInfo{}, false},
+		{"000000", collector.AircraftInfo{}, false},
+	} {
+		got, ok := db.Lookup(tt.hex)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Lookup(%q) = %+v, %v; want %+v, %v", tt.hex, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestLoadCSVWithoutHexColumn(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aircraft.csv")
+	if err := os.WriteFile(path, []byte("registration,type\nN1,C172\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var db DB
+	if _, err := db.Load(path); err == nil {
+		t.Fatal("Load succeeded without a hex column, want error")
+	}
+}
+
+func TestLoadSQLite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "BaseStation.sqb")
+	sdb, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = sdb.Exec(`CREATE TABLE Aircraft (AircraftID INTEGER PRIMARY KEY, ModeS VARCHAR(6) NOT NULL,
+		Registration VARCHAR(20), ICAOTypeCode VARCHAR(10), RegisteredOwners VARCHAR(100));
+		INSERT INTO Aircraft (ModeS, Registration, ICAOTypeCode, RegisteredOwners) VALUES
+			('4CA123', 'EI-ABC', 'B738', 'Ryanair'),
+			('3C6DD4', 'D-AIBC', NULL, NULL)`)
+	sdb.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var db DB
+	if n, err := db.Load(path); err != nil || n != 2 {
+		t.Fatalf("Load = %d, %v; want 2, nil", n, err)
+	}
+	if got, _ := db.Lookup("4ca123"); got != (collector.AircraftInfo{Registration: "EI-ABC", Type: "B738", Operator: "Ryanair"}) {
+		t.Errorf("Lookup(4ca123) = %+v", got)
+	}
+	if got, _ := db.Lookup("3c6dd4"); got != (collector.AircraftInfo{Registration: "D-AIBC"}) {
+		t.Errorf("Lookup(3c6dd4) = %+v", got)
+	}
+}
+
+func TestLoadMissing(t *testing.T) {
+	var db DB
+	if _, err := db.Load(filepath.Join(t.TempDir(), "missing.sqb")); err == nil {
+		t.Fatal("Load succeeded on a missing file, want error")
+	}
+	if _, ok := db.Lookup("abc123"); ok {
+		t.Error("Lookup hit without a loaded database")
+	}
+}
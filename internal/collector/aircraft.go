@@ -0,0 +1,930 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const (
+	knotsToKmh   = 1.852
+	feetToMeters = 0.3048
+	// the RSSI readsb reports for an aircraft not heard recently
+	noSignalRSSI = -49.5
+	// ISA sea level pressure
+	standardQNH = 1013.25
+)
+
+// adsbVersions labels adsb_aircraft_count_by_adsb_version: DO-260, DO-260A
+// and DO-260B, then aircraft reporting no or another version.
+var adsbVersions = [...]string{"0", "1", "2", "unknown"}
+
+// aircraftKey identifies the label set shared by the per-aircraft metrics.
+type aircraftKey struct {
+	hex, flight, category string
+}
+
+// UpdateAircraftsFromFile parses the aircraft.json at path and replaces the
+// per-aircraft metrics with the ones it describes, in a single swap, so
+// aircraft no longer present simply drop out. Entries without a hex address
+// are skipped and counted. With Options.MaxAircraft set, aircraft beyond the
+// limit are left out the same way.
+//
+// The file is parsed once, from a read buffer reused across calls, and each
+// entry applied as it is decoded; the entries are still kept for
+// ParsedAircraft. A file that fails to decode changes no gauges, and neither
+// does one without any aircraft within Options.EmptyAircraftGrace, though
+// discarded values and entries without a hex before a syntax error have
+// been counted.
+func (c *Collector) UpdateAircraftsFromFile(path string) error {
+	return c.UpdateAircraftsFromFiles(path)
+}
+
+// UpdateAircraftsFromFiles is UpdateAircraftsFromFile for aircraft split
+// across several files, such as those of dump1090 and dump978: their
+// aircraft are merged by hex (see mergeAircraftFiles) and the union applied
+// in one pass. If any file fails to decode no gauges change.
+func (c *Collector) UpdateAircraftsFromFiles(paths ...string) error {
+	return c.UpdateAircraftsFromFilesContext(context.Background(), paths...)
+}
+
+// UpdateAircraftsFromFilesContext is UpdateAircraftsFromFiles, except that
+// nothing is applied once ctx is done.
+func (c *Collector) UpdateAircraftsFromFilesContext(ctx context.Context, paths ...string) error {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+	var b []byte
+	var merged *AircraftsFile
+	var err error
+	if len(paths) == 1 {
+		if b, err = c.readAircraftFile(paths[0]); err != nil {
+			return err
+		}
+	} else if merged, err = c.mergeAircraftFiles(paths); err != nil {
+		return err
+	}
+
+	if err := c.lockApply(ctx); err != nil {
+		return err
+	}
+	defer c.applyMu.Unlock()
+	m := c.aircraft
+	u := &c.update
+	// sized for the previous pass to avoid regrowing the retained slice
+	a := AircraftsFile{Aircraft: make([]Aircraft, 0, len(u.prev))}
+	u.reset()
+	if len(u.altBands) == 0 {
+		u.altBands = make([]int, len(c.altBands.labels)+2)
+	}
+	if len(u.distBands) == 0 && c.opts.Receiver != nil {
+		u.distBands = make([]int, len(c.distBands.labels)+1)
+		u.ranges = make([]float64, len(c.rangeSectors))
+	}
+	apply := func(ac *Aircraft) { c.applyAircraft(ac, u, true) }
+	if c.opts.MaxAircraft > 0 {
+		// ranking needs the whole list; applied once it is decoded
+		apply = func(*Aircraft) {}
+	}
+	if merged != nil {
+		a = *merged
+		for i := range a.Aircraft {
+			apply(&a.Aircraft[i])
+		}
+	} else if err := decodeAircraftsFile(b, &a, apply); err != nil {
+		return fmt.Errorf("unmarshal aircrafts: %w", err)
+	}
+	// nothing served has changed yet, so returning keeps the last pass
+	if len(a.Aircraft) == 0 && len(u.prev) > 0 && c.emptyAircraft < c.opts.EmptyAircraftGrace {
+		c.emptyAircraft++
+		log.Printf("no aircraft in %s, keeping the previous ones (%d of %d)", strings.Join(paths, ","), c.emptyAircraft, c.opts.EmptyAircraftGrace)
+		return nil
+	}
+	c.emptyAircraft = 0
+	var dropped int
+	if c.opts.MaxAircraft > 0 {
+		dropped = c.applyLimited(a.Aircraft, u)
+	}
+	c.appendMessageRates(u, a.Now)
+	c.appendSessionDurations(u, a.Now)
+	c.countAircraftChurn(a.Aircraft, u)
+	c.keepAbsentAircraft(u)
+	c.storeParsedAircraft(strings.Join(paths, ","), &a)
+	c.addFileMessages(a.Messages)
+
+	ms := make([]prometheus.Metric, 0, u.n+2*len(u.categories)+len(u.modeCounts)+len(u.geohashes)+len(u.altBands)+len(u.distBands)+len(u.ranges)+len(u.versions)+len(u.dbInfo)+len(u.operators)+len(u.countries)+16)
+	ms = append(ms,
+		prometheus.MustNewConstMetric(m.unfilteredCount, prometheus.GaugeValue, float64(u.unfiltered)),
+		prometheus.MustNewConstMetric(m.fileEntries, prometheus.GaugeValue, float64(len(a.Aircraft))))
+	// 0 when the file has no now, which would only look stale
+	if a.Now > 0 {
+		ms = append(ms, prometheus.MustNewConstMetric(m.fileTimestamp, prometheus.GaugeValue, a.Now))
+	}
+	if c.opts.MaxAircraft > 0 {
+		ms = append(ms, prometheus.MustNewConstMetric(m.droppedByLimit, prometheus.GaugeValue, float64(dropped)))
+	}
+	for _, gs := range u.cur {
+		for i := range gs {
+			ms = append(ms, &gs[i])
+		}
+	}
+	for cat, n := range u.categories {
+		ms = append(ms,
+			prometheus.MustNewConstMetric(m.categoryCount, prometheus.GaugeValue, float64(n), cat),
+			prometheus.MustNewConstMetric(m.categoryInfo, prometheus.GaugeValue, 1, cat, categoryDescription(cat)))
+	}
+	for op, n := range u.operators {
+		ms = append(ms, prometheus.MustNewConstMetric(m.operatorCount, prometheus.GaugeValue, float64(n), op))
+	}
+	for country, n := range u.countries {
+		ms = append(ms, prometheus.MustNewConstMetric(m.countryCount, prometheus.GaugeValue, float64(n), country))
+	}
+	ms = append(ms,
+		prometheus.MustNewConstMetric(m.alertCount, prometheus.GaugeValue, float64(u.alerts)),
+		prometheus.MustNewConstMetric(m.spiCount, prometheus.GaugeValue, float64(u.idents)),
+		prometheus.MustNewConstMetric(m.flights, prometheus.GaugeValue, float64(len(u.flights))))
+	for hex, info := range u.dbInfo {
+		ms = append(ms, prometheus.MustNewConstMetric(m.dbInfo, prometheus.GaugeValue, 1, hex, info.Registration, info.Type, info.Operator))
+	}
+	for mode, n := range u.modeCounts {
+		ms = append(ms, prometheus.MustNewConstMetric(m.navModeCount, prometheus.GaugeValue, float64(n), mode))
+	}
+	for cell, n := range u.geohashes {
+		ms = append(ms, prometheus.MustNewConstMetric(m.geohashCount, prometheus.GaugeValue, float64(n), cell))
+	}
+	// every band is exported, empty ones as 0, so panels don't gap
+	for i, n := range u.altBands {
+		band := "ground"
+		switch {
+		case i < len(c.altBands.labels):
+			band = c.altBands.labels[i]
+		case i > len(c.altBands.labels):
+			band = "unknown"
+		}
+		ms = append(ms, prometheus.MustNewConstMetric(m.altitudeBandCount, prometheus.GaugeValue, float64(n), band))
+	}
+	for i, n := range u.versions {
+		ms = append(ms, prometheus.MustNewConstMetric(m.versionCount, prometheus.GaugeValue, float64(n), adsbVersions[i]))
+	}
+	for i, n := range u.distBands {
+		band := "unknown"
+		if i < len(c.distBands.labels) {
+			band = c.distBands.labels[i]
+		}
+		ms = append(ms, prometheus.MustNewConstMetric(m.distanceBandCount, prometheus.GaugeValue, float64(n), band))
+	}
+	ranges := u.ranges
+	if c.maxRanges != nil {
+		for i, d := range ranges {
+			c.maxRanges[i] = max(c.maxRanges[i], d)
+		}
+		ranges = c.maxRanges
+	}
+	for i, d := range ranges {
+		ms = append(ms, prometheus.MustNewConstMetric(m.rangeByBearing, prometheus.GaugeValue, d, c.rangeSectors[i]))
+	}
+	if cl := u.closest; cl.hex != "" {
+		ms = append(ms, prometheus.MustNewConstMetric(m.closestDistance, prometheus.GaugeValue, cl.dist))
+		if cl.hasAlt {
+			ms = append(ms, prometheus.MustNewConstMetric(m.closestAltBaro, prometheus.GaugeValue, cl.alt))
+		}
+		if cl.hasGS {
+			ms = append(ms, prometheus.MustNewConstMetric(m.closestGS, prometheus.GaugeValue, cl.gs))
+		}
+		if c.opts.ClosestAircraftHex {
+			ms = append(ms, prometheus.MustNewConstMetric(m.closestInfo, prometheus.GaugeValue, 1, cl.hex))
+		}
+	}
+	ms = c.appendRSSISummary(ms, u.rssi, u.strongest)
+	if c.opts.OverheadRadius > 0 && c.opts.Receiver != nil {
+		for hex := range u.overhead {
+			if _, ok := c.overhead[hex]; !ok {
+				c.overheadEvents++
+			}
+		}
+		// the old set is cleared for reuse by the next reset
+		c.overhead, u.overhead = u.overhead, c.overhead
+		ms = append(ms,
+			prometheus.MustNewConstMetric(m.overhead, prometheus.GaugeValue, float64(len(c.overhead))),
+			prometheus.MustNewConstMetric(m.overheadEvents, prometheus.CounterValue, float64(c.overheadEvents)))
+	}
+	m.current.Store(&ms)
+	u.prev, u.cur = u.cur, u.prev
+	c.prevMessages, u.messages = u.messages, c.prevMessages
+	c.prevHexes, u.hexes = u.hexes, c.prevHexes
+	for hex := range u.acasRA {
+		if _, ok := c.acasRA[hex]; !ok {
+			m.acasRAEvents.Inc()
+		}
+	}
+	c.acasRA, u.acasRA = u.acasRA, c.acasRA
+	return nil
+}
+
+// aircraftUpdate collects what one UpdateAircraftsFromFile pass has seen. A
+// single one is kept on the Collector and reset between passes, so its maps
+// keep their capacity.
+type aircraftUpdate struct {
+	// metrics of each aircraft by label set; an entry repeating an earlier
+	// one's labels replaces it, as it would overwrite a gauge
+	cur map[aircraftKey][]aircraftGauge
+	// cur of the last successful pass, for samples kept over a discarded
+	// value
+	prev map[aircraftKey][]aircraftGauge
+	// metrics in cur
+	n int
+	// aircraft with a hex, before filtering
+	unfiltered int
+	// aircraft with the alert and spi flags set
+	alerts, idents int
+	// distinct non-empty callsigns
+	flights map[string]struct{}
+	// aircraft per ADS-B version 0 to 2, then unknown
+	versions [len(adsbVersions)]int
+	// aircraft per altitude band, by bands index, then ground and unknown
+	altBands []int
+	// aircraft per distance band, then unknown; nil without a receiver
+	distBands []int
+	// RSSI of every aircraft with a recent signal
+	rssi []float64
+	// the aircraft with the highest of rssi
+	strongest strongestAircraft
+	// hex of each aircraft overhead, with opts.OverheadRadius set
+	overhead map[string]struct{}
+	// hex of each aircraft reporting a resolution advisory
+	acasRA map[string]struct{}
+	// aircraft with a usable position nearest the receiver
+	closest closestAircraft
+	// longest range per bearing sector, 0 if none; nil without a receiver
+	ranges     []float64
+	categories map[string]int
+	modeCounts map[string]int
+	geohashes  map[string]int
+	// aircraft per airline designator, or other
+	operators map[string]int
+	// aircraft per state of registration, or Unassigned
+	countries map[string]int
+	// message count of each aircraft applied, also the list of them for
+	// the session durations, and the samples derived from them by hex
+	counts   map[aircraftKey]messageCount
+	messages map[string]messageSample
+	// database entry of each aircraft found in opts.AircraftDB, by hex so
+	// entries differing only in callsign share one series
+	dbInfo map[string]AircraftInfo
+	// every hex passing the category filters, before MaxAircraft
+	hexes map[string]struct{}
+	// scratch for the nav modes of the aircraft being applied
+	modes []string
+}
+
+func (u *aircraftUpdate) reset() {
+	if u.cur == nil {
+		u.cur = map[aircraftKey][]aircraftGauge{}
+		u.prev = map[aircraftKey][]aircraftGauge{}
+		u.categories = map[string]int{}
+		u.modeCounts = map[string]int{}
+		u.geohashes = map[string]int{}
+		u.operators = map[string]int{}
+		u.countries = map[string]int{}
+		u.overhead = map[string]struct{}{}
+		u.acasRA = map[string]struct{}{}
+		u.counts = map[aircraftKey]messageCount{}
+		u.messages = map[string]messageSample{}
+		u.dbInfo = map[string]AircraftInfo{}
+		u.flights = map[string]struct{}{}
+	}
+	clear(u.cur)
+	u.n = 0
+	u.unfiltered = 0
+	u.alerts, u.idents = 0, 0
+	u.versions = [len(adsbVersions)]int{}
+	clear(u.altBands)
+	clear(u.distBands)
+	clear(u.ranges)
+	u.closest = closestAircraft{}
+	clear(u.categories)
+	clear(u.modeCounts)
+	clear(u.geohashes)
+	clear(u.operators)
+	clear(u.countries)
+	clear(u.overhead)
+	clear(u.acasRA)
+	clear(u.counts)
+	clear(u.messages)
+	clear(u.dbInfo)
+	clear(u.flights)
+	if u.hexes == nil {
+		// handed to the Collector by the first pass
+		u.hexes = map[string]struct{}{}
+	}
+	clear(u.hexes)
+	u.rssi = u.rssi[:0]
+	u.strongest = strongestAircraft{}
+}
+
+// belowOverheadCeiling reports whether ac is low enough to count as
+// overhead; see Options.OverheadMaxAltitude.
+func (c *Collector) belowOverheadCeiling(ac *Aircraft) bool {
+	if c.opts.OverheadMaxAltitude <= 0 || OnGround(ac) {
+		return true
+	}
+	n, ok := BaroAltitude(ac)
+	return ok && c.inBounds("alt_baro", n) && n <= c.opts.OverheadMaxAltitude
+}
+
+// closestAircraft is the aircraft nearest the receiver so far in a pass;
+// hex is empty until one has been seen.
+type closestAircraft struct {
+	hex    string
+	dist   float64
+	alt    float64
+	hasAlt bool
+	gs     float64
+	hasGS  bool
+}
+
+// consider makes ac, at dist km, the closest aircraft if it is nearer than
+// the current one. Of aircraft at the same distance the lowest hex wins, so
+// the choice doesn't depend on file order.
+func (cl *closestAircraft) consider(c *Collector, ac *Aircraft, hex string, dist float64) {
+	if cl.hex != "" && (dist > cl.dist || dist == cl.dist && hex >= cl.hex) {
+		return
+	}
+	*cl = closestAircraft{hex: hex, dist: dist}
+	if n, ok := BaroAltitude(ac); ok && c.inBounds("alt_baro", n) {
+		cl.alt, cl.hasAlt = n, true
+	}
+	if ac.GS != nil && c.inBounds("gs", *ac.GS) {
+		cl.gs, cl.hasGS = *ac.GS, true
+	}
+}
+
+// aircraftGauge is a const gauge metric. Unlike one from
+// prometheus.NewConstMetric it shares its label pairs with the other metrics
+// of the same aircraft, which would otherwise be built again for each of
+// about 40 families on every refresh. Label values come from decoded JSON
+// and so are always valid UTF-8.
+type aircraftGauge struct {
+	desc    *prometheus.Desc
+	labels  []*dto.LabelPair
+	value   float64
+	counter bool
+}
+
+func (g *aircraftGauge) Desc() *prometheus.Desc { return g.desc }
+
+func (g *aircraftGauge) Write(out *dto.Metric) error {
+	v := g.value
+	out.Label = g.labels
+	if g.counter {
+		out.Counter = &dto.Counter{Value: &v}
+	} else {
+		out.Gauge = &dto.Gauge{Value: &v}
+	}
+	return nil
+}
+
+// aircraftSample accumulates the metrics of one aircraft.
+type aircraftSample struct {
+	labels  []*dto.LabelPair
+	metrics []aircraftGauge
+	// the aircraft's metrics from the previous pass
+	prev []aircraftGauge
+}
+
+func (s *aircraftSample) set(d *prometheus.Desc, v float64) {
+	s.metrics = append(s.metrics, aircraftGauge{desc: d, labels: s.labels, value: v})
+}
+
+// keep carries the previous pass's samples of ds over, for a value that was
+// present but discarded.
+func (s *aircraftSample) keep(ds ...*prometheus.Desc) {
+	for _, g := range s.prev {
+		if slices.Contains(ds, g.desc) {
+			s.metrics = append(s.metrics, g)
+		}
+	}
+}
+
+// setValid sets d to *v if v is present and passes the sanity check for
+// field. A discarded value keeps the previous sample.
+func (c *Collector) setValid(s *aircraftSample, field string, d *prometheus.Desc, v *float64) {
+	if v == nil {
+		return
+	}
+	if c.valid(field, *v) {
+		s.set(d, *v)
+	} else {
+		s.keep(d)
+	}
+}
+
+// labelHex returns ac's address as it appears in the hex label, and whether
+// it is one series can be keyed on: a bare "~" is not. The "~" of non-ICAO
+// addresses stays, as a TIS-B target can share its address with a real
+// aircraft in view.
+func labelHex(ac *Aircraft) (string, bool) {
+	hex := SanitizeLabelValue(NormalizeHex(ac.Hex))
+	return hex, strings.TrimPrefix(hex, "~") != ""
+}
+
+// applyAircraft builds the per-aircraft metrics for ac and records them in u.
+// Without series, for an aircraft MaxAircraft leaves out, it is only counted
+// in the figures over the whole fleet.
+func (c *Collector) applyAircraft(ac *Aircraft, u *aircraftUpdate, series bool) {
+	m := c.aircraft
+	hex, ok := labelHex(ac)
+	nonICAO := IsNonICAO(hex)
+	if !ok {
+		// nothing to key the series on
+		m.noHex.Inc()
+		return
+	}
+	u.unfiltered++
+	category := NormalizeCategory(ac.Category)
+	if !c.CategoryAllowed(category) {
+		return
+	}
+	flight := SanitizeLabelValue(NormalizeFlight(ac.Flight))
+	if flight != "" {
+		u.flights[flight] = struct{}{}
+	}
+	if op, ok := airlineDesignator(flight); ok {
+		u.operators[op]++
+	} else {
+		u.operators["other"]++
+	}
+
+	key := aircraftKey{hex: hex, flight: flight, category: category}
+	prev := u.prev[key]
+	s := &aircraftSample{
+		labels:  prometheus.MakeLabelPairs(m.messages, []string{hex, flight, category}),
+		metrics: make([]aircraftGauge, 0, max(len(prev), 16)),
+		prev:    prev,
+	}
+
+	if category == "" {
+		u.categories["unknown"]++
+	} else {
+		u.categories[category]++
+	}
+	u.countries[Country(hex)]++
+
+	// Altitude metrics; "ground" is not numeric and emits nothing, while
+	// any other non-numeric value is treated as discarded
+	feet := c.opts.AltUnit != AltUnitMeters
+	meters := c.opts.AltUnit == AltUnitMeters || c.opts.AltUnit == AltUnitBoth
+	ground, unknown := len(c.altBands.labels), len(c.altBands.labels)+1
+	if n, ok, onGround := parseAltitude(ac.AltBaro); ok && c.valid("alt_baro", n) {
+		if feet {
+			s.set(m.altBaro, n)
+		}
+		if meters {
+			s.set(m.altBaroMeters, n*feetToMeters)
+		}
+		u.altBands[c.altBands.index(n)]++
+	} else if onGround {
+		u.altBands[ground]++
+	} else {
+		if ac.AltBaro != nil {
+			s.keep(m.altBaro, m.altBaroMeters)
+		}
+		u.altBands[unknown]++
+	}
+	if n, ok, onGround := parseAltitude(ac.AltGeom); ok && c.valid("alt_geom", n) {
+		if feet {
+			s.set(m.altGeom, n)
+		}
+		if meters {
+			s.set(m.altGeomMeters, n*feetToMeters)
+		}
+	} else if ac.AltGeom != nil && !onGround {
+		s.keep(m.altGeom, m.altGeomMeters)
+	}
+
+	// Speed metrics
+	kmh := c.opts.SpeedUnit == SpeedUnitKmh
+	for _, sp := range []struct {
+		field    string
+		v        *float64
+		kts, kmh *prometheus.Desc
+	}{
+		{"gs", ac.GS, m.gs, m.gsKmh},
+		{"ias", ac.IAS, m.ias, m.iasKmh},
+		{"tas", ac.TAS, m.tas, m.tasKmh},
+	} {
+		switch {
+		case sp.v == nil:
+		case c.valid(sp.field, *sp.v):
+			s.set(sp.kts, *sp.v)
+			if kmh {
+				s.set(sp.kmh, *sp.v*knotsToKmh)
+			}
+		default:
+			s.keep(sp.kts, sp.kmh)
+		}
+	}
+	c.setValid(s, "mach", m.mach, ac.Mach)
+
+	// Track and heading metrics. Angles also get sin/cos components,
+	// which unlike degrees can be averaged across north.
+	for _, an := range []struct {
+		field         string
+		v             *float64
+		deg, sin, cos *prometheus.Desc
+	}{
+		{"track", ac.Track, m.track, m.trackSin, m.trackCos},
+		{"mag_heading", ac.MagHeading, m.magHeading, m.magHeadingSin, m.magHeadingCos},
+		{"true_heading", ac.TrueHeading, m.trueHeading, m.trueHeadingSin, m.trueHeadingCos},
+	} {
+		switch {
+		case an.v == nil:
+		case c.valid(an.field, *an.v):
+			sin, cos := math.Sincos(*an.v * math.Pi / 180)
+			s.set(an.deg, *an.v)
+			s.set(an.sin, sin)
+			s.set(an.cos, cos)
+		default:
+			s.keep(an.deg, an.sin, an.cos)
+		}
+	}
+	c.setValid(s, "track_rate", m.trackRate, ac.TrackRate)
+	c.setValid(s, "roll", m.roll, ac.Roll)
+	if v := ac.Roll; v != nil {
+		switch {
+		case !c.inBounds("roll", *v):
+			s.keep(m.turning)
+		case *v <= -c.opts.TurnDeadband:
+			s.set(m.turning, -1)
+		case *v >= c.opts.TurnDeadband:
+			s.set(m.turning, 1)
+		default:
+			s.set(m.turning, 0)
+		}
+	}
+
+	// Derived wind
+	if speed, dir, ok := c.estimateWind(ac); ok {
+		s.set(m.windSpeed, speed)
+		s.set(m.windDirection, dir)
+	}
+
+	// Meteorological data readsb decodes from EHS (BDS 4,4 and 4,5)
+	c.setValid(s, "ws", m.windSpeedReported, ac.WS)
+	c.setValid(s, "wd", m.windDirectionReported, ac.WD)
+	c.setValid(s, "oat", m.oat, ac.OAT)
+	c.setValid(s, "tat", m.tat, ac.TAT)
+
+	// Rate of climb/descent
+	c.setValid(s, "baro_rate", m.baroRate, ac.BaroRate)
+	c.setValid(s, "geom_rate", m.geomRate, ac.GeomRate)
+
+	// Position
+	c.setValid(s, "lat", m.lat, ac.Lat)
+	c.setValid(s, "lon", m.lon, ac.Lon)
+	if ac.Lat != nil && ac.Lon != nil && c.inBounds("lat", *ac.Lat) && c.inBounds("lon", *ac.Lon) {
+		u.geohashes[geohashEncode(*ac.Lat, *ac.Lon, c.opts.GeohashPrecision)]++
+	}
+	// distance from the receiver, if both positions are known
+	var dist float64
+	var hasDist bool
+	if r := c.opts.Receiver; r != nil {
+		band := len(c.distBands.labels) // unknown
+		if p, ok := c.rangePosition(ac); ok {
+			d := haversineKm(r.Lat, r.Lon, p.Lat, p.Lon)
+			dist, hasDist = d, true
+			band = c.distBands.index(d)
+			i := int(bearingDeg(r.Lat, r.Lon, p.Lat, p.Lon)) / c.opts.RangeSector
+			u.ranges[i] = max(u.ranges[i], d)
+			u.closest.consider(c, ac, hex, d)
+			if c.opts.OverheadRadius > 0 && d <= c.opts.OverheadRadius && c.belowOverheadCeiling(ac) {
+				u.overhead[hex] = struct{}{}
+			}
+		}
+		u.distBands[band]++
+	}
+
+	// Navigation metrics
+	if v := ac.NavQNH; v != nil {
+		if c.valid("nav_qnh", *v) {
+			s.set(m.navQNH, *v)
+			s.set(m.navQNHDeviation, *v-standardQNH)
+		} else {
+			s.keep(m.navQNH, m.navQNHDeviation)
+		}
+	}
+	c.setValid(s, "nav_heading", m.navHeading, ac.NavHeading)
+	c.setValid(s, "nav_altitude_mcp", m.navAltMCP, ac.NavAltMCP)
+	c.setValid(s, "nav_altitude_fms", m.navAltFMS, ac.NavAltFMS)
+
+	// How far off its selected altitude the aircraft is, the MCP one being
+	// what the crew last dialled in; absent unless both are present and valid
+	selField, sel := "nav_altitude_mcp", ac.NavAltMCP
+	if sel == nil {
+		selField, sel = "nav_altitude_fms", ac.NavAltFMS
+	}
+	if alt, ok, _ := parseAltitude(ac.AltBaro); ok && sel != nil && c.inBounds("alt_baro", alt) && c.inBounds(selField, *sel) {
+		s.set(m.altDeviation, alt-*sel)
+	}
+
+	// Nav modes: one series per mode the aircraft reports, whatever it is
+	u.modes = u.modes[:0]
+	if active, ok := ac.NavModes.([]interface{}); ok {
+		for _, v := range active {
+			mode, _ := v.(string)
+			if mode = SanitizeLabelValue(mode); mode != "" && !slices.Contains(u.modes, mode) {
+				u.modes = append(u.modes, mode)
+			}
+		}
+	}
+	for _, mode := range u.modes {
+		s.metrics = append(s.metrics, aircraftGauge{
+			desc:   m.navModeActive,
+			labels: prometheus.MakeLabelPairs(m.navModeActive, []string{hex, flight, category, mode}),
+			value:  1,
+		})
+		u.modeCounts[mode]++
+	}
+
+	// Quality and integrity metrics
+	if ac.NIC != nil {
+		s.set(m.nic, float64(*ac.NIC))
+	}
+	if ac.RC != nil {
+		s.set(m.rc, float64(*ac.RC))
+	}
+	if ac.NICBaro != nil {
+		s.set(m.nicBaro, float64(*ac.NICBaro))
+	}
+	if ac.NACP != nil {
+		s.set(m.nacp, float64(*ac.NACP))
+	}
+	if ac.NACV != nil {
+		s.set(m.nacv, float64(*ac.NACV))
+	}
+	if ac.SIL != nil {
+		s.set(m.sil, float64(*ac.SIL))
+	}
+	if ac.GVA != nil {
+		s.set(m.gva, float64(*ac.GVA))
+	}
+	if ac.SDA != nil {
+		s.set(m.sda, float64(*ac.SDA))
+	}
+	if ac.Version != nil {
+		s.set(m.version, float64(*ac.Version))
+	}
+	if v := ac.Version; v != nil && *v >= 0 && *v < len(adsbVersions)-1 {
+		u.versions[*v]++
+	} else {
+		u.versions[len(adsbVersions)-1]++
+	}
+
+	// Flight status flags, exported only while set
+	if ac.Alert != nil && *ac.Alert == 1 {
+		s.set(m.alert, 1)
+		u.alerts++
+	}
+	if ac.SPI != nil && *ac.SPI == 1 {
+		s.set(m.spi, 1)
+		u.idents++
+	}
+	// Database flags, from a tar1090-enriched aircraft.json
+	if v := ac.DBFlags; v != nil {
+		for _, f := range []struct {
+			bit int
+			d   *prometheus.Desc
+		}{
+			{1, m.dbMilitary},
+			{2, m.dbInteresting},
+			{4, m.dbPIA},
+			{8, m.dbLADD},
+		} {
+			if *v&f.bit != 0 {
+				s.set(f.d, 1)
+			} else {
+				s.set(f.d, 0)
+			}
+		}
+	}
+	// only the presence of an advisory is used, so subfields readsb
+	// leaves out or that don't decode as expected make no difference
+	if ac.ACASRA != nil {
+		s.set(m.acasRAActive, 1)
+		u.acasRA[hex] = struct{}{}
+	}
+
+	// Timing metrics
+	c.setValid(s, "seen_pos", m.seenPos, ac.SeenPos)
+	c.setValid(s, "seen", m.seen, ac.Seen)
+	s.set(m.messages, float64(ac.Messages))
+
+	// RSSI
+	c.setValid(s, "rssi", m.rssi, ac.RSSI)
+	if ac.RSSI != nil && *ac.RSSI != noSignalRSSI && c.inBounds("rssi", *ac.RSSI) {
+		u.rssi = append(u.rssi, *ac.RSSI)
+		u.strongest.consider(hex, *ac.RSSI, dist, hasDist)
+	}
+
+	if nonICAO {
+		s.set(m.nonICAO, 1)
+	} else if lookup := c.opts.AircraftDB; lookup != nil && series {
+		if info, ok := lookup(hex); ok {
+			info.Registration = SanitizeLabelValue(info.Registration)
+			info.Type = SanitizeLabelValue(info.Type)
+			info.Operator = SanitizeLabelValue(info.Operator)
+			u.dbInfo[hex] = info
+		}
+	}
+
+	// Info metric for string fields
+	s.metrics = append(s.metrics, aircraftGauge{
+		desc:   m.info,
+		labels: prometheus.MakeLabelPairs(m.info, []string{hex, flight, category, SanitizeLabelValue(ac.Squawk), SanitizeLabelValue(ac.Emergency), "", SanitizeLabelValue(ac.SILType)}),
+		value:  1,
+	})
+
+	if !series {
+		return
+	}
+	u.counts[key] = messageCount{messages: ac.Messages, labels: s.labels}
+	u.n += len(s.metrics) - len(u.cur[key])
+	u.cur[key] = s.metrics
+}
+
+// addFileMessages advances the file-level message counter to n. The receiver
+// restarting shows up as n going backwards; the new process counted n
+// messages since then, so those are added and the counter stays monotonic.
+func (c *Collector) addFileMessages(n int) {
+	delta := n - c.prevFileMessages
+	if delta < 0 {
+		delta = n
+	}
+	c.aircraft.fileMessages.Add(float64(delta))
+	c.prevFileMessages = n
+}
+
+// countAircraftChurn records the hexes of l in u, adds those not in the
+// previous pass to adsb_receiver_aircraft_new_total and those of the
+// previous pass no longer in l to adsb_receiver_aircraft_lost_total.
+// Presence is taken before MaxAircraft, so an aircraft the limit leaves out
+// is neither lost nor new. The first pass has nothing to compare with and
+// only records, so a restart doesn't count the whole sky as new.
+func (c *Collector) countAircraftChurn(l []Aircraft, u *aircraftUpdate) {
+	for i := range l {
+		if hex, ok := labelHex(&l[i]); ok && c.CategoryAllowed(NormalizeCategory(l[i].Category)) {
+			u.hexes[hex] = struct{}{}
+		}
+	}
+	if c.prevHexes == nil {
+		return
+	}
+	var kept int
+	for hex := range u.hexes {
+		if _, ok := c.prevHexes[hex]; ok {
+			kept++
+		}
+	}
+	c.aircraft.newAircraft.Add(float64(len(u.hexes) - kept))
+	c.aircraft.lostAircraft.Add(float64(len(c.prevHexes) - kept))
+}
+
+// keepAbsentAircraft carries the series of aircraft missing from this pass
+// over from the last one, frozen, until they have been missing for more
+// than opts.DeleteGrace passes in a row, so one missed file doesn't leave a
+// gap. Only an aircraft whose hex is gone altogether is kept: a changed
+// callsign or category replaces its series at once, and so does MaxAircraft
+// leaving it out. The message sample and advisory state of a kept aircraft
+// are kept with it.
+// Must run after appendMessageRates and after countAircraftChurn has filled
+// u.hexes.
+func (c *Collector) keepAbsentAircraft(u *aircraftUpdate) {
+	if c.opts.DeleteGrace <= 0 {
+		return
+	}
+	for key, gs := range u.prev {
+		if _, ok := u.cur[key]; ok {
+			delete(c.absentAircraft, key)
+			continue
+		}
+		if _, ok := u.hexes[key.hex]; ok || c.absentAircraft[key] >= c.opts.DeleteGrace {
+			delete(c.absentAircraft, key)
+			continue
+		}
+		c.absentAircraft[key]++
+		u.cur[key] = gs
+		u.n += len(gs)
+		// so the messages counter carries on if the aircraft comes back,
+		// and an advisory it still has then is not counted again
+		if ms, ok := c.prevMessages[key.hex]; ok {
+			u.messages[key.hex] = ms
+		}
+		if _, ok := c.acasRA[key.hex]; ok {
+			u.acasRA[key.hex] = struct{}{}
+		}
+	}
+}
+
+// ClearAircraft removes every per-aircraft and per-category series, so the
+// families go absent until the next successful UpdateAircraftsFromFile.
+func (c *Collector) ClearAircraft() {
+	c.applyMu.Lock()
+	defer c.applyMu.Unlock()
+	c.aircraft.current.Store(nil)
+	clear(c.update.prev)
+	clear(c.absentAircraft)
+}
+
+// NormalizeFlight trims the padding readsb leaves on callsigns and uppercases
+// them, so "SWA123  " and "swa123" label the same series.
+func NormalizeFlight(s string) string {
+	return strings.ToUpper(strings.TrimSpace(s))
+}
+
+// airlineDesignator returns the ICAO airline designator of a normalized
+// callsign: its first three characters, if they are letters and followed by
+// a digit, as in UAL123 or BAW9KL. Registrations (N123AB, GABCD) and
+// numeric-only callsigns have none.
+func airlineDesignator(flight string) (string, bool) {
+	if len(flight) < 4 || flight[3] < '0' || flight[3] > '9' {
+		return "", false
+	}
+	for i := range 3 {
+		if flight[i] < 'A' || flight[i] > 'Z' {
+			return "", false
+		}
+	}
+	return flight[:3], true
+}
+
+// NormalizeCategory trims and uppercases an emitter category and makes it
+// safe as a label value, so " a3" is filtered and labelled as A3 wherever
+// categories are looked at.
+func NormalizeCategory(s string) string {
+	return SanitizeLabelValue(strings.ToUpper(strings.TrimSpace(s)))
+}
+
+// NormalizeHex lowercases an ICAO address so receivers that disagree on case
+// label the same series. The "~" readsb puts in front of non-ICAO addresses
+// is kept; see IsNonICAO.
+func NormalizeHex(s string) string {
+	return strings.ToLower(strings.TrimSpace(s))
+}
+
+// MaxLabelValueLength is the most bytes SanitizeLabelValue keeps.
+const MaxLabelValueLength = 64
+
+// SanitizeLabelValue makes a string from aircraft.json, the aircraft
+// database or configuration safe to use as a label value: invalid UTF-8 is
+// dropped, since it would fail the whole gather, and anything longer than
+// MaxLabelValueLength bytes is cut at a rune boundary so a malformed file
+// can't mint absurd series.
+func SanitizeLabelValue(s string) string {
+	s = strings.ToValidUTF8(s, "")
+	if len(s) <= MaxLabelValueLength {
+		return s
+	}
+	n := MaxLabelValueLength
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// IsNonICAO reports whether hex is a non-ICAO address (TIS-B or otherwise
+// synthetic, "~" prefixed). Such addresses aren't allocated from the ICAO
+// blocks, so country or registry lookups must not be applied to them.
+func IsNonICAO(hex string) bool {
+	return strings.HasPrefix(hex, "~")
+}
+
+// OnGround reports whether the aircraft's barometric altitude is "ground".
+func OnGround(ac *Aircraft) bool {
+	_, _, onGround := parseAltitude(ac.AltBaro)
+	return onGround
+}
+
+// PositionSource classifies an aircraft by where its data came from, based on
+// the mlat/tisb field lists readsb attaches to each entry.
+func PositionSource(ac *Aircraft) string {
+	if l, ok := ac.MLAT.([]interface{}); ok && len(l) > 0 {
+		return "mlat"
+	}
+	if l, ok := ac.TISB.([]interface{}); ok && len(l) > 0 {
+		return "tisb"
+	}
+	return "adsb"
+}
+
+// BaroAltitude returns the aircraft's barometric altitude in feet, if it
+// reported a numeric one.
+func BaroAltitude(ac *Aircraft) (float64, bool) {
+	alt, ok, _ := parseAltitude(ac.AltBaro)
+	return alt, ok
+}
@@ -0,0 +1,127 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// writeLargeAircraftFixture writes an aircraft.json with n fully populated
+// aircraft, roughly the size seen at a busy coastal site.
+func writeLargeAircraftFixture(tb testing.TB, n int) string {
+	tb.Helper()
+	f := func(v float64) *float64 { return &v }
+	i := func(v int) *int { return &v }
+	file := AircraftsFile{Now: 1700000010, Messages: 1 << 24}
+	for k := 0; k < n; k++ {
+		file.Aircraft = append(file.Aircraft, Aircraft{
+			Hex:         fmt.Sprintf("%06x", 0x400000+k),
+			Flight:      fmt.Sprintf("BAW%d", k),
+			AltBaro:     float64(1000 + k*10),
+			AltGeom:     float64(1100 + k*10),
+			GS:          f(250),
+			IAS:         f(240),
+			TAS:         f(260),
+			Mach:        f(0.4),
+			Track:       f(90),
+			TrackRate:   f(0),
+			Roll:        f(1),
+			MagHeading:  f(88),
+			TrueHeading: f(90),
+			BaroRate:    f(0),
+			GeomRate:    f(0),
+			Squawk:      "7000",
+			Emergency:   "none",
+			Category:    "A3",
+			NavQNH:      f(1013),
+			NavAltMCP:   f(10000),
+			NavAltFMS:   f(10000),
+			NavHeading:  f(90),
+			NavModes:    []interface{}{"autopilot", "lnav"},
+			Lat:         f(51.4),
+			Lon:         f(-0.4),
+			NIC:         i(8),
+			RC:          i(186),
+			SeenPos:     f(1),
+			Version:     i(2),
+			NICBaro:     i(1),
+			NACP:        i(9),
+			NACV:        i(1),
+			SIL:         i(3),
+			SILType:     "perhour",
+			GVA:         i(2),
+			SDA:         i(2),
+			Messages:    1000 + k,
+			Seen:        f(0.5),
+			RSSI:        f(-20),
+		})
+	}
+	b, err := json.Marshal(file)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	path := filepath.Join(tb.TempDir(), "aircraft.json")
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		tb.Fatal(err)
+	}
+	return path
+}
+
+// BenchmarkUpdateAircrafts measures steady-state refreshes: the same
+// aircraft every pass, so series already exist after the first.
+func BenchmarkUpdateAircrafts(b *testing.B) {
+	for _, n := range []int{500, 1000} {
+		b.Run(fmt.Sprintf("aircraft=%d", n), func(b *testing.B) {
+			path := writeLargeAircraftFixture(b, n)
+			c := New(prometheus.NewRegistry(), Options{})
+			if err := c.UpdateAircraftsFromFile(path); err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := c.UpdateAircraftsFromFile(path); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkDecodeAircrafts compares reading and decoding the whole file at
+// once with the reused buffer and per-entry decoding UpdateAircraftsFromFile
+// uses.
+func BenchmarkDecodeAircrafts(b *testing.B) {
+	path := writeLargeAircraftFixture(b, 1000)
+	b.Run("unmarshal", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			buf, err := safeReadFile(path)
+			if err != nil {
+				b.Fatal(err)
+			}
+			var a AircraftsFile
+			if err := json.Unmarshal(buf, &a); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("stream", func(b *testing.B) {
+		c := New(prometheus.NewRegistry(), Options{})
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			buf, err := c.readAircraftFile(path)
+			if err != nil {
+				b.Fatal(err)
+			}
+			a := AircraftsFile{Aircraft: make([]Aircraft, 0, 1000)}
+			if err := decodeAircraftsFile(buf, &a, func(*Aircraft) {}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
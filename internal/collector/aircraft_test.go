@@ -0,0 +1,1206 @@
+package collector
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestUpdateAircraftsFromFile(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	c := New(reg, Options{})
+	if err := c.UpdateAircraftsFromFile("testdata/aircraft.json"); err != nil {
+		t.Fatalf("UpdateAircraftsFromFile: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"adsb_aircraft_alt_baro_feet", `
+# HELP adsb_aircraft_alt_baro_feet Aircraft barometric altitude (feet)
+# TYPE adsb_aircraft_alt_baro_feet gauge
+adsb_aircraft_alt_baro_feet{category="A3",flight="SWA123",hex="abc123"} 35000
+`},
+		{"adsb_aircraft_ground_speed_kts", `
+# HELP adsb_aircraft_ground_speed_kts Aircraft ground speed (knots)
+# TYPE adsb_aircraft_ground_speed_kts gauge
+adsb_aircraft_ground_speed_kts{category="A1",flight="",hex="def456"} 5
+adsb_aircraft_ground_speed_kts{category="A3",flight="SWA123",hex="abc123"} 450.2
+`},
+		{"adsb_aircraft_nav_mode_active", `
+# HELP adsb_aircraft_nav_mode_active Navigation mode the aircraft reports as active (always 1; absent when not reported)
+# TYPE adsb_aircraft_nav_mode_active gauge
+adsb_aircraft_nav_mode_active{category="A3",flight="SWA123",hex="abc123",mode="autopilot"} 1
+adsb_aircraft_nav_mode_active{category="A3",flight="SWA123",hex="abc123",mode="vnav"} 1
+`},
+		{"adsb_aircraft_messages_total", `
+# HELP adsb_aircraft_messages_total Total messages received from the aircraft, a gauge; use adsb_aircraft_messages_received_total for rate()
+# TYPE adsb_aircraft_messages_total gauge
+adsb_aircraft_messages_total{category="A1",flight="",hex="def456"} 12
+adsb_aircraft_messages_total{category="A3",flight="SWA123",hex="abc123"} 500
+`},
+		{"adsb_aircraft_alert", `
+# HELP adsb_aircraft_alert 1 while the aircraft's flight status alert flag is set, after a squawk change or with an emergency (absent otherwise)
+# TYPE adsb_aircraft_alert gauge
+adsb_aircraft_alert{category="A3",flight="SWA123",hex="abc123"} 1
+`},
+		{"adsb_aircraft_spi", `
+# HELP adsb_aircraft_spi 1 while the aircraft's special position identification (IDENT) flag is set (absent otherwise)
+# TYPE adsb_aircraft_spi gauge
+adsb_aircraft_spi{category="A1",flight="",hex="def456"} 1
+`},
+		{"adsb_aircraft_file_timestamp_seconds", `
+# HELP adsb_aircraft_file_timestamp_seconds The now field of the last aircraft.json: Unix time the receiver wrote it
+# TYPE adsb_aircraft_file_timestamp_seconds gauge
+adsb_aircraft_file_timestamp_seconds 1.70000001e+09
+`},
+		{"adsb_aircraft_file_entries", `
+# HELP adsb_aircraft_file_entries Entries in the aircraft list of the last aircraft.json, before any filtering; with several files, the count once merged by hex
+# TYPE adsb_aircraft_file_entries gauge
+adsb_aircraft_file_entries 2
+`},
+		{"adsb_aircraft_count_by_adsb_version", `
+# HELP adsb_aircraft_count_by_adsb_version Number of current aircraft per ADS-B version (0 DO-260, 1 DO-260A, 2 DO-260B; unknown when not reported)
+# TYPE adsb_aircraft_count_by_adsb_version gauge
+adsb_aircraft_count_by_adsb_version{version="0"} 0
+adsb_aircraft_count_by_adsb_version{version="1"} 0
+adsb_aircraft_count_by_adsb_version{version="2"} 1
+adsb_aircraft_count_by_adsb_version{version="unknown"} 1
+`},
+		{"adsb_aircraft_category_count", `
+# HELP adsb_aircraft_category_count Number of current aircraft per emitter category (unknown when unset)
+# TYPE adsb_aircraft_category_count gauge
+adsb_aircraft_category_count{category="A1"} 1
+adsb_aircraft_category_count{category="A3"} 1
+`},
+		{"adsb_aircraft_category_info", `
+# HELP adsb_aircraft_category_info Human readable description of each emitter category currently seen
+# TYPE adsb_aircraft_category_info gauge
+adsb_aircraft_category_info{category="A1",description="Light"} 1
+adsb_aircraft_category_info{category="A3",description="Large"} 1
+`},
+		{"adsb_aircraft_info", `
+# HELP adsb_aircraft_info Aircraft information (squawk, emergency, type, sil_type)
+# TYPE adsb_aircraft_info gauge
+adsb_aircraft_info{category="A1",emergency="",flight="",hex="def456",sil_type="",squawk="",type=""} 1
+adsb_aircraft_info{category="A3",emergency="none",flight="SWA123",hex="abc123",sil_type="perhour",squawk="1234",type=""} 1
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := testutil.GatherAndCompare(reg, strings.NewReader(tt.expected), tt.name); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestUpdateAircraftsFromFileDeletesStale(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	c := New(reg, Options{})
+	for _, path := range []string{"testdata/aircraft.json", "testdata/aircraft_next.json"} {
+		if err := c.UpdateAircraftsFromFile(path); err != nil {
+			t.Fatalf("UpdateAircraftsFromFile(%q): %v", path, err)
+		}
+	}
+
+	expected := `
+# HELP adsb_aircraft_alt_baro_feet Aircraft barometric altitude (feet)
+# TYPE adsb_aircraft_alt_baro_feet gauge
+adsb_aircraft_alt_baro_feet{category="A1",flight="",hex="def456"} 1200
+# HELP adsb_aircraft_ground_speed_kts Aircraft ground speed (knots)
+# TYPE adsb_aircraft_ground_speed_kts gauge
+adsb_aircraft_ground_speed_kts{category="A1",flight="",hex="def456"} 120
+# HELP adsb_aircraft_category_count Number of current aircraft per emitter category (unknown when unset)
+# TYPE adsb_aircraft_category_count gauge
+adsb_aircraft_category_count{category="A1"} 1
+# HELP adsb_aircraft_category_info Human readable description of each emitter category currently seen
+# TYPE adsb_aircraft_category_info gauge
+adsb_aircraft_category_info{category="A1",description="Light"} 1
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected),
+		"adsb_aircraft_alt_baro_feet", "adsb_aircraft_ground_speed_kts", "adsb_aircraft_nav_mode_active",
+		"adsb_aircraft_category_count", "adsb_aircraft_category_info"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUpdateAircraftsFromFileInvalid(t *testing.T) {
+	c := New(prometheus.NewRegistry(), Options{})
+	if err := c.UpdateAircraftsFromFile("testdata/invalid.json"); err == nil {
+		t.Fatal("UpdateAircraftsFromFile succeeded on truncated JSON, want error")
+	}
+}
+
+func TestPositionSource(t *testing.T) {
+	tests := []struct {
+		name string
+		ac   Aircraft
+		want string
+	}{
+		{"adsb", Aircraft{MLAT: []interface{}{}, TISB: []interface{}{}}, "adsb"},
+		{"no lists", Aircraft{}, "adsb"},
+		{"mlat", Aircraft{MLAT: []interface{}{"lat", "lon"}}, "mlat"},
+		{"tisb", Aircraft{TISB: []interface{}{"altitude"}}, "tisb"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PositionSource(&tt.ac); got != tt.want {
+				t.Errorf("PositionSource = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpeedUnitKmh(t *testing.T) {
+	for _, unit := range []string{SpeedUnitKts, SpeedUnitKmh} {
+		t.Run(unit, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			c := New(reg, Options{SpeedUnit: unit})
+			if err := c.UpdateAircraftsFromFile("testdata/aircraft.json"); err != nil {
+				t.Fatal(err)
+			}
+			expected := ""
+			if unit == SpeedUnitKmh {
+				expected = `
+# HELP adsb_aircraft_tas_kmh Aircraft true air speed (km/h)
+# TYPE adsb_aircraft_tas_kmh gauge
+adsb_aircraft_tas_kmh{category="A3",flight="SWA123",hex="abc123"} 870.44
+`
+			}
+			if err := testutil.GatherAndCompare(reg, strings.NewReader(expected), "adsb_aircraft_tas_kmh"); err != nil {
+				t.Error(err)
+			}
+			// knots are exported regardless of the unit
+			if n := testutil.CollectAndCount(c.aircraft, "adsb_aircraft_ground_speed_kts"); n != 2 {
+				t.Errorf("ground speed kts series = %d, want 2", n)
+			}
+		})
+	}
+}
+
+func TestAltUnit(t *testing.T) {
+	tests := []struct {
+		unit           string
+		feet, meters   int
+		expectedMeters string
+	}{
+		{"", 1, 0, ""},
+		{AltUnitFeet, 1, 0, ""},
+		{AltUnitMeters, 0, 1, `
+# HELP adsb_aircraft_alt_baro_meters Aircraft barometric altitude (meters)
+# TYPE adsb_aircraft_alt_baro_meters gauge
+adsb_aircraft_alt_baro_meters{category="A3",flight="SWA123",hex="abc123"} 10668
+`},
+		{AltUnitBoth, 1, 1, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.unit, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			c := New(reg, Options{AltUnit: tt.unit})
+			if err := c.UpdateAircraftsFromFile("testdata/aircraft.json"); err != nil {
+				t.Fatal(err)
+			}
+			// the "ground" aircraft never gets an altitude series
+			if n := testutil.CollectAndCount(c.aircraft, "adsb_aircraft_alt_baro_feet"); n != tt.feet {
+				t.Errorf("alt_baro_feet series = %d, want %d", n, tt.feet)
+			}
+			if n := testutil.CollectAndCount(c.aircraft, "adsb_aircraft_alt_baro_meters"); n != tt.meters {
+				t.Errorf("alt_baro_meters series = %d, want %d", n, tt.meters)
+			}
+			if tt.expectedMeters != "" {
+				if err := testutil.GatherAndCompare(reg, strings.NewReader(tt.expectedMeters), "adsb_aircraft_alt_baro_meters"); err != nil {
+					t.Error(err)
+				}
+			}
+		})
+	}
+}
+
+func TestFileMessagesCounter(t *testing.T) {
+	c := New(prometheus.NewRegistry(), Options{})
+	// 123456, then 123500, then back to 123456 as if readsb had restarted
+	for _, tt := range []struct {
+		path string
+		want float64
+	}{
+		{"testdata/aircraft.json", 123456},
+		{"testdata/aircraft_next.json", 123500},
+		{"testdata/aircraft.json", 123500 + 123456},
+	} {
+		if err := c.UpdateAircraftsFromFile(tt.path); err != nil {
+			t.Fatal(err)
+		}
+		if got := testutil.ToFloat64(c.aircraft.fileMessages); got != tt.want {
+			t.Errorf("after %s: adsb_aircraft_file_messages_total = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestAircraftWithoutHexSkipped(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aircraft.json")
+	data := `{"now": 1700000010, "messages": 10, "aircraft": [
+		{"hex": "", "flight": "GHOST1", "alt_baro": 1000, "category": "A1"},
+		{"flight": "GHOST2", "alt_baro": 2000},
+		{"hex": "abc123", "alt_baro": 3000, "category": "A3"}
+	]}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := New(prometheus.NewRegistry(), Options{})
+	if err := c.UpdateAircraftsFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `
+# HELP adsb_aircraft_alt_baro_feet Aircraft barometric altitude (feet)
+# TYPE adsb_aircraft_alt_baro_feet gauge
+adsb_aircraft_alt_baro_feet{category="A3",flight="",hex="abc123"} 3000
+`
+	if err := testutil.CollectAndCompare(c.aircraft, strings.NewReader(expected), "adsb_aircraft_alt_baro_feet"); err != nil {
+		t.Error(err)
+	}
+	if got := testutil.ToFloat64(c.aircraft.noHex); got != 2 {
+		t.Errorf("adsb_exporter_aircraft_no_hex_total = %v, want 2", got)
+	}
+	// the skipped A1 aircraft isn't counted
+	expected = `
+# HELP adsb_aircraft_category_count Number of current aircraft per emitter category (unknown when unset)
+# TYPE adsb_aircraft_category_count gauge
+adsb_aircraft_category_count{category="A3"} 1
+`
+	if err := testutil.CollectAndCompare(c.aircraft, strings.NewReader(expected), "adsb_aircraft_category_count"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNormalizeFlight(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"SWA123", "SWA123"},
+		{"SWA123  ", "SWA123"},
+		{" swa123", "SWA123"},
+		{"   ", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := NormalizeFlight(tt.in); got != tt.want {
+			t.Errorf("NormalizeFlight(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPaddedFlightSharesSeries(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, flight string) string {
+		path := filepath.Join(dir, name)
+		data := `{"now": 1700000010, "aircraft": [{"hex": "abc123", "flight": "` + flight + `", "alt_baro": 3000, "category": "A3"}]}`
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	c := New(prometheus.NewRegistry(), Options{})
+	for _, path := range []string{write("padded.json", "SWA123  "), write("trimmed.json", "SWA123")} {
+		if err := c.UpdateAircraftsFromFile(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := `
+# HELP adsb_aircraft_alt_baro_feet Aircraft barometric altitude (feet)
+# TYPE adsb_aircraft_alt_baro_feet gauge
+adsb_aircraft_alt_baro_feet{category="A3",flight="SWA123",hex="abc123"} 3000
+`
+	if err := testutil.CollectAndCompare(c.aircraft, strings.NewReader(expected), "adsb_aircraft_alt_baro_feet"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNormalizeHex(t *testing.T) {
+	tests := []struct {
+		in, want string
+		nonICAO  bool
+	}{
+		{"abc123", "abc123", false},
+		{"ABC123", "abc123", false},
+		{" AbC123 ", "abc123", false},
+		{"~2E4B8A", "~2e4b8a", true},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		got := NormalizeHex(tt.in)
+		if got != tt.want {
+			t.Errorf("NormalizeHex(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+		if IsNonICAO(got) != tt.nonICAO {
+			t.Errorf("IsNonICAO(%q) = %v, want %v", got, !tt.nonICAO, tt.nonICAO)
+		}
+	}
+}
+
+func TestNavModesFollowTheArray(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, flight, modes string) string {
+		path := filepath.Join(dir, name)
+		data := `{"now": 1700000010, "aircraft": [
+			{"hex": "abc123", "flight": "` + flight + `", "category": "A3", "nav_modes": ` + modes + `},
+			{"hex": "def456", "category": "A1", "nav_modes": ["autopilot"]}
+		]}`
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	c := New(prometheus.NewRegistry(), Options{})
+	for _, path := range []string{
+		write("1.json", "SWA123", `["autopilot", "vnav", "emergency_descent"]`),
+		// vnav and the unknown mode drop out, callsign changes
+		write("2.json", "SWA124", `["autopilot", "approach"]`),
+	} {
+		if err := c.UpdateAircraftsFromFile(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := `
+# HELP adsb_aircraft_nav_mode_active Navigation mode the aircraft reports as active (always 1; absent when not reported)
+# TYPE adsb_aircraft_nav_mode_active gauge
+adsb_aircraft_nav_mode_active{category="A1",flight="",hex="def456",mode="autopilot"} 1
+adsb_aircraft_nav_mode_active{category="A3",flight="SWA124",hex="abc123",mode="approach"} 1
+adsb_aircraft_nav_mode_active{category="A3",flight="SWA124",hex="abc123",mode="autopilot"} 1
+# HELP adsb_aircraft_nav_mode_count Number of current aircraft reporting each navigation mode
+# TYPE adsb_aircraft_nav_mode_count gauge
+adsb_aircraft_nav_mode_count{mode="approach"} 1
+adsb_aircraft_nav_mode_count{mode="autopilot"} 2
+`
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(c.aircraft)
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected), "adsb_aircraft_nav_mode_active", "adsb_aircraft_nav_mode_count"); err != nil {
+		t.Error(err)
+	}
+
+	// a mode disappearing for an aircraft that otherwise stays the same
+	if err := c.UpdateAircraftsFromFile(write("3.json", "SWA124", `[]`)); err != nil {
+		t.Fatal(err)
+	}
+	if n := testutil.CollectAndCount(c.aircraft, "adsb_aircraft_nav_mode_active"); n != 1 {
+		t.Errorf("nav_mode_active series after modes cleared = %d, want 1", n)
+	}
+}
+
+func TestHexNormalizationLabels(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, aircraft string) string {
+		path := filepath.Join(dir, name)
+		data := `{"now": 1700000010, "aircraft": [` + aircraft + `]}`
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	reg := prometheus.NewPedanticRegistry()
+	c := New(prometheus.NewRegistry(), Options{})
+	reg.MustRegister(c.aircraft)
+
+	steps := []struct {
+		aircraft string
+		expected string
+	}{
+		{
+			`{"hex": "ABC123", "alt_baro": 1000}, {"hex": "~2E4B8A", "alt_baro": 2000}`,
+			`
+adsb_aircraft_alt_baro_feet{category="",flight="",hex="abc123"} 1000
+adsb_aircraft_alt_baro_feet{category="",flight="",hex="~2e4b8a"} 2000
+adsb_aircraft_non_icao{category="",flight="",hex="~2e4b8a"} 1
+`,
+		},
+		{
+			// same aircraft with the other case: no duplicate series
+			`{"hex": "abc123", "alt_baro": 1100}, {"hex": "~2e4b8a", "alt_baro": 2100}`,
+			`
+adsb_aircraft_alt_baro_feet{category="",flight="",hex="abc123"} 1100
+adsb_aircraft_alt_baro_feet{category="",flight="",hex="~2e4b8a"} 2100
+adsb_aircraft_non_icao{category="",flight="",hex="~2e4b8a"} 1
+`,
+		},
+		{
+			// a TIS-B target with the address of an aircraft in view
+			// keeps series of its own
+			`{"hex": "abc123", "alt_baro": 1150}, {"hex": "~ABC123", "alt_baro": 9000}`,
+			`
+adsb_aircraft_alt_baro_feet{category="",flight="",hex="abc123"} 1150
+adsb_aircraft_alt_baro_feet{category="",flight="",hex="~abc123"} 9000
+adsb_aircraft_non_icao{category="",flight="",hex="~abc123"} 1
+`,
+		},
+		{
+			// the non-ICAO target leaves
+			`{"hex": "Abc123", "alt_baro": 1200}`,
+			`
+adsb_aircraft_alt_baro_feet{category="",flight="",hex="abc123"} 1200
+`,
+		},
+	}
+	header := `
+# HELP adsb_aircraft_alt_baro_feet Aircraft barometric altitude (feet)
+# TYPE adsb_aircraft_alt_baro_feet gauge
+# HELP adsb_aircraft_non_icao 1 for aircraft with a non-ICAO ("~" prefixed) address, such as TIS-B targets; the hex label keeps the prefix
+# TYPE adsb_aircraft_non_icao gauge
+`
+	for i, step := range steps {
+		if err := c.UpdateAircraftsFromFile(write(fmt.Sprintf("%d.json", i), step.aircraft)); err != nil {
+			t.Fatal(err)
+		}
+		if err := testutil.GatherAndCompare(reg, strings.NewReader(header+step.expected), "adsb_aircraft_alt_baro_feet", "adsb_aircraft_non_icao"); err != nil {
+			t.Errorf("step %d: %v", i, err)
+		}
+	}
+}
+
+func TestDuplicateAircraftEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aircraft.json")
+	data := `{"now": 1700000010, "aircraft": [
+		{"hex": "abc123", "alt_baro": 1000, "gs": 200},
+		{"hex": "ABC123", "alt_baro": 1100}
+	]}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	reg := prometheus.NewPedanticRegistry()
+	c := New(reg, Options{})
+	if err := c.UpdateAircraftsFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// the later entry replaces the earlier one whole
+	expected := `
+# HELP adsb_aircraft_alt_baro_feet Aircraft barometric altitude (feet)
+# TYPE adsb_aircraft_alt_baro_feet gauge
+adsb_aircraft_alt_baro_feet{category="",flight="",hex="abc123"} 1100
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected),
+		"adsb_aircraft_alt_baro_feet", "adsb_aircraft_ground_speed_kts"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTrackComponents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aircraft.json")
+	data := `{"now": 1700000010, "aircraft": [{"hex": "abc123", "track": 270, "true_heading": 0}]}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	reg := prometheus.NewRegistry()
+	c := New(reg, Options{})
+	if err := c.UpdateAircraftsFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]float64{
+		"adsb_aircraft_track_sin":        -1,
+		"adsb_aircraft_track_cos":        0,
+		"adsb_aircraft_true_heading_sin": 0,
+		"adsb_aircraft_true_heading_cos": 1,
+	}
+	for _, mf := range mfs {
+		w, ok := want[mf.GetName()]
+		if !ok {
+			continue
+		}
+		delete(want, mf.GetName())
+		if got := mf.GetMetric()[0].GetGauge().GetValue(); math.Abs(got-w) > 1e-9 {
+			t.Errorf("%s = %v, want %v", mf.GetName(), got, w)
+		}
+	}
+	for name := range want {
+		t.Errorf("%s not exported", name)
+	}
+}
+
+func TestNavQNHDeviation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aircraft.json")
+	write := func(data string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := New(prometheus.NewRegistry(), Options{})
+	write(`{"now": 1700000010, "aircraft": [{"hex": "abc123", "nav_qnh": 998.5}]}`)
+	if err := c.UpdateAircraftsFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+	expected := `
+# HELP adsb_aircraft_nav_qnh_deviation_hpa Aircraft nav QNH less the standard 1013.25 hPa
+# TYPE adsb_aircraft_nav_qnh_deviation_hpa gauge
+adsb_aircraft_nav_qnh_deviation_hpa{category="",flight="",hex="abc123"} -14.75
+`
+	if err := testutil.CollectAndCompare(c.aircraft, strings.NewReader(expected), "adsb_aircraft_nav_qnh_deviation_hpa"); err != nil {
+		t.Error(err)
+	}
+
+	write(`{"now": 1700000015, "aircraft": [{"hex": "abc123"}]}`)
+	if err := c.UpdateAircraftsFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if n := testutil.CollectAndCount(c.aircraft, "adsb_aircraft_nav_qnh_deviation_hpa"); n != 0 {
+		t.Errorf("deviation series after nav_qnh went away = %d, want 0", n)
+	}
+}
+
+func TestAltDeviation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aircraft.json")
+	data := `{"now": 1700000010, "aircraft": [
+		{"hex": "aaaaaa", "alt_baro": 35200, "nav_altitude_mcp": 35000, "nav_altitude_fms": 37000},
+		{"hex": "bbbbbb", "alt_baro": 12000, "nav_altitude_fms": 16000},
+		{"hex": "cccccc", "alt_baro": "ground", "nav_altitude_mcp": 3000},
+		{"hex": "dddddd", "alt_baro": 8000},
+		{"hex": "eeeeee", "nav_altitude_mcp": 8000},
+		{"hex": "ffffff", "alt_baro": 90000, "nav_altitude_mcp": 35000}]}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := New(prometheus.NewRegistry(), Options{})
+	if err := c.UpdateAircraftsFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+	expected := `
+# HELP adsb_aircraft_alt_deviation_feet Aircraft barometric altitude less its selected altitude, from MCP or else FMS; positive when above it (feet)
+# TYPE adsb_aircraft_alt_deviation_feet gauge
+adsb_aircraft_alt_deviation_feet{category="",flight="",hex="aaaaaa"} 200
+adsb_aircraft_alt_deviation_feet{category="",flight="",hex="bbbbbb"} -4000
+`
+	if err := testutil.CollectAndCompare(c.aircraft, strings.NewReader(expected), "adsb_aircraft_alt_deviation_feet"); err != nil {
+		t.Error(err)
+	}
+	// the out-of-range altitude is discarded once, not again for the deviation
+	if n := testutil.ToFloat64(c.aircraft.discarded.WithLabelValues("alt_baro")); n != 1 {
+		t.Errorf("discarded alt_baro = %v, want 1", n)
+	}
+}
+
+func TestAirlineDesignator(t *testing.T) {
+	tests := []struct {
+		in, want string
+		ok       bool
+	}{
+		{"UAL123", "UAL", true},
+		{"BAW9KL", "BAW", true},
+		{"DLH4", "DLH", true},
+		{"N123AB", "", false},
+		{"GABCD", "", false},
+		{"JA01AB", "", false},
+		{"1234", "", false},
+		{"UAL", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := airlineDesignator(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("airlineDesignator(%q) = %q, %v, want %q, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestCountByOperator(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aircraft.json")
+	write := func(data string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := New(prometheus.NewRegistry(), Options{})
+	write(`{"now": 1700000010, "aircraft": [
+		{"hex": "aaaaaa", "flight": "UAL123  "},
+		{"hex": "bbbbbb", "flight": "ual9"},
+		{"hex": "cccccc", "flight": "BAW9KL"},
+		{"hex": "dddddd", "flight": "N123AB"},
+		{"hex": "eeeeee", "flight": "1234"},
+		{"hex": "ffffff"}]}`)
+	if err := c.UpdateAircraftsFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+	expected := `
+# HELP adsb_aircraft_count_by_operator Number of current aircraft per ICAO airline designator, the first three letters of callsigns like UAL123; other for the rest, such as registrations and aircraft without a callsign
+# TYPE adsb_aircraft_count_by_operator gauge
+adsb_aircraft_count_by_operator{operator="BAW"} 1
+adsb_aircraft_count_by_operator{operator="UAL"} 2
+adsb_aircraft_count_by_operator{operator="other"} 3
+`
+	if err := testutil.CollectAndCompare(c.aircraft, strings.NewReader(expected), "adsb_aircraft_count_by_operator"); err != nil {
+		t.Error(err)
+	}
+
+	// BAW and the others leave
+	write(`{"now": 1700000015, "aircraft": [{"hex": "aaaaaa", "flight": "UAL123"}]}`)
+	if err := c.UpdateAircraftsFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+	expected = `
+# HELP adsb_aircraft_count_by_operator Number of current aircraft per ICAO airline designator, the first three letters of callsigns like UAL123; other for the rest, such as registrations and aircraft without a callsign
+# TYPE adsb_aircraft_count_by_operator gauge
+adsb_aircraft_count_by_operator{operator="UAL"} 1
+`
+	if err := testutil.CollectAndCompare(c.aircraft, strings.NewReader(expected), "adsb_aircraft_count_by_operator"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTurning(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aircraft.json")
+	write := func(data string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := New(prometheus.NewRegistry(), Options{TurnDeadband: 5})
+	write(`{"now": 1700000010, "aircraft": [
+		{"hex": "aaaaaa", "roll": -25.3},
+		{"hex": "bbbbbb", "roll": 4.9},
+		{"hex": "cccccc", "roll": 5},
+		{"hex": "dddddd", "roll": -5},
+		{"hex": "eeeeee"}]}`)
+	if err := c.UpdateAircraftsFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+	expected := `
+# HELP adsb_aircraft_turning Aircraft turn direction from its roll: -1 left, 0 straight (within TURN_DEADBAND_DEGREES), 1 right
+# TYPE adsb_aircraft_turning gauge
+adsb_aircraft_turning{category="",flight="",hex="aaaaaa"} -1
+adsb_aircraft_turning{category="",flight="",hex="bbbbbb"} 0
+adsb_aircraft_turning{category="",flight="",hex="cccccc"} 1
+adsb_aircraft_turning{category="",flight="",hex="dddddd"} -1
+`
+	if err := testutil.CollectAndCompare(c.aircraft, strings.NewReader(expected), "adsb_aircraft_turning"); err != nil {
+		t.Error(err)
+	}
+
+	// roll no longer reported, and an aircraft gone
+	write(`{"now": 1700000015, "aircraft": [{"hex": "aaaaaa"}, {"hex": "bbbbbb", "roll": 12}]}`)
+	if err := c.UpdateAircraftsFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+	expected = `
+# HELP adsb_aircraft_turning Aircraft turn direction from its roll: -1 left, 0 straight (within TURN_DEADBAND_DEGREES), 1 right
+# TYPE adsb_aircraft_turning gauge
+adsb_aircraft_turning{category="",flight="",hex="bbbbbb"} 1
+`
+	if err := testutil.CollectAndCompare(c.aircraft, strings.NewReader(expected), "adsb_aircraft_turning"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFlightsCount(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aircraft.json")
+	data := `{"now": 1700000000, "aircraft": [
+		{"hex": "aaaaaa", "flight": "SWA123  "},
+		{"hex": "bbbbbb", "flight": "swa123"},
+		{"hex": "cccccc", "flight": "  "},
+		{"hex": "dddddd"},
+		{"hex": "eeeeee", "flight": "DAL9"}
+	]}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := New(prometheus.NewRegistry(), Options{})
+	if err := c.UpdateAircraftsFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+	expected := `
+# HELP adsb_flights_total Number of distinct callsigns among the current aircraft; aircraft without one aren't counted and MLAT duplicates count once
+# TYPE adsb_flights_total gauge
+adsb_flights_total 2
+`
+	if err := testutil.CollectAndCompare(c.aircraft, strings.NewReader(expected), "adsb_flights_total"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDBFlags(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aircraft.json")
+	write := func(data string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	names := []string{"adsb_aircraft_db_military", "adsb_aircraft_db_interesting", "adsb_aircraft_db_pia", "adsb_aircraft_db_ladd"}
+	c := New(prometheus.NewRegistry(), Options{})
+	write(`{"now": 1700000010, "aircraft": [{"hex": "aaaaaa", "dbFlags": 9}, {"hex": "bbbbbb", "dbFlags": 0}, {"hex": "cccccc"}]}`)
+	if err := c.UpdateAircraftsFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+	expected := `
+# HELP adsb_aircraft_db_interesting 1 if tar1090's database flags the aircraft as interesting, else 0 (absent without dbFlags)
+# TYPE adsb_aircraft_db_interesting gauge
+adsb_aircraft_db_interesting{category="",flight="",hex="aaaaaa"} 0
+adsb_aircraft_db_interesting{category="",flight="",hex="bbbbbb"} 0
+# HELP adsb_aircraft_db_ladd 1 if tar1090's database flags the aircraft as on the FAA LADD list, else 0 (absent without dbFlags)
+# TYPE adsb_aircraft_db_ladd gauge
+adsb_aircraft_db_ladd{category="",flight="",hex="aaaaaa"} 1
+adsb_aircraft_db_ladd{category="",flight="",hex="bbbbbb"} 0
+# HELP adsb_aircraft_db_military 1 if tar1090's database flags the aircraft as military, else 0 (absent without dbFlags)
+# TYPE adsb_aircraft_db_military gauge
+adsb_aircraft_db_military{category="",flight="",hex="aaaaaa"} 1
+adsb_aircraft_db_military{category="",flight="",hex="bbbbbb"} 0
+# HELP adsb_aircraft_db_pia 1 if tar1090's database flags the address as a Privacy ICAO Address, else 0 (absent without dbFlags)
+# TYPE adsb_aircraft_db_pia gauge
+adsb_aircraft_db_pia{category="",flight="",hex="aaaaaa"} 0
+adsb_aircraft_db_pia{category="",flight="",hex="bbbbbb"} 0
+`
+	if err := testutil.CollectAndCompare(c.aircraft, strings.NewReader(expected), names...); err != nil {
+		t.Error(err)
+	}
+
+	// dbFlags gone, and an aircraft gone
+	write(`{"now": 1700000015, "aircraft": [{"hex": "aaaaaa"}]}`)
+	if err := c.UpdateAircraftsFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if n := testutil.CollectAndCount(c.aircraft, names...); n != 0 {
+		t.Errorf("database flag series after dbFlags went away = %d, want 0", n)
+	}
+}
+
+func TestAlertAndSPIFlags(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aircraft.json")
+	c := New(prometheus.NewRegistry(), Options{})
+	for i, tt := range []struct {
+		data           string
+		alert, ident   string
+		alerts, idents float64
+	}{
+		{`[{"hex": "aaaaaa", "alert": 1, "spi": 0}, {"hex": "bbbbbb", "alert": 0, "spi": 1}, {"hex": "cccccc"}]`, "aaaaaa", "bbbbbb", 1, 1},
+		// IDENT released, alert cleared
+		{`[{"hex": "aaaaaa", "alert": 0}, {"hex": "bbbbbb", "spi": 0}]`, "", "", 0, 0},
+	} {
+		data := `{"now": 1700000010, "aircraft": ` + tt.data + `}`
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.UpdateAircraftsFromFile(path); err != nil {
+			t.Fatal(err)
+		}
+		expected := fmt.Sprintf(`
+# HELP adsb_aircraft_alert_count Number of current aircraft with the flight status alert flag set
+# TYPE adsb_aircraft_alert_count gauge
+adsb_aircraft_alert_count %v
+# HELP adsb_aircraft_spi_count Number of current aircraft with the IDENT flag set
+# TYPE adsb_aircraft_spi_count gauge
+adsb_aircraft_spi_count %v
+`, tt.alerts, tt.idents)
+		if tt.alert != "" {
+			expected += `# HELP adsb_aircraft_alert 1 while the aircraft's flight status alert flag is set, after a squawk change or with an emergency (absent otherwise)
+# TYPE adsb_aircraft_alert gauge
+adsb_aircraft_alert{category="",flight="",hex="` + tt.alert + `"} 1
+`
+		}
+		if tt.ident != "" {
+			expected += `# HELP adsb_aircraft_spi 1 while the aircraft's special position identification (IDENT) flag is set (absent otherwise)
+# TYPE adsb_aircraft_spi gauge
+adsb_aircraft_spi{category="",flight="",hex="` + tt.ident + `"} 1
+`
+		}
+		if err := testutil.CollectAndCompare(c.aircraft, strings.NewReader(expected),
+			"adsb_aircraft_alert", "adsb_aircraft_spi", "adsb_aircraft_alert_count", "adsb_aircraft_spi_count"); err != nil {
+			t.Errorf("update %d: %v", i+1, err)
+		}
+	}
+}
+
+func TestMeteorologicalFields(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aircraft.json")
+	write := func(data string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	names := []string{
+		"adsb_aircraft_wind_speed_reported_kts",
+		"adsb_aircraft_wind_direction_reported_deg",
+		"adsb_aircraft_oat_celsius",
+		"adsb_aircraft_tat_celsius",
+	}
+	c := New(prometheus.NewRegistry(), Options{})
+	write(`{"now": 1700000010, "aircraft": [{"hex": "abc123", "ws": 42, "wd": 275, "oat": -48, "tat": -21}]}`)
+	if err := c.UpdateAircraftsFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+	expected := `
+# HELP adsb_aircraft_oat_celsius Outside air temperature reported by the aircraft (°C)
+# TYPE adsb_aircraft_oat_celsius gauge
+adsb_aircraft_oat_celsius{category="",flight="",hex="abc123"} -48
+# HELP adsb_aircraft_tat_celsius Total air temperature reported by the aircraft (°C)
+# TYPE adsb_aircraft_tat_celsius gauge
+adsb_aircraft_tat_celsius{category="",flight="",hex="abc123"} -21
+# HELP adsb_aircraft_wind_direction_reported_deg Wind direction reported by the aircraft (degrees)
+# TYPE adsb_aircraft_wind_direction_reported_deg gauge
+adsb_aircraft_wind_direction_reported_deg{category="",flight="",hex="abc123"} 275
+# HELP adsb_aircraft_wind_speed_reported_kts Wind speed reported by the aircraft (knots)
+# TYPE adsb_aircraft_wind_speed_reported_kts gauge
+adsb_aircraft_wind_speed_reported_kts{category="",flight="",hex="abc123"} 42
+`
+	if err := testutil.CollectAndCompare(c.aircraft, strings.NewReader(expected), names...); err != nil {
+		t.Error(err)
+	}
+
+	write(`{"now": 1700000015, "aircraft": [{"hex": "abc123"}]}`)
+	if err := c.UpdateAircraftsFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if n := testutil.CollectAndCount(c.aircraft, names...); n != 0 {
+		t.Errorf("meteorological series after the fields went away = %d, want 0", n)
+	}
+}
+
+func TestACASResolutionAdvisory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aircraft.json")
+	c := New(prometheus.NewRegistry(), Options{DeleteGrace: 1})
+	for i, tt := range []struct {
+		data   string
+		active string
+		events float64
+	}{
+		{`[{"hex": "aaaaaa", "flight": "ABC1", "acas_ra": {"utc": "12:00:01.0", "advisory": "Climb", "ARA": "1000000"}},
+		   {"hex": "bbbbbb"}]`, "aaaaaa", 1},
+		// still the same advisory; bbbbbb's has subfields of the wrong type
+		{`[{"hex": "aaaaaa", "flight": "ABC1", "acas_ra": {"utc": "12:00:01.0"}},
+		   {"hex": "bbbbbb", "acas_ra": {"utc": 5, "ARA": null}}]`, "aaaaaa,bbbbbb", 2},
+		{`[{"hex": "aaaaaa", "flight": "ABC1"}, {"hex": "bbbbbb", "acas_ra": null}]`, "", 2},
+		// a new advisory for aaaaaa
+		{`[{"hex": "aaaaaa", "flight": "ABC1", "acas_ra": {}}]`, "aaaaaa", 3},
+		// aaaaaa misses a file, held by the grace, and comes back with
+		// the same advisory
+		{`[]`, "aaaaaa", 3},
+		{`[{"hex": "aaaaaa", "flight": "ABC1", "acas_ra": {}}]`, "aaaaaa", 3},
+	} {
+		data := `{"now": 1700000010, "aircraft": ` + tt.data + `}`
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.UpdateAircraftsFromFile(path); err != nil {
+			t.Fatal(err)
+		}
+		expected := `
+# HELP adsb_aircraft_acas_ra_active 1 while the aircraft reports an ACAS/TCAS resolution advisory (absent otherwise)
+# TYPE adsb_aircraft_acas_ra_active gauge
+`
+		for _, hex := range strings.Split(tt.active, ",") {
+			if hex != "" {
+				flight := map[string]string{"aaaaaa": "ABC1"}[hex]
+				expected += fmt.Sprintf("adsb_aircraft_acas_ra_active{category=\"\",flight=%q,hex=%q} 1\n", flight, hex)
+			}
+		}
+		if err := testutil.CollectAndCompare(c.aircraft, strings.NewReader(expected), "adsb_aircraft_acas_ra_active"); err != nil {
+			t.Errorf("update %d: %v", i+1, err)
+		}
+		if got := testutil.ToFloat64(c.aircraft.acasRAEvents); got != tt.events {
+			t.Errorf("update %d: events = %v, want %v", i+1, got, tt.events)
+		}
+	}
+}
+
+func TestUpdateAircraftsFromFilesMergesByHex(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"1090.json": `{"now": 1700000010, "messages": 100, "aircraft": [
+			{"hex": "aaaaaa", "gs": 400, "seen": 0.5},
+			{"hex": "bbbbbb", "gs": 300, "seen": 5},
+			{"hex": "cccccc", "gs": 200}]}`,
+		// aaaaaa heard later here, bbbbbb earlier; cccccc has no seen in
+		// either, so the later file wins
+		"978.json": `{"now": 1700000011, "messages": 20, "aircraft": [
+			{"hex": "AAAAAA", "gs": 401, "seen": 2},
+			{"hex": "bbbbbb", "gs": 301, "seen": 1},
+			{"hex": "cccccc", "gs": 201},
+			{"hex": "dddddd", "gs": 100}]}`,
+	}
+	var paths []string
+	for _, name := range []string{"1090.json", "978.json"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(files[name]), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	c := New(prometheus.NewRegistry(), Options{})
+	if err := c.UpdateAircraftsFromFiles(paths...); err != nil {
+		t.Fatal(err)
+	}
+	expected := `
+# HELP adsb_aircraft_ground_speed_kts Aircraft ground speed (knots)
+# TYPE adsb_aircraft_ground_speed_kts gauge
+adsb_aircraft_ground_speed_kts{category="",flight="",hex="aaaaaa"} 400
+adsb_aircraft_ground_speed_kts{category="",flight="",hex="bbbbbb"} 301
+adsb_aircraft_ground_speed_kts{category="",flight="",hex="cccccc"} 201
+adsb_aircraft_ground_speed_kts{category="",flight="",hex="dddddd"} 100
+# HELP adsb_aircraft_file_entries Entries in the aircraft list of the last aircraft.json, before any filtering; with several files, the count once merged by hex
+# TYPE adsb_aircraft_file_entries gauge
+adsb_aircraft_file_entries 4
+`
+	if err := testutil.CollectAndCompare(c.aircraft, strings.NewReader(expected),
+		"adsb_aircraft_ground_speed_kts", "adsb_aircraft_file_entries"); err != nil {
+		t.Error(err)
+	}
+	a, meta := c.ParsedAircraft()
+	if a.Now != 1700000011 || a.Messages != 120 || len(a.Aircraft) != 4 {
+		t.Errorf("merged file: now %v, messages %d, %d aircraft; want 1700000011, 120, 4", a.Now, a.Messages, len(a.Aircraft))
+	}
+	if want := strings.Join(paths, ","); meta.Source != want {
+		t.Errorf("source = %q, want %q", meta.Source, want)
+	}
+
+	// one broken file fails the whole update and leaves the metrics alone
+	if err := os.WriteFile(paths[1], []byte(`{"aircraft": [`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.UpdateAircraftsFromFiles(paths...); err == nil {
+		t.Fatal("UpdateAircraftsFromFiles succeeded with a truncated file, want error")
+	}
+	if err := testutil.CollectAndCompare(c.aircraft, strings.NewReader(expected), "adsb_aircraft_ground_speed_kts"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestWrappedAltitude(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aircraft.json")
+	data := `{"now": 1700000010, "aircraft": [
+		{"hex": "aaaaaa", "alt_baro": {"value": 12000}, "alt_geom": [12400]},
+		{"hex": "bbbbbb", "alt_baro": ["ground"]}]}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := New(prometheus.NewRegistry(), Options{})
+	if err := c.UpdateAircraftsFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+	expected := `
+# HELP adsb_aircraft_alt_baro_feet Aircraft barometric altitude (feet)
+# TYPE adsb_aircraft_alt_baro_feet gauge
+adsb_aircraft_alt_baro_feet{category="",flight="",hex="aaaaaa"} 12000
+# HELP adsb_aircraft_alt_geom_feet Aircraft geometric (GNSS/INS) altitude (feet)
+# TYPE adsb_aircraft_alt_geom_feet gauge
+adsb_aircraft_alt_geom_feet{category="",flight="",hex="aaaaaa"} 12400
+`
+	if err := testutil.CollectAndCompare(c.aircraft, strings.NewReader(expected),
+		"adsb_aircraft_alt_baro_feet", "adsb_aircraft_alt_geom_feet"); err != nil {
+		t.Error(err)
+	}
+	a, _ := c.ParsedAircraft()
+	if !OnGround(&a.Aircraft[1]) {
+		t.Errorf("OnGround(%v) = false, want true", a.Aircraft[1].AltBaro)
+	}
+}
+
+func TestAircraftChurnCounters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aircraft.json")
+	c := New(prometheus.NewRegistry(), Options{MaxAircraft: 1, ExcludeCategories: []string{"C1"}})
+	for i, tt := range []struct {
+		data              string
+		wantNew, wantLost float64
+	}{
+		// the first file only seeds the set
+		{`[{"hex": "aaaaaa", "rssi": -10}, {"hex": "bbbbbb", "rssi": -20}]`, 0, 0},
+		// cccccc is new and aaaaaa lost; bbbbbb was left out by
+		// MaxAircraft, not absent
+		{`[{"hex": "bbbbbb", "rssi": -5}, {"hex": "CCCCCC", "rssi": -30}, {"hex": "dddddd", "category": "C1"}]`, 1, 1},
+		{`[]`, 1, 3},
+		// a bare "~" is no more an aircraft than a missing hex
+		{`[{"hex": "aaaaaa"}, {"hex": "aaaaaa"}, {"hex": "eeeeee"}, {"flight": "NOHEX"}, {"hex": "~"}]`, 3, 3},
+		// a padded, lowercase C1 is still excluded
+		{`[{"hex": "aaaaaa"}, {"hex": "eeeeee"}, {"hex": "ffffff", "category": "c1 "}]`, 3, 3},
+	} {
+		data := `{"now": 1700000010, "aircraft": ` + tt.data + `}`
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.UpdateAircraftsFromFile(path); err != nil {
+			t.Fatal(err)
+		}
+		if got := testutil.ToFloat64(c.aircraft.newAircraft); got != tt.wantNew {
+			t.Errorf("update %d: new aircraft = %v, want %v", i+1, got, tt.wantNew)
+		}
+		if got := testutil.ToFloat64(c.aircraft.lostAircraft); got != tt.wantLost {
+			t.Errorf("update %d: lost aircraft = %v, want %v", i+1, got, tt.wantLost)
+		}
+	}
+}
+
+func TestDeleteGrace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aircraft.json")
+	c := New(prometheus.NewRegistry(), Options{DeleteGrace: 2})
+	for i, tt := range []struct {
+		aircraft string
+		want     string
+	}{
+		{`[{"hex": "aaaaaa", "rssi": -10}, {"hex": "bbbbbb", "rssi": -20}, {"hex": "cccccc", "flight": "ABC1", "rssi": -30}]`, `
+adsb_aircraft_rssi_dbfs{category="",flight="",hex="aaaaaa"} -10
+adsb_aircraft_rssi_dbfs{category="",flight="",hex="bbbbbb"} -20
+adsb_aircraft_rssi_dbfs{category="",flight="ABC1",hex="cccccc"} -30
+`},
+		// bbbbbb misses a file and keeps its last value; cccccc's new
+		// callsign replaces its old series at once
+		{`[{"hex": "aaaaaa", "rssi": -11}, {"hex": "cccccc", "flight": "ABC2", "rssi": -31}]`, `
+adsb_aircraft_rssi_dbfs{category="",flight="",hex="aaaaaa"} -11
+adsb_aircraft_rssi_dbfs{category="",flight="",hex="bbbbbb"} -20
+adsb_aircraft_rssi_dbfs{category="",flight="ABC2",hex="cccccc"} -31
+`},
+		{`[{"hex": "aaaaaa", "rssi": -12}]`, `
+adsb_aircraft_rssi_dbfs{category="",flight="",hex="aaaaaa"} -12
+adsb_aircraft_rssi_dbfs{category="",flight="",hex="bbbbbb"} -20
+adsb_aircraft_rssi_dbfs{category="",flight="ABC2",hex="cccccc"} -31
+`},
+		// bbbbbb has now been missing for three
+		{`[{"hex": "aaaaaa", "rssi": -13}, {"hex": "cccccc", "flight": "ABC2", "rssi": -32}]`, `
+adsb_aircraft_rssi_dbfs{category="",flight="",hex="aaaaaa"} -13
+adsb_aircraft_rssi_dbfs{category="",flight="ABC2",hex="cccccc"} -32
+`},
+		// back again, and its grace starts over
+		{`[{"hex": "bbbbbb", "rssi": -21}]`, `
+adsb_aircraft_rssi_dbfs{category="",flight="",hex="aaaaaa"} -13
+adsb_aircraft_rssi_dbfs{category="",flight="",hex="bbbbbb"} -21
+adsb_aircraft_rssi_dbfs{category="",flight="ABC2",hex="cccccc"} -32
+`},
+	} {
+		data := fmt.Sprintf(`{"now": %d, "aircraft": %s}`, 1700000000+i, tt.aircraft)
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.UpdateAircraftsFromFile(path); err != nil {
+			t.Fatal(err)
+		}
+		expected := `
+# HELP adsb_aircraft_rssi_dbfs Recent average RSSI (dBFS)
+# TYPE adsb_aircraft_rssi_dbfs gauge
+` + strings.TrimPrefix(tt.want, "\n")
+		if err := testutil.CollectAndCompare(c.aircraft, strings.NewReader(expected), "adsb_aircraft_rssi_dbfs"); err != nil {
+			t.Errorf("update %d: %v", i+1, err)
+		}
+	}
+	if n := len(c.absentAircraft); n != 2 {
+		t.Errorf("%d aircraft waiting for deletion, want 2", n)
+	}
+}
+
+func TestEmptyAircraftGrace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aircraft.json")
+	c := New(prometheus.NewRegistry(), Options{EmptyAircraftGrace: 2})
+	for i, tt := range []struct {
+		data string
+		want int
+	}{
+		{`[{"hex": "aaaaaa"}, {"hex": "bbbbbb"}]`, 2},
+		// two empty files are held, the third goes through
+		{`[]`, 2},
+		{`null`, 2},
+		{`[]`, 0},
+		// nothing to hold once the aircraft are gone
+		{`[]`, 0},
+		{`[{"hex": "aaaaaa"}]`, 1},
+		// the grace starts over after a file with aircraft
+		{`[]`, 1},
+		{`[{"hex": "cccccc"}]`, 1},
+	} {
+		data := `{"now": 1700000010, "aircraft": ` + tt.data + `}`
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.UpdateAircraftsFromFile(path); err != nil {
+			t.Fatal(err)
+		}
+		if n := testutil.CollectAndCount(c.aircraft, "adsb_aircraft_messages_total"); n != tt.want {
+			t.Errorf("update %d: %d aircraft, want %d", i+1, n, tt.want)
+		}
+	}
+}
+
+func TestSanitizeLabelValue(t *testing.T) {
+	long := strings.Repeat("x", MaxLabelValueLength)
+	tests := []struct {
+		in, want string
+	}{
+		{"SWA123", "SWA123"},
+		{"", ""},
+		{"SW\xffA1\xc323", "SWA123"},
+		{long + "yz", long},
+		// a multi-byte rune straddling the limit goes entirely
+		{long[1:] + "é", long[1:]},
+	}
+	for _, tt := range tests {
+		if got := SanitizeLabelValue(tt.in); got != tt.want {
+			t.Errorf("SanitizeLabelValue(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestAircraftDBInfoInvalidUTF8(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aircraft.json")
+	if err := os.WriteFile(path, []byte(`{"now": 1700000010, "aircraft": [{"hex": "abc123"}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := New(prometheus.NewRegistry(), Options{AircraftDB: func(string) (AircraftInfo, bool) {
+		return AircraftInfo{Registration: "N123AB", Type: "B738", Operator: "Caf\xe9 Air"}, true
+	}})
+	// would panic in MustNewConstMetric unsanitized
+	if err := c.UpdateAircraftsFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+	expected := `
+# HELP adsb_aircraft_db_info Registration, ICAO type and operator of the aircraft from AIRCRAFT_DB_PATH (always 1; absent when not in the database)
+# TYPE adsb_aircraft_db_info gauge
+adsb_aircraft_db_info{hex="abc123",operator="Caf Air",registration="N123AB",type="B738"} 1
+`
+	if err := testutil.CollectAndCompare(c.aircraft, strings.NewReader(expected), "adsb_aircraft_db_info"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAircraftDBInfo(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aircraft.json")
+	data := `{"now": 1700000010, "aircraft": [
+		{"hex": "abc123", "flight": "SWA123"},
+		{"hex": "abc123", "flight": "SWA124"},
+		{"hex": "~def456"},
+		{"hex": "fedcba"}]}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var looked []string
+	c := New(prometheus.NewRegistry(), Options{AircraftDB: func(hex string) (AircraftInfo, bool) {
+		looked = append(looked, hex)
+		if hex == "abc123" || hex == "def456" {
+			return AircraftInfo{Registration: "N123AB", Type: "B738", Operator: "Southwest Airlines"}, true
+		}
+		return AircraftInfo{}, false
+	}})
+	if err := c.UpdateAircraftsFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+	expected := `
+# HELP adsb_aircraft_db_info Registration, ICAO type and operator of the aircraft from AIRCRAFT_DB_PATH (always 1; absent when not in the database)
+# TYPE adsb_aircraft_db_info gauge
+adsb_aircraft_db_info{hex="abc123",operator="Southwest Airlines",registration="N123AB",type="B738"} 1
+`
+	if err := testutil.CollectAndCompare(c.aircraft, strings.NewReader(expected), "adsb_aircraft_db_info"); err != nil {
+		t.Error(err)
+	}
+	if want := []string{"abc123", "abc123", "fedcba"}; !slices.Equal(looked, want) {
+		t.Errorf("looked up %q, want %q (no non-ICAO addresses)", looked, want)
+	}
+}
@@ -0,0 +1,57 @@
+package collector
+
+import (
+	"slices"
+	"strconv"
+)
+
+// DefaultAltitudeBands are the upper bounds, in feet, used when
+// Options.AltitudeBands is empty.
+var DefaultAltitudeBands = []float64{10000, 20000, 30000, 40000}
+
+// DefaultDistanceBands are the upper bounds, in km, used when
+// Options.DistanceBands is empty.
+var DefaultDistanceBands = []float64{50, 100, 150, 200}
+
+// bands splits values into the ranges between ascending upper bounds, plus
+// one open range above the last. Labels read "0-10000", ..., "40000+".
+type bands struct {
+	bounds []float64
+	labels []string
+}
+
+func newBands(bounds []float64) bands {
+	b := bands{bounds: bounds, labels: make([]string, 0, len(bounds)+1)}
+	lo := "0"
+	for _, hi := range bounds {
+		s := strconv.FormatFloat(hi, 'f', -1, 64)
+		b.labels = append(b.labels, lo+"-"+s)
+		lo = s
+	}
+	b.labels = append(b.labels, lo+"+")
+	return b
+}
+
+// index returns the band v falls in; each band includes its lower bound and
+// the first also takes anything below zero.
+func (b bands) index(v float64) int {
+	i, found := slices.BinarySearch(b.bounds, v)
+	if found {
+		i++
+	}
+	return i
+}
+
+// ValidBands reports whether bounds can be used as band upper bounds: at
+// least one, all positive and strictly ascending.
+func ValidBands(bounds []float64) bool {
+	if len(bounds) == 0 || bounds[0] <= 0 {
+		return false
+	}
+	for i := 1; i < len(bounds); i++ {
+		if bounds[i] <= bounds[i-1] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,137 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestBands(t *testing.T) {
+	b := newBands([]float64{10000, 20000, 35000})
+	if want := []string{"0-10000", "10000-20000", "20000-35000", "35000+"}; !slices.Equal(b.labels, want) {
+		t.Errorf("labels = %q, want %q", b.labels, want)
+	}
+	for _, tt := range []struct {
+		v    float64
+		want int
+	}{
+		{-500, 0},
+		{0, 0},
+		{9999, 0},
+		{10000, 1},
+		{34999, 2},
+		{35000, 3},
+		{60000, 3},
+	} {
+		if got := b.index(tt.v); got != tt.want {
+			t.Errorf("index(%v) = %d, want %d", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestValidBands(t *testing.T) {
+	for _, tt := range []struct {
+		bounds []float64
+		want   bool
+	}{
+		{DefaultAltitudeBands, true},
+		{[]float64{5}, true},
+		{nil, false},
+		{[]float64{0, 10}, false},
+		{[]float64{10, 10}, false},
+		{[]float64{20, 10}, false},
+	} {
+		if got := ValidBands(tt.bounds); got != tt.want {
+			t.Errorf("ValidBands(%v) = %v, want %v", tt.bounds, got, tt.want)
+		}
+	}
+}
+
+func TestAltitudeBandCounts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aircraft.json")
+	data := `{"now": 1700000010, "aircraft": [
+		{"hex": "aaaaaa", "alt_baro": 3000},
+		{"hex": "bbbbbb", "alt_baro": 10000},
+		{"hex": "cccccc", "alt_baro": 41000},
+		{"hex": "dddddd", "alt_baro": "ground"},
+		{"hex": "eeeeee"},
+		{"hex": "ffffff", "alt_baro": 99000}
+	]}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := New(prometheus.NewRegistry(), Options{AltitudeBands: []float64{10000, 40000}})
+	if err := c.UpdateAircraftsFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+	// the out-of-range altitude is discarded and so unknown
+	expected := `
+# HELP adsb_aircraft_count_by_altitude_band Number of current aircraft per barometric altitude band (feet)
+# TYPE adsb_aircraft_count_by_altitude_band gauge
+adsb_aircraft_count_by_altitude_band{band="0-10000"} 1
+adsb_aircraft_count_by_altitude_band{band="10000-40000"} 1
+adsb_aircraft_count_by_altitude_band{band="40000+"} 1
+adsb_aircraft_count_by_altitude_band{band="ground"} 1
+adsb_aircraft_count_by_altitude_band{band="unknown"} 2
+`
+	if err := testutil.CollectAndCompare(c.aircraft, strings.NewReader(expected), "adsb_aircraft_count_by_altitude_band"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDistanceBandCounts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aircraft.json")
+	// about 11, 111 and 556 km north of the receiver
+	data := `{"now": 1700000010, "aircraft": [
+		{"hex": "aaaaaa", "lat": 0.1, "lon": 0, "seen_pos": 1},
+		{"hex": "bbbbbb", "lat": 1, "lon": 0},
+		{"hex": "cccccc", "lat": 5, "lon": 0, "seen_pos": 0.5},
+		{"hex": "dddddd", "lat": 0.1, "lon": 0, "seen_pos": 120},
+		{"hex": "eeeeee", "lat": 1, "lon": 0, "mlat": ["lat", "lon"]},
+		{"hex": "ffffff"}
+	]}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		opts     Options
+		expected string
+	}{
+		{"no receiver", Options{}, ""},
+		{"defaults", Options{Receiver: &Position{}}, `
+# HELP adsb_aircraft_count_by_distance_band Number of current aircraft per distance band (km) from the receiver
+# TYPE adsb_aircraft_count_by_distance_band gauge
+adsb_aircraft_count_by_distance_band{band="0-50"} 1
+adsb_aircraft_count_by_distance_band{band="50-100"} 0
+adsb_aircraft_count_by_distance_band{band="100-150"} 2
+adsb_aircraft_count_by_distance_band{band="150-200"} 0
+adsb_aircraft_count_by_distance_band{band="200+"} 1
+adsb_aircraft_count_by_distance_band{band="unknown"} 2
+`},
+		{"without mlat", Options{Receiver: &Position{}, DistanceBands: []float64{200}, ExcludeMLATDistance: true}, `
+# HELP adsb_aircraft_count_by_distance_band Number of current aircraft per distance band (km) from the receiver
+# TYPE adsb_aircraft_count_by_distance_band gauge
+adsb_aircraft_count_by_distance_band{band="0-200"} 2
+adsb_aircraft_count_by_distance_band{band="200+"} 1
+adsb_aircraft_count_by_distance_band{band="unknown"} 3
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(prometheus.NewRegistry(), tt.opts)
+			if err := c.UpdateAircraftsFromFile(path); err != nil {
+				t.Fatal(err)
+			}
+			if err := testutil.CollectAndCompare(c.aircraft, strings.NewReader(tt.expected), "adsb_aircraft_count_by_distance_band"); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package collector
+
+// categoryDescriptions maps ADS-B emitter category codes (DO-260B) to short
+// human readable names.
+var categoryDescriptions = map[string]string{
+	"A0": "No information",
+	"A1": "Light",
+	"A2": "Small",
+	"A3": "Large",
+	"A4": "High vortex large",
+	"A5": "Heavy",
+	"A6": "High performance",
+	"A7": "Rotorcraft",
+	"B0": "No information",
+	"B1": "Glider",
+	"B2": "Lighter than air",
+	"B3": "Parachutist",
+	"B4": "Ultralight",
+	"B5": "Reserved",
+	"B6": "UAV",
+	"B7": "Space vehicle",
+	"C0": "No information",
+	"C1": "Emergency vehicle",
+	"C2": "Service vehicle",
+	"C3": "Point obstacle",
+	"C4": "Cluster obstacle",
+	"C5": "Line obstacle",
+}
+
+// categoryDescription returns the human readable name of an emitter category
+// code, or "Unknown" for unset and unrecognised codes.
+func categoryDescription(code string) string {
+	if d, ok := categoryDescriptions[code]; ok {
+		return d
+	}
+	return "Unknown"
+}
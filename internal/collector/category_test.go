@@ -0,0 +1,24 @@
+package collector
+
+import "testing"
+
+func TestCategoryDescription(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{"A1", "Light"},
+		{"A5", "Heavy"},
+		{"A7", "Rotorcraft"},
+		{"B1", "Glider"},
+		{"C1", "Emergency vehicle"},
+		{"", "Unknown"},
+		{"unknown", "Unknown"},
+		{"D9", "Unknown"},
+	}
+	for _, tt := range tests {
+		if got := categoryDescription(tt.code); got != tt.want {
+			t.Errorf("categoryDescription(%q) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+}
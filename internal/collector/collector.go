@@ -0,0 +1,377 @@
+// Package collector turns readsb/dump1090 stats.json and aircraft.json files
+// into Prometheus metrics.
+package collector
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// SourceMeta describes where a parsed view came from.
+type SourceMeta struct {
+	Source    string    `json:"source"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// Speed units accepted in Options.SpeedUnit.
+const (
+	SpeedUnitKts = "kts"
+	SpeedUnitKmh = "kmh"
+)
+
+// Altitude units accepted in Options.AltUnit.
+const (
+	AltUnitFeet   = "feet"
+	AltUnitMeters = "meters"
+	AltUnitBoth   = "both"
+)
+
+// StatsPeriods lists the stats.json periods, in file order.
+var StatsPeriods = []string{"latest", "last1min", "last5min", "last15min", "total"}
+
+// Options tunes what the Collector exports. The zero value keeps the
+// historical behaviour.
+type Options struct {
+	// SpeedUnit "kmh" additionally exports speeds in km/h. Knots are always
+	// exported.
+	SpeedUnit string
+	// AltUnit selects feet (the default), meters or both for altitudes.
+	AltUnit string
+	// NoSanityBounds turns off the range checks on aircraft fields (see
+	// fieldBounds). NaN and ±Inf are always discarded.
+	NoSanityBounds bool
+	// StatsPeriods limits which of StatsPeriods are exported; empty means
+	// all of them.
+	StatsPeriods []string
+	// MessagesByDFNonZeroOnly leaves out the messages_by_df entries that are
+	// zero, usually most of them on a small receiver.
+	MessagesByDFNonZeroOnly bool
+	// MaxAircraft caps the aircraft exported as per-aircraft series; zero
+	// means no limit. The parsed view keeps every aircraft.
+	MaxAircraft int
+	// LimitBy ranks aircraft for MaxAircraft: LimitByRSSI (the default,
+	// strongest first), LimitByDistance (nearest first, needs Receiver) or
+	// LimitBySeen (most recently heard first).
+	LimitBy string
+	// Receiver is the station's position, if known.
+	Receiver *Position
+	// IncludeCategories, if set, keeps only aircraft whose emitter category
+	// matches one of the codes; ExcludeCategories drops those matching one.
+	// A code ending in "*" matches by prefix, e.g. "C*" for all surface
+	// vehicles and obstacles. Filtered aircraft are left out of every
+	// aircraft metric except adsb_aircraft_unfiltered_count.
+	IncludeCategories []string
+	ExcludeCategories []string
+	// ExcludeEmptyCategory drops aircraft that report no category (many
+	// Mode S only targets). The category lists don't apply to them.
+	ExcludeEmptyCategory bool
+	// AltitudeBands are the ascending upper bounds, in feet, of the bands
+	// of adsb_aircraft_count_by_altitude_band; empty means
+	// DefaultAltitudeBands. See ValidBands.
+	AltitudeBands []float64
+	// GeohashPrecision is the geohash length of the cells counted by
+	// adsb_aircraft_geohash_count, 1 to 12; anything else means
+	// DefaultGeohashPrecision.
+	GeohashPrecision int
+	// DistanceBands are the ascending upper bounds, in km, of the bands of
+	// adsb_aircraft_count_by_distance_band, which is only exported with
+	// Receiver set; empty means DefaultDistanceBands.
+	DistanceBands []float64
+	// MaxPositionAge is how old, in seconds, a position (seen_pos) may be
+	// for distance metrics; older ones count as unknown. Zero means
+	// DefaultMaxPositionAge.
+	MaxPositionAge float64
+	// ExcludeMLATDistance leaves MLAT positions, which are often far off at
+	// long range, out of the distance metrics.
+	ExcludeMLATDistance bool
+	// RangeSector is the width, in degrees, of the bearing sectors of
+	// adsb_receiver_range_by_bearing_km (with Receiver set); it must divide
+	// 360, anything else means DefaultRangeSector.
+	RangeSector int
+	// RangePersistent exports the longest range seen in each sector since
+	// start instead of that of the current aircraft, so quiet sectors keep
+	// their value.
+	RangePersistent bool
+	// ClosestAircraftHex adds adsb_receiver_closest_aircraft_info, which
+	// names the closest aircraft in a hex label that changes as often as
+	// the aircraft does.
+	ClosestAircraftHex bool
+	// OverheadRadius, in km, enables adsb_receiver_aircraft_overhead and its
+	// events counter (with Receiver set): aircraft within that distance and
+	// at or below OverheadMaxAltitude, in feet, count as overhead. Aircraft
+	// on the ground do; with OverheadMaxAltitude zero any altitude does.
+	OverheadRadius      float64
+	OverheadMaxAltitude float64
+	// RSSIHistogram adds adsb_aircraft_rssi_distribution, a histogram of
+	// the current aircraft's RSSI rebuilt on every refresh.
+	RSSIHistogram bool
+	// MagneticDeclination, in degrees east of true north, converts
+	// mag_heading to a true heading for the wind estimate when an aircraft
+	// reports no true_heading.
+	MagneticDeclination float64
+	// EmptyAircraftGrace is how many aircraft.json files in a row with no
+	// aircraft at all, as a restarting receiver briefly writes, are ignored
+	// after one that had some. The last aircraft stay published meanwhile;
+	// zero applies an empty file at once.
+	EmptyAircraftGrace int
+	// DeleteGrace is how many aircraft.json files in a row an aircraft may
+	// be missing from before its per-aircraft series are deleted; they keep
+	// their last values meanwhile. Zero deletes them at once.
+	DeleteGrace int
+	// SessionGap is how long, in seconds, an aircraft may be missing from
+	// aircraft.json before adsb_aircraft_session_seconds starts over; zero
+	// means DefaultSessionGap.
+	SessionGap float64
+	// StatsStaleAfter is how long, in seconds, the total period's end in
+	// stats.json may stand still before adsb_stats_fresh drops to 0; zero
+	// means DefaultStatsStaleAfter.
+	StatsStaleAfter float64
+	// TurnDeadband is the roll, in degrees either way, below which
+	// adsb_aircraft_turning counts an aircraft as flying straight; zero
+	// means DefaultTurnDeadband.
+	TurnDeadband float64
+	// AircraftDB, if set, looks aircraft up for adsb_aircraft_db_info.
+	// Non-ICAO addresses are never looked up.
+	AircraftDB func(hex string) (AircraftInfo, bool)
+}
+
+// AircraftInfo is what an aircraft database knows about an ICAO address.
+type AircraftInfo struct {
+	Registration string
+	Type         string
+	Operator     string
+}
+
+// DefaultStatsStaleAfter allows for readsb writing stats.json once a minute
+// and a missed write or two.
+const DefaultStatsStaleAfter = 150
+
+// DefaultTurnDeadband leaves out the roll of an aircraft trimming its
+// heading or riding turbulence.
+const DefaultTurnDeadband = 2
+
+// Collector owns the exporter's metrics and the state needed to update them
+// between refreshes.
+type Collector struct {
+	opts     Options
+	stats    *statsMetrics
+	aircraft *aircraftMetrics
+	receiver *receiverMetrics
+	altBands bands
+	// only used with opts.Receiver set
+	distBands bands
+	// range sector labels, "000-010" and so on
+	rangeSectors []string
+	// longest range per sector since start, with opts.RangePersistent and
+	// a receiver; guarded by applyMu
+	maxRanges []float64
+
+	// readMu guards aircraftBuf, the read buffer reused by
+	// UpdateAircraftsFromFile.
+	readMu      sync.Mutex
+	aircraftBuf bytes.Buffer
+
+	// applyMu is held for writing while a parsed file is applied to the
+	// metrics, and for reading by Gatherer, so the two sources can be
+	// reloaded concurrently without a gather seeing half an update.
+	applyMu sync.RWMutex
+
+	// state of the last aircraft pass, reused by the next; guarded by
+	// applyMu
+	update aircraftUpdate
+	// df labels of messages_by_df set on the previous pass, per period;
+	// guarded by applyMu
+	prevDFLabels labelSets
+	// kind labels of adsb_stats_tracks set on the previous pass, per period;
+	// guarded by applyMu
+	prevTrackKinds labelSets
+	// errors labels of the accepted_by_errors metrics, per period; guarded
+	// by applyMu
+	prevLocalAccepted  labelSets
+	prevRemoteAccepted labelSets
+	// last aircraft.json messages value added to fileMessages, guarded by
+	// applyMu
+	prevFileMessages int
+	// hex of each aircraft overhead after the last aircraft pass, and how
+	// many times one has come overhead; guarded by applyMu
+	overhead       map[string]struct{}
+	overheadEvents int
+	// hex of each aircraft reporting a resolution advisory after the last
+	// aircraft pass; guarded by applyMu
+	acasRA map[string]struct{}
+	// empty aircraft files ignored in a row under opts.EmptyAircraftGrace;
+	// guarded by applyMu
+	emptyAircraft int
+	// hexes of the last aircraft pass, nil before the first; guarded by
+	// applyMu
+	prevHexes map[string]struct{}
+	// message samples of the last aircraft pass by hex; guarded by applyMu
+	prevMessages map[string]messageSample
+	// passes in a row each aircraft kept under opts.DeleteGrace has been
+	// missing for; guarded by applyMu
+	absentAircraft map[aircraftKey]int
+	// current session of each aircraft by hex; guarded by applyMu
+	sessions map[string]session
+	// total period messages of the last stats.json, -1 before the first;
+	// guarded by applyMu
+	prevTotalMessages int
+	// last total period positions added to adsb_stats_positions_decoded_total;
+	// guarded by applyMu
+	prevTotalPositions int64
+	// largest total period end seen, guarded by applyMu, and when it last
+	// grew (UnixNano, zero before then), read by adsb_stats_fresh
+	prevTotalEnd     float64
+	totalEndAdvanced atomic.Int64
+	// now is time.Now, swapped in tests
+	now func() time.Time
+
+	// last successfully parsed files; replaced wholesale, never mutated
+	parsedMu       sync.RWMutex
+	parsedStats    *Stats
+	statsMeta      SourceMeta
+	parsedAircraft *AircraftsFile
+	aircraftMeta   SourceMeta
+}
+
+// New creates a Collector and registers its metrics with reg.
+func New(reg prometheus.Registerer, opts Options) *Collector {
+	f := promauto.With(reg)
+	if len(opts.AltitudeBands) == 0 {
+		opts.AltitudeBands = DefaultAltitudeBands
+	}
+	if len(opts.DistanceBands) == 0 {
+		opts.DistanceBands = DefaultDistanceBands
+	}
+	if opts.MaxPositionAge <= 0 {
+		opts.MaxPositionAge = DefaultMaxPositionAge
+	}
+	if opts.RangeSector <= 0 || 360%opts.RangeSector != 0 {
+		opts.RangeSector = DefaultRangeSector
+	}
+	if opts.SessionGap <= 0 {
+		opts.SessionGap = DefaultSessionGap
+	}
+	if opts.StatsStaleAfter <= 0 {
+		opts.StatsStaleAfter = DefaultStatsStaleAfter
+	}
+	if opts.TurnDeadband <= 0 {
+		opts.TurnDeadband = DefaultTurnDeadband
+	}
+	if opts.GeohashPrecision < 1 || opts.GeohashPrecision > 12 {
+		opts.GeohashPrecision = DefaultGeohashPrecision
+	}
+	c := &Collector{
+		opts:               opts,
+		aircraft:           newAircraftMetrics(f),
+		receiver:           newReceiverMetrics(f),
+		prevDFLabels:       labelSets{},
+		prevTrackKinds:     labelSets{},
+		prevLocalAccepted:  labelSets{},
+		prevRemoteAccepted: labelSets{},
+		prevTotalMessages:  -1,
+		overhead:           map[string]struct{}{},
+		acasRA:             map[string]struct{}{},
+		prevMessages:       map[string]messageSample{},
+		sessions:           map[string]session{},
+		absentAircraft:     map[aircraftKey]int{},
+		altBands:           newBands(opts.AltitudeBands),
+		distBands:          newBands(opts.DistanceBands),
+		rangeSectors:       rangeSectorLabels(opts.RangeSector),
+		now:                time.Now,
+	}
+	c.stats = newStatsMetrics(f, c.statsFresh)
+	if opts.RangePersistent && opts.Receiver != nil {
+		c.maxRanges = make([]float64, len(c.rangeSectors))
+	}
+	if reg != nil {
+		reg.MustRegister(c.aircraft, c.stats.adaptiveGainDistribution)
+	}
+	return c
+}
+
+// Gatherer wraps g so that gathering waits for any update being applied and
+// never interleaves with one.
+func (c *Collector) Gatherer(g prometheus.Gatherer) prometheus.Gatherer {
+	return prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+		c.applyMu.RLock()
+		defer c.applyMu.RUnlock()
+		return g.Gather()
+	})
+}
+
+// lockApply takes applyMu for writing, unless ctx is done by then: a caller
+// that gave up on an update, as the refresher does on a read timeout, may
+// since have cleared or replaced what it would apply.
+func (c *Collector) lockApply(ctx context.Context) error {
+	c.applyMu.Lock()
+	if err := ctx.Err(); err != nil {
+		c.applyMu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// ParsedStats returns the last successfully parsed stats.json, or nil if none
+// has been loaded yet.
+func (c *Collector) ParsedStats() (*Stats, SourceMeta) {
+	c.parsedMu.RLock()
+	defer c.parsedMu.RUnlock()
+	return c.parsedStats, c.statsMeta
+}
+
+// ParsedAircraft returns the last successfully parsed aircraft.json, or nil if
+// none has been loaded yet.
+func (c *Collector) ParsedAircraft() (*AircraftsFile, SourceMeta) {
+	c.parsedMu.RLock()
+	defer c.parsedMu.RUnlock()
+	return c.parsedAircraft, c.aircraftMeta
+}
+
+func (c *Collector) storeParsedStats(path string, s *Stats) {
+	c.parsedMu.Lock()
+	defer c.parsedMu.Unlock()
+	c.parsedStats = s
+	c.statsMeta = SourceMeta{Source: path, FetchedAt: time.Now()}
+}
+
+func (c *Collector) storeParsedAircraft(path string, a *AircraftsFile) {
+	c.parsedMu.Lock()
+	defer c.parsedMu.Unlock()
+	c.parsedAircraft = a
+	c.aircraftMeta = SourceMeta{Source: path, FetchedAt: time.Now()}
+}
+
+// labelSets remembers, per period, which values of an extra label were set on
+// the previous pass.
+type labelSets map[string]map[string]struct{}
+
+// replace records cur as the values set for period and returns the ones that
+// were set last time but not now.
+func (s labelSets) replace(period string, cur map[string]struct{}) []string {
+	var stale []string
+	for v := range s[period] {
+		if _, ok := cur[v]; !ok {
+			stale = append(stale, v)
+		}
+	}
+	s[period] = cur
+	return stale
+}
+
+func safeReadFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
@@ -0,0 +1,69 @@
+package collector
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// TestConcurrentUpdates reloads both files and gathers from separate
+// goroutines; run with -race.
+func TestConcurrentUpdates(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	c := New(reg, Options{})
+	g := c.Gatherer(reg)
+
+	var wg sync.WaitGroup
+	run := func(fn func(i int) error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				if err := fn(i); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	run(func(int) error { return c.UpdateStatsFromFile("testdata/stats.json") })
+	run(func(i int) error {
+		if i%2 == 0 {
+			return c.UpdateAircraftsFromFile("testdata/aircraft.json")
+		}
+		return c.UpdateAircraftsFromFile("testdata/aircraft_next.json")
+	})
+	run(func(int) error {
+		_, err := g.Gather()
+		return err
+	})
+	wg.Wait()
+}
+
+func TestClearAndRepopulate(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	c := New(reg, Options{})
+	if err := c.UpdateStatsFromFile("testdata/stats.json"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.UpdateAircraftsFromFile("testdata/aircraft.json"); err != nil {
+		t.Fatal(err)
+	}
+
+	c.ClearStats()
+	c.ClearAircraft()
+	for _, v := range []prometheus.Collector{c.stats.messages, c.aircraft} {
+		if n := testutil.CollectAndCount(v); n != 0 {
+			t.Errorf("%d series left after clear", n)
+		}
+	}
+
+	if err := c.UpdateAircraftsFromFile("testdata/aircraft.json"); err != nil {
+		t.Fatal(err)
+	}
+	if n := testutil.CollectAndCount(c.aircraft, "adsb_aircraft_alt_baro_feet"); n != 1 {
+		t.Errorf("alt_baro series after repopulate = %d, want 1", n)
+	}
+}
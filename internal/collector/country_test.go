@@ -0,0 +1,80 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCountry(t *testing.T) {
+	tests := []struct {
+		hex, want string
+	}{
+		// first and last address of a few blocks, and either side
+		{"a00000", "United States"},
+		{"afffff", "United States"},
+		{"9fffff", Unassigned},
+		{"b00000", Unassigned},
+		{"3c0000", "Germany"},
+		{"3fffff", "Germany"},
+		{"400000", "United Kingdom"},
+		{"4c8000", "Cyprus"},
+		{"4c83ff", "Cyprus"},
+		{"4c8400", Unassigned},
+		{"004000", "Zimbabwe"},
+		{"003fff", Unassigned},
+		{"e94fff", "Bolivia"},
+		{"ffffff", Unassigned},
+		{"~a00001", Unassigned},
+		{"", Unassigned},
+		{"zzzzzz", Unassigned},
+		{"1000000", Unassigned},
+	}
+	for _, tt := range tests {
+		if got := Country(tt.hex); got != tt.want {
+			t.Errorf("Country(%q) = %q, want %q", tt.hex, got, tt.want)
+		}
+	}
+}
+
+func TestICAORangesOrdered(t *testing.T) {
+	for i, r := range icaoRanges {
+		if r.first > r.last {
+			t.Errorf("%s: %06x after %06x", r.country, r.first, r.last)
+		}
+		if i > 0 && r.first <= icaoRanges[i-1].last {
+			t.Errorf("%s overlaps or comes before %s", r.country, icaoRanges[i-1].country)
+		}
+	}
+}
+
+func TestCountByCountry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aircraft.json")
+	data := `{"now": 1700000010, "aircraft": [
+		{"hex": "A1B2C3"},
+		{"hex": "ad0001"},
+		{"hex": "400f01"},
+		{"hex": "~a00002"},
+		{"hex": "f00001"}]}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := New(prometheus.NewRegistry(), Options{})
+	if err := c.UpdateAircraftsFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+	expected := `
+# HELP adsb_aircraft_count_by_country Number of current aircraft per state of registration, from the ICAO address allocation; unassigned for non-ICAO addresses and unallocated blocks
+# TYPE adsb_aircraft_count_by_country gauge
+adsb_aircraft_count_by_country{country="United Kingdom"} 1
+adsb_aircraft_count_by_country{country="United States"} 2
+adsb_aircraft_count_by_country{country="unassigned"} 2
+`
+	if err := testutil.CollectAndCompare(c.aircraft, strings.NewReader(expected), "adsb_aircraft_count_by_country"); err != nil {
+		t.Error(err)
+	}
+}
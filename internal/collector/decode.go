@@ -0,0 +1,137 @@
+package collector
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// readAircraftFile reads path into c.aircraftBuf, reusing its storage, and
+// returns the contents, gunzipped if path ends in .gz. The result is only
+// valid until the next call; callers hold c.readMu.
+func (c *Collector) readAircraftFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	c.aircraftBuf.Reset()
+	if _, err := c.aircraftBuf.ReadFrom(r); err != nil {
+		return nil, err
+	}
+	return c.aircraftBuf.Bytes(), nil
+}
+
+// mergeAircraftFiles decodes each of paths and merges their aircraft by hex.
+// Of the entries for one aircraft the most recently heard (lowest seen) is
+// kept, or the one from the later file if they tie or either lacks seen.
+// The result's now is the latest of the files' and its messages their sum.
+func (c *Collector) mergeAircraftFiles(paths []string) (*AircraftsFile, error) {
+	merged := &AircraftsFile{}
+	index := map[string]int{}
+	for _, path := range paths {
+		b, err := c.readAircraftFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var a AircraftsFile
+		if err := decodeAircraftsFile(b, &a, func(*Aircraft) {}); err != nil {
+			return nil, fmt.Errorf("unmarshal aircrafts %s: %w", path, err)
+		}
+		merged.Now = max(merged.Now, a.Now)
+		merged.Messages += a.Messages
+		for _, ac := range a.Aircraft {
+			hex := NormalizeHex(ac.Hex)
+			i, ok := index[hex]
+			switch {
+			case !ok:
+				// entries without a hex are kept for applyAircraft to count
+				if hex != "" {
+					index[hex] = len(merged.Aircraft)
+				}
+				merged.Aircraft = append(merged.Aircraft, ac)
+			case ac.Seen == nil || merged.Aircraft[i].Seen == nil || *ac.Seen <= *merged.Aircraft[i].Seen:
+				merged.Aircraft[i] = ac
+			}
+		}
+	}
+	return merged, nil
+}
+
+// decodeAircraftsFile decodes the aircraft.json document b into a, calling
+// fn with each aircraft entry as soon as it has been decoded. Unknown
+// top-level keys are skipped.
+func decodeAircraftsFile(b []byte, a *AircraftsFile, fn func(*Aircraft)) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+	for dec.More() {
+		t, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		var skip json.RawMessage
+		switch t {
+		case "now":
+			err = dec.Decode(&a.Now)
+		case "messages":
+			err = dec.Decode(&a.Messages)
+		case "aircraft":
+			err = decodeAircraftList(dec, a, fn)
+		default:
+			err = dec.Decode(&skip)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return expectDelim(dec, '}')
+}
+
+func decodeAircraftList(dec *json.Decoder, a *AircraftsFile, fn func(*Aircraft)) error {
+	t, err := dec.Token()
+	if err != nil || t == nil { // null
+		return err
+	}
+	if t != json.Delim('[') {
+		return fmt.Errorf("aircraft: expected array, got %v", t)
+	}
+	for dec.More() {
+		// the API, the history/CSV sinks and MaxAircraft ranking read the
+		// retained entries, so each is decoded in place into the slice,
+		// which the caller sizes from the last pass, rather than copied in
+		a.Aircraft = append(a.Aircraft, Aircraft{})
+		ac := &a.Aircraft[len(a.Aircraft)-1]
+		if err := dec.Decode(ac); err != nil {
+			a.Aircraft = a.Aircraft[:len(a.Aircraft)-1]
+			return err
+		}
+		fn(ac)
+	}
+	return expectDelim(dec, ']')
+}
+
+func expectDelim(dec *json.Decoder, d json.Delim) error {
+	t, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if t != d {
+		return fmt.Errorf("expected %v, got %v", d, t)
+	}
+	return nil
+}
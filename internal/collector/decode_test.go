@@ -0,0 +1,36 @@
+package collector
+
+import "testing"
+
+func TestDecodeAircraftsFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		in       string
+		aircraft int
+		wantErr  bool
+	}{
+		{"entries", `{"now": 1, "messages": 2, "aircraft": [{"hex": "a"}, {"hex": "b"}]}`, 2, false},
+		{"aircraft first", `{"aircraft": [{"hex": "a"}], "now": 1, "messages": 2}`, 1, false},
+		{"unknown keys", `{"now": 1, "messages": 2, "extra": {"x": [1, 2]}, "aircraft": []}`, 0, false},
+		{"null aircraft", `{"now": 1, "messages": 2, "aircraft": null}`, 0, false},
+		{"aircraft not an array", `{"now": 1, "aircraft": {}}`, 0, true},
+		{"wrong field type", `{"now": 1, "aircraft": [{"hex": "a"}, {"hex": "b", "gs": "fast"}]}`, 1, true},
+		{"not an object", `[]`, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var a AircraftsFile
+			var seen int
+			err := decodeAircraftsFile([]byte(tt.in), &a, func(*Aircraft) { seen++ })
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if seen != tt.aircraft || len(a.Aircraft) != tt.aircraft {
+				t.Errorf("decoded %d entries (%d retained), want %d", seen, len(a.Aircraft), tt.aircraft)
+			}
+			if !tt.wantErr && tt.aircraft > 0 && (a.Now != 1 || a.Messages != 2) {
+				t.Errorf("now, messages = %v, %v", a.Now, a.Messages)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package collector
+
+import (
+	"slices"
+	"strings"
+)
+
+// CategoryAllowed reports whether aircraft of emitter category cat, as
+// returned by NormalizeCategory, pass the Options category filters. An
+// empty category is governed by ExcludeEmptyCategory alone.
+func (c *Collector) CategoryAllowed(cat string) bool {
+	if cat == "" {
+		return !c.opts.ExcludeEmptyCategory
+	}
+	match := func(pattern string) bool { return matchCategory(pattern, cat) }
+	if len(c.opts.IncludeCategories) > 0 && !slices.ContainsFunc(c.opts.IncludeCategories, match) {
+		return false
+	}
+	return !slices.ContainsFunc(c.opts.ExcludeCategories, match)
+}
+
+// matchCategory matches an emitter category against a code such as "A5", or
+// a set prefix followed by "*" such as "C*". Both are compared ignoring case.
+func matchCategory(pattern, cat string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return len(cat) >= len(prefix) && strings.EqualFold(cat[:len(prefix)], prefix)
+	}
+	return strings.EqualFold(pattern, cat)
+}
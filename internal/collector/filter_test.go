@@ -0,0 +1,89 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMatchCategory(t *testing.T) {
+	tests := []struct {
+		pattern, cat string
+		want         bool
+	}{
+		{"A5", "A5", true},
+		{"a5", "A5", true},
+		{"A5", "A3", false},
+		{"C*", "C1", true},
+		{"c*", "C3", true},
+		{"C*", "A1", false},
+		{"*", "B2", true},
+	}
+	for _, tt := range tests {
+		if got := matchCategory(tt.pattern, tt.cat); got != tt.want {
+			t.Errorf("matchCategory(%q, %q) = %v, want %v", tt.pattern, tt.cat, got, tt.want)
+		}
+	}
+}
+
+func TestCategoryAllowed(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		cat  string
+		want bool
+	}{
+		{"no filters", Options{}, "C1", true},
+		{"excluded set", Options{ExcludeCategories: []string{"C*", "B1"}}, "C2", false},
+		{"excluded code", Options{ExcludeCategories: []string{"C*", "B1"}}, "B1", false},
+		{"not excluded", Options{ExcludeCategories: []string{"C*", "B1"}}, "A3", true},
+		{"included", Options{IncludeCategories: []string{"A5"}}, "A5", true},
+		{"not included", Options{IncludeCategories: []string{"A5"}}, "A3", false},
+		{"exclude wins", Options{IncludeCategories: []string{"A*"}, ExcludeCategories: []string{"A7"}}, "A7", false},
+		{"empty kept by default", Options{IncludeCategories: []string{"A5"}}, "", true},
+		{"empty excluded", Options{ExcludeEmptyCategory: true}, "", false},
+	}
+	for _, tt := range tests {
+		c := New(prometheus.NewRegistry(), tt.opts)
+		if got := c.CategoryAllowed(tt.cat); got != tt.want {
+			t.Errorf("%s: CategoryAllowed(%q) = %v, want %v", tt.name, tt.cat, got, tt.want)
+		}
+	}
+}
+
+func TestCategoryFilterCounts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aircraft.json")
+	data := `{"now": 1700000010, "aircraft": [
+		{"hex": "aaaaaa", "category": "A3", "alt_baro": 1000},
+		{"hex": "bbbbbb", "category": "C1"},
+		{"hex": "cccccc", "category": "C2"},
+		{"hex": "dddddd", "alt_baro": 2000}
+	]}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := New(prometheus.NewRegistry(), Options{ExcludeCategories: []string{"C*"}})
+	if err := c.UpdateAircraftsFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+	expected := `
+# HELP adsb_aircraft_category_count Number of current aircraft per emitter category (unknown when unset)
+# TYPE adsb_aircraft_category_count gauge
+adsb_aircraft_category_count{category="A3"} 1
+adsb_aircraft_category_count{category="unknown"} 1
+# HELP adsb_aircraft_unfiltered_count Aircraft with a hex address in the last aircraft.json, before category filters and MAX_AIRCRAFT
+# TYPE adsb_aircraft_unfiltered_count gauge
+adsb_aircraft_unfiltered_count 4
+`
+	if err := testutil.CollectAndCompare(c.aircraft, strings.NewReader(expected),
+		"adsb_aircraft_category_count", "adsb_aircraft_unfiltered_count"); err != nil {
+		t.Error(err)
+	}
+	if n := testutil.CollectAndCount(c.aircraft, "adsb_aircraft_messages_total"); n != 2 {
+		t.Errorf("per-aircraft series = %d, want 2", n)
+	}
+}
@@ -0,0 +1,118 @@
+package collector
+
+import (
+	"fmt"
+	"math"
+)
+
+// earthRadiusKm is the mean Earth radius used for great-circle distances.
+const earthRadiusKm = 6371.0088
+
+// Position is a point given as latitude and longitude in degrees.
+type Position struct {
+	Lat, Lon float64
+}
+
+// Distance returns the great-circle distance in km from p to the position
+// ac reports, if it reports one.
+func (p Position) Distance(ac *Aircraft) (float64, bool) {
+	if ac.Lat == nil || ac.Lon == nil {
+		return 0, false
+	}
+	return haversineKm(p.Lat, p.Lon, *ac.Lat, *ac.Lon), true
+}
+
+// DefaultMaxPositionAge is the Options.MaxPositionAge used when it is unset.
+const DefaultMaxPositionAge = 60
+
+// rangePosition returns the aircraft's position if the distance metrics may
+// use it: valid, no older than opts.MaxPositionAge and, with
+// opts.ExcludeMLATDistance, not from MLAT. A missing seen_pos counts as
+// fresh.
+func (c *Collector) rangePosition(ac *Aircraft) (Position, bool) {
+	if ac.Lat == nil || ac.Lon == nil || !c.inBounds("lat", *ac.Lat) || !c.inBounds("lon", *ac.Lon) {
+		return Position{}, false
+	}
+	if ac.SeenPos != nil && *ac.SeenPos > c.opts.MaxPositionAge {
+		return Position{}, false
+	}
+	if c.opts.ExcludeMLATDistance && PositionSource(ac) == "mlat" {
+		return Position{}, false
+	}
+	return Position{Lat: *ac.Lat, Lon: *ac.Lon}, true
+}
+
+// haversineKm returns the great-circle distance in km between two points.
+func haversineKm(lat1, lon1, lat2, lon2 float64) float64 {
+	const rad = math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// bearingDeg returns the initial great-circle bearing in degrees, [0, 360),
+// from the first point to the second.
+func bearingDeg(lat1, lon1, lat2, lon2 float64) float64 {
+	const rad = math.Pi / 180
+	dLon := (lon2 - lon1) * rad
+	y := math.Sin(dLon) * math.Cos(lat2*rad)
+	x := math.Cos(lat1*rad)*math.Sin(lat2*rad) - math.Sin(lat1*rad)*math.Cos(lat2*rad)*math.Cos(dLon)
+	return math.Mod(math.Atan2(y, x)/rad+360, 360)
+}
+
+// DefaultRangeSector is the Options.RangeSector used when it is unset or
+// invalid.
+const DefaultRangeSector = 10
+
+// rangeSectorLabels names the sectors of width degrees clockwise from north,
+// zero-padded so they sort: "000-010", ..., "350-360".
+func rangeSectorLabels(width int) []string {
+	labels := make([]string, 0, 360/width)
+	for lo := 0; lo < 360; lo += width {
+		labels = append(labels, fmt.Sprintf("%03d-%03d", lo, lo+width))
+	}
+	return labels
+}
+
+// DefaultGeohashPrecision is the geohash length used when
+// Options.GeohashPrecision is unset; about 5 km cells.
+const DefaultGeohashPrecision = 5
+
+const geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// geohashEncode returns the geohash of the point with the given number of
+// characters (1 to 12).
+func geohashEncode(lat, lon float64, precision int) string {
+	latLo, latHi := -90.0, 90.0
+	lonLo, lonHi := -180.0, 180.0
+	hash := make([]byte, precision)
+	even := true // bits alternate, starting with longitude
+	for i := range hash {
+		var ch byte
+		for range 5 {
+			ch <<= 1
+			if even {
+				mid := (lonLo + lonHi) / 2
+				if lon >= mid {
+					ch |= 1
+					lonLo = mid
+				} else {
+					lonHi = mid
+				}
+			} else {
+				mid := (latLo + latHi) / 2
+				if lat >= mid {
+					ch |= 1
+					latLo = mid
+				} else {
+					latHi = mid
+				}
+			}
+			even = !even
+		}
+		hash[i] = geohashAlphabet[ch]
+	}
+	return string(hash)
+}
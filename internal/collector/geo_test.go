@@ -0,0 +1,283 @@
+package collector
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestHaversineKm(t *testing.T) {
+	tests := []struct {
+		name                   string
+		lat1, lon1, lat2, lon2 float64
+		want                   float64
+	}{
+		{"same point", 51.47, -0.45, 51.47, -0.45, 0},
+		{"LHR to JFK", 51.47, -0.4543, 40.6413, -73.7781, 5540},
+		{"quarter meridian", 0, 0, 90, 0, 10007.5},
+		{"antipodes", 0, 0, 0, 180, 20015.1},
+	}
+	for _, tt := range tests {
+		got := haversineKm(tt.lat1, tt.lon1, tt.lat2, tt.lon2)
+		if math.Abs(got-tt.want) > 5 {
+			t.Errorf("%s: haversineKm = %.1f, want %.1f", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPositionDistance(t *testing.T) {
+	lat, lon := 51.5, -0.1
+	p := Position{Lat: 51.5, Lon: -0.1}
+	if d, ok := p.Distance(&Aircraft{Lat: &lat, Lon: &lon}); !ok || d != 0 {
+		t.Errorf("Distance = %v, %v; want 0, true", d, ok)
+	}
+	if _, ok := p.Distance(&Aircraft{Lat: &lat}); ok {
+		t.Error("Distance without lon reported ok")
+	}
+}
+
+func TestGeohashEncode(t *testing.T) {
+	tests := []struct {
+		lat, lon  float64
+		precision int
+		want      string
+	}{
+		// reference values from the original geohash.org examples
+		{57.64911, 10.40744, 11, "u4pruydqqvj"},
+		{42.6, -5.6, 5, "ezs42"},
+		{51.4700, -0.4543, 5, "gcpsv"},
+		{-33.8688, 151.2093, 6, "r3gx2f"},
+		{0, 0, 1, "s"},
+	}
+	for _, tt := range tests {
+		if got := geohashEncode(tt.lat, tt.lon, tt.precision); got != tt.want {
+			t.Errorf("geohashEncode(%v, %v, %d) = %q, want %q", tt.lat, tt.lon, tt.precision, got, tt.want)
+		}
+	}
+}
+
+func TestGeohashCounts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aircraft.json")
+	data := `{"now": 1700000010, "aircraft": [
+		{"hex": "aaaaaa", "lat": 51.4700, "lon": -0.4543},
+		{"hex": "bbbbbb", "lat": 51.4710, "lon": -0.4500},
+		{"hex": "cccccc", "lat": -33.9399, "lon": 151.1753},
+		{"hex": "dddddd", "lat": 51.4700},
+		{"hex": "eeeeee", "lat": 95, "lon": 10}
+	]}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := New(prometheus.NewRegistry(), Options{GeohashPrecision: 4})
+	if err := c.UpdateAircraftsFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+	// no longitude or an out-of-range latitude: not counted
+	expected := `
+# HELP adsb_aircraft_geohash_count Number of current aircraft with a position per geohash cell
+# TYPE adsb_aircraft_geohash_count gauge
+adsb_aircraft_geohash_count{geohash="gcps"} 2
+adsb_aircraft_geohash_count{geohash="r3gw"} 1
+`
+	if err := testutil.CollectAndCompare(c.aircraft, strings.NewReader(expected), "adsb_aircraft_geohash_count"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBearingDeg(t *testing.T) {
+	tests := []struct {
+		name                   string
+		lat1, lon1, lat2, lon2 float64
+		want                   float64
+	}{
+		{"north", 0, 0, 1, 0, 0},
+		{"east", 0, 0, 0, 1, 90},
+		{"south", 0, 0, -1, 0, 180},
+		{"west", 0, 0, 0, -1, 270},
+		{"LHR to JFK", 51.47, -0.4543, 40.6413, -73.7781, 287.9},
+	}
+	for _, tt := range tests {
+		got := bearingDeg(tt.lat1, tt.lon1, tt.lat2, tt.lon2)
+		if math.Abs(got-tt.want) > 0.1 {
+			t.Errorf("%s: bearingDeg = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRangeSectorLabels(t *testing.T) {
+	got := rangeSectorLabels(90)
+	want := []string{"000-090", "090-180", "180-270", "270-360"}
+	if !slices.Equal(got, want) {
+		t.Errorf("rangeSectorLabels(90) = %v, want %v", got, want)
+	}
+}
+
+func TestRangeByBearing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aircraft.json")
+	write := func(data string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	update := func(c *Collector) {
+		t.Helper()
+		if err := c.UpdateAircraftsFromFile(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	opts := Options{Receiver: &Position{}, RangeSector: 90}
+	instantReg, persistentReg := prometheus.NewRegistry(), prometheus.NewRegistry()
+	instant := New(instantReg, opts)
+	opts.RangePersistent = true
+	persistent := New(persistentReg, opts)
+
+	// about 111 and 223 km north and 111 km east; the stale one is ignored
+	write(`{"now": 1700000010, "aircraft": [
+		{"hex": "aaaaaa", "lat": 1, "lon": 0},
+		{"hex": "bbbbbb", "lat": 2, "lon": 0.1},
+		{"hex": "cccccc", "lat": 0, "lon": 1},
+		{"hex": "dddddd", "lat": -5, "lon": 0, "seen_pos": 300}
+	]}`)
+	update(instant)
+	update(persistent)
+	write(`{"now": 1700000015, "aircraft": [{"hex": "aaaaaa", "lat": 1, "lon": 0}]}`)
+	update(instant)
+	update(persistent)
+
+	tests := []struct {
+		name string
+		reg  *prometheus.Registry
+		want map[string]float64
+	}{
+		{"instant", instantReg, map[string]float64{"000-090": 111.2, "090-180": 0, "180-270": 0, "270-360": 0}},
+		{"persistent", persistentReg, map[string]float64{"000-090": 222.7, "090-180": 111.2, "180-270": 0, "270-360": 0}},
+	}
+	for _, tt := range tests {
+		mfs, err := tt.reg.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := map[string]float64{}
+		for _, mf := range mfs {
+			if mf.GetName() != "adsb_receiver_range_by_bearing_km" {
+				continue
+			}
+			for _, m := range mf.GetMetric() {
+				got[m.GetLabel()[0].GetValue()] = m.GetGauge().GetValue()
+			}
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got sectors %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for sector, w := range tt.want {
+			if g, ok := got[sector]; !ok || math.Abs(g-w) > 0.1 {
+				t.Errorf("%s: sector %s = %v, want %v", tt.name, sector, g, w)
+			}
+		}
+	}
+}
+
+func TestClosestAircraft(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aircraft.json")
+	write := func(data string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := New(prometheus.NewRegistry(), Options{Receiver: &Position{}, ClosestAircraftHex: true})
+	names := []string{
+		"adsb_receiver_closest_aircraft_distance_km",
+		"adsb_receiver_closest_aircraft_alt_baro_feet",
+		"adsb_receiver_closest_aircraft_ground_speed_kts",
+		"adsb_receiver_closest_aircraft_info",
+	}
+
+	// cccccc ties bbbbbb and loses on hex; dddddd's position is stale
+	write(`{"now": 1700000010, "aircraft": [
+		{"hex": "aaaaaa", "lat": 1, "lon": 0, "alt_baro": 30000, "gs": 450},
+		{"hex": "cccccc", "lat": 0, "lon": -0.5, "gs": 120},
+		{"hex": "bbbbbb", "lat": 0, "lon": 0.5, "alt_baro": 2500, "gs": 140},
+		{"hex": "dddddd", "lat": 0, "lon": 0.1, "seen_pos": 300},
+		{"hex": "eeeeee", "alt_baro": 1000}
+	]}`)
+	if err := c.UpdateAircraftsFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+	expected := `
+# HELP adsb_receiver_closest_aircraft_alt_baro_feet Barometric altitude of the closest aircraft (feet)
+# TYPE adsb_receiver_closest_aircraft_alt_baro_feet gauge
+adsb_receiver_closest_aircraft_alt_baro_feet 2500
+# HELP adsb_receiver_closest_aircraft_ground_speed_kts Ground speed of the closest aircraft (knots)
+# TYPE adsb_receiver_closest_aircraft_ground_speed_kts gauge
+adsb_receiver_closest_aircraft_ground_speed_kts 140
+# HELP adsb_receiver_closest_aircraft_info Hex address of the closest aircraft
+# TYPE adsb_receiver_closest_aircraft_info gauge
+adsb_receiver_closest_aircraft_info{hex="bbbbbb"} 1
+`
+	if err := testutil.CollectAndCompare(c.aircraft, strings.NewReader(expected), names[1:]...); err != nil {
+		t.Error(err)
+	}
+	if n := testutil.CollectAndCount(c.aircraft, names[0]); n != 1 {
+		t.Errorf("distance series = %d, want 1", n)
+	}
+
+	// nothing with a position: no series at all
+	write(`{"now": 1700000015, "aircraft": [{"hex": "eeeeee", "alt_baro": 1000}]}`)
+	if err := c.UpdateAircraftsFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if n := testutil.CollectAndCount(c.aircraft, names...); n != 0 {
+		t.Errorf("closest aircraft series without positions = %d, want 0", n)
+	}
+}
+
+func TestOverhead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aircraft.json")
+	c := New(prometheus.NewRegistry(), Options{Receiver: &Position{}, OverheadRadius: 3, OverheadMaxAltitude: 5000})
+	// 0.01° is about 1.1 km, 0.1° about 11 km
+	for i, tt := range []struct {
+		data           string
+		overhead, evts float64
+	}{
+		{`[{"hex": "aaaaaa", "lat": 0.01, "lon": 0, "alt_baro": 2000},
+		   {"hex": "bbbbbb", "lat": 0.01, "lon": 0, "alt_baro": 9000},
+		   {"hex": "cccccc", "lat": 0.1, "lon": 0, "alt_baro": 2000},
+		   {"hex": "dddddd", "lat": 0, "lon": 0.01, "alt_baro": "ground"}]`, 2, 2},
+		// aaaaaa is still overhead, bbbbbb descends into the cylinder
+		{`[{"hex": "aaaaaa", "lat": 0.005, "lon": 0, "alt_baro": 1500},
+		   {"hex": "bbbbbb", "lat": 0.01, "lon": 0, "alt_baro": 4500}]`, 2, 3},
+		{`[]`, 0, 3},
+		// aaaaaa comes back
+		{`[{"hex": "aaaaaa", "lat": 0.01, "lon": 0, "alt_baro": 2000}]`, 1, 4},
+	} {
+		data := `{"now": 1700000010, "aircraft": ` + tt.data + `}`
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.UpdateAircraftsFromFile(path); err != nil {
+			t.Fatal(err)
+		}
+		expected := fmt.Sprintf(`
+# HELP adsb_receiver_aircraft_overhead Number of aircraft currently within the configured overhead radius and altitude
+# TYPE adsb_receiver_aircraft_overhead gauge
+adsb_receiver_aircraft_overhead %v
+# HELP adsb_receiver_aircraft_overhead_events_total Number of times an aircraft came within the configured overhead radius and altitude
+# TYPE adsb_receiver_aircraft_overhead_events_total counter
+adsb_receiver_aircraft_overhead_events_total %v
+`, tt.overhead, tt.evts)
+		if err := testutil.CollectAndCompare(c.aircraft, strings.NewReader(expected),
+			"adsb_receiver_aircraft_overhead", "adsb_receiver_aircraft_overhead_events_total"); err != nil {
+			t.Errorf("update %d: %v", i+1, err)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package collector
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+)
+
+// Criteria accepted in Options.LimitBy.
+const (
+	LimitByRSSI     = "rssi"
+	LimitByDistance = "distance"
+	LimitBySeen     = "seen"
+)
+
+// applyLimited applies the Options.MaxAircraft best aircraft of l, ranked
+// by Options.LimitBy, and returns how many were left out. The rest are
+// applied without series of their own, so figures over the whole fleet
+// still count them. Entries without a hex address, a bare "~" included, or
+// filtered by category are passed to applyAircraft (and so counted) without taking a place.
+func (c *Collector) applyLimited(l []Aircraft, u *aircraftUpdate) int {
+	type ranked struct {
+		ac   *Aircraft
+		hex  string
+		key  float64
+		miss bool
+	}
+	rs := make([]ranked, 0, len(l))
+	for i := range l {
+		ac := &l[i]
+		hex, ok := labelHex(ac)
+		if !ok || !c.CategoryAllowed(NormalizeCategory(ac.Category)) {
+			c.applyAircraft(ac, u, false)
+			continue
+		}
+		key, ok := c.rankKey(ac)
+		rs = append(rs, ranked{ac: ac, hex: hex, key: key, miss: !ok})
+	}
+	// aircraft missing the criterion go last; ties are broken by hex so
+	// the same file always keeps the same aircraft
+	slices.SortFunc(rs, func(a, b ranked) int {
+		if a.miss != b.miss {
+			if a.miss {
+				return 1
+			}
+			return -1
+		}
+		if c := cmp.Compare(a.key, b.key); c != 0 {
+			return c
+		}
+		return strings.Compare(a.hex, b.hex)
+	})
+	for i, r := range rs {
+		c.applyAircraft(r.ac, u, i < c.opts.MaxAircraft)
+	}
+	return max(len(rs)-c.opts.MaxAircraft, 0)
+}
+
+// rankKey returns the value aircraft are ranked on under Options.LimitBy,
+// lower being better, and whether ac has it.
+func (c *Collector) rankKey(ac *Aircraft) (float64, bool) {
+	switch c.opts.LimitBy {
+	case LimitByDistance:
+		if c.opts.Receiver != nil {
+			return c.opts.Receiver.Distance(ac)
+		}
+	case LimitBySeen:
+		if ac.Seen != nil {
+			return *ac.Seen, true
+		}
+	default:
+		if ac.RSSI != nil {
+			return -*ac.RSSI, true
+		}
+	}
+	return 0, false
+}
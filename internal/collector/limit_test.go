@@ -0,0 +1,131 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMaxAircraft(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aircraft.json")
+	// near/weak/recent, far/strong/old, middle, no position or rssi; the
+	// entries without a hex, a bare "~" among them, take no place
+	data := `{"now": 1700000010, "aircraft": [
+		{"hex": "aaaaaa", "lat": 51.51, "lon": -0.1, "rssi": -30, "seen": 0.1, "alt_baro": 1000},
+		{"hex": "bbbbbb", "lat": 53.0, "lon": -0.1, "rssi": -5, "seen": 20, "alt_baro": 2000},
+		{"hex": "cccccc", "lat": 52.0, "lon": -0.1, "rssi": -10, "seen": 5, "alt_baro": 3000},
+		{"hex": "dddddd", "seen": 0, "alt_baro": 4000},
+		{"flight": "NOHEX", "alt_baro": 5000},
+		{"hex": "~", "seen": 0, "rssi": -1}
+	]}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		by   string
+		want []string
+	}{
+		{LimitByRSSI, []string{"bbbbbb", "cccccc"}},
+		{LimitByDistance, []string{"aaaaaa", "cccccc"}},
+		{LimitBySeen, []string{"aaaaaa", "dddddd"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.by, func(t *testing.T) {
+			c := New(prometheus.NewRegistry(), Options{
+				MaxAircraft: 2,
+				LimitBy:     tt.by,
+				Receiver:    &Position{Lat: 51.5, Lon: -0.1},
+			})
+			for range 2 {
+				if err := c.UpdateAircraftsFromFile(path); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var expected strings.Builder
+			expected.WriteString(`
+# HELP adsb_aircraft_dropped_by_limit Aircraft in the last aircraft.json left out of the per-aircraft metrics by MAX_AIRCRAFT
+# TYPE adsb_aircraft_dropped_by_limit gauge
+adsb_aircraft_dropped_by_limit 2
+# HELP adsb_aircraft_messages_total Total messages received from the aircraft, a gauge; use adsb_aircraft_messages_received_total for rate()
+# TYPE adsb_aircraft_messages_total gauge
+`)
+			for _, hex := range tt.want {
+				expected.WriteString(`adsb_aircraft_messages_total{category="",flight="",hex="` + hex + `"} 0` + "\n")
+			}
+			if err := testutil.CollectAndCompare(c.aircraft, strings.NewReader(expected.String()),
+				"adsb_aircraft_dropped_by_limit", "adsb_aircraft_messages_total"); err != nil {
+				t.Error(err)
+			}
+			// the entries without a hex are still counted, not ranked
+			if got := testutil.ToFloat64(c.aircraft.noHex); got != 4 {
+				t.Errorf("no hex counter = %v, want 4", got)
+			}
+			// the parsed view is not limited
+			if a, _ := c.ParsedAircraft(); len(a.Aircraft) != 6 {
+				t.Errorf("parsed view has %d aircraft, want 6", len(a.Aircraft))
+			}
+		})
+	}
+}
+
+func TestMaxAircraftSkipsFilteredCategory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aircraft.json")
+	// the strongest aircraft is excluded, however its category is written
+	data := `{"now": 1700000010, "aircraft": [
+		{"hex": "aaaaaa", "rssi": -1, "category": " c1"},
+		{"hex": "bbbbbb", "rssi": -20}
+	]}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := New(prometheus.NewRegistry(), Options{MaxAircraft: 1, ExcludeCategories: []string{"C1"}})
+	if err := c.UpdateAircraftsFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+	expected := `
+# HELP adsb_aircraft_dropped_by_limit Aircraft in the last aircraft.json left out of the per-aircraft metrics by MAX_AIRCRAFT
+# TYPE adsb_aircraft_dropped_by_limit gauge
+adsb_aircraft_dropped_by_limit 0
+# HELP adsb_aircraft_rssi_dbfs Recent average RSSI (dBFS)
+# TYPE adsb_aircraft_rssi_dbfs gauge
+adsb_aircraft_rssi_dbfs{category="",flight="",hex="bbbbbb"} -20
+`
+	if err := testutil.CollectAndCompare(c.aircraft, strings.NewReader(expected),
+		"adsb_aircraft_dropped_by_limit", "adsb_aircraft_rssi_dbfs"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMaxAircraftKeepsFleetFigures(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aircraft.json")
+	data := `{"now": 1700000010, "aircraft": [
+		{"hex": "aaaaaa", "rssi": -1, "category": "A3", "alt_baro": 1000},
+		{"hex": "bbbbbb", "rssi": -5, "category": "A3", "alt_baro": 1000},
+		{"hex": "cccccc", "rssi": -9, "category": "A1", "alt_baro": 1000}
+	]}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := New(prometheus.NewRegistry(), Options{MaxAircraft: 1})
+	if err := c.UpdateAircraftsFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+	// only aaaaaa gets per-aircraft series, the category counts cover all three
+	expected := `
+# HELP adsb_aircraft_category_count Number of current aircraft per emitter category (unknown when unset)
+# TYPE adsb_aircraft_category_count gauge
+adsb_aircraft_category_count{category="A1"} 1
+adsb_aircraft_category_count{category="A3"} 2
+# HELP adsb_aircraft_rssi_dbfs Recent average RSSI (dBFS)
+# TYPE adsb_aircraft_rssi_dbfs gauge
+adsb_aircraft_rssi_dbfs{category="A3",flight="",hex="aaaaaa"} -1
+`
+	if err := testutil.CollectAndCompare(c.aircraft, strings.NewReader(expected),
+		"adsb_aircraft_category_count", "adsb_aircraft_rssi_dbfs"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,1100 @@
+package collector
+
+import (
+	"maps"
+	"math"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// statsMetrics holds the gauges populated from stats.json.
+type statsMetrics struct {
+	up                          prometheus.Gauge
+	totalResets                 prometheus.Counter
+	fresh                       prometheus.GaugeFunc
+	periodStart                 *prometheus.GaugeVec
+	periodEnd                   *prometheus.GaugeVec
+	messages                    *prometheus.GaugeVec
+	messagesPerSecond           *prometheus.GaugeVec
+	localAcceptedPerSecond      *prometheus.GaugeVec
+	cprPositionsPerSecond       *prometheus.GaugeVec
+	positions                   *prometheus.GaugeVec
+	positionsDecoded            prometheus.Counter
+	localModes                  *prometheus.GaugeVec
+	localBad                    *prometheus.GaugeVec
+	localAcceptRatio            *prometheus.GaugeVec
+	localBadRatio               *prometheus.GaugeVec
+	localStrongSignalRatio      *prometheus.GaugeVec
+	messagesByDF                *prometheus.GaugeVec
+	cpuDemod                    *prometheus.GaugeVec
+	cpuReader                   *prometheus.GaugeVec
+	cpuBackground               *prometheus.GaugeVec
+	cpuDemodUtilization         *prometheus.GaugeVec
+	cpuReaderUtilization        *prometheus.GaugeVec
+	cpuBackgroundUtilization    *prometheus.GaugeVec
+	localGainDB                 *prometheus.GaugeVec
+	gainDB                      *prometheus.GaugeVec
+	adaptiveGainDB              *prometheus.GaugeVec
+	adaptiveDynamicRangeLimitDB *prometheus.GaugeVec
+	adaptiveGainChanges         *prometheus.GaugeVec
+	adaptiveGainChangesPerMin   *prometheus.GaugeVec
+	adaptiveLoudUndecoded       *prometheus.GaugeVec
+	adaptiveLoudDecoded         *prometheus.GaugeVec
+	adaptiveNoiseDBFS           *prometheus.GaugeVec
+	adaptiveGainSeconds         *prometheus.GaugeVec
+	localSamplesProcessed       *prometheus.GaugeVec
+	localSamplesDropped         *prometheus.GaugeVec
+	localModeAC                 *prometheus.GaugeVec
+	localUnknownICAO            *prometheus.GaugeVec
+	localAcceptedTotal          *prometheus.GaugeVec
+	localAcceptedByErrors       *prometheus.GaugeVec
+	localAcceptedCorrectedRatio *prometheus.GaugeVec
+	localSignal                 *prometheus.GaugeVec
+	localNoise                  *prometheus.GaugeVec
+	localPeakSignal             *prometheus.GaugeVec
+	localSNR                    *prometheus.GaugeVec
+	localPeakSNR                *prometheus.GaugeVec
+	localStrongSignals          *prometheus.GaugeVec
+	remoteModeAC                *prometheus.GaugeVec
+	remoteModes                 *prometheus.GaugeVec
+	remoteBad                   *prometheus.GaugeVec
+	remoteUnknownICAO           *prometheus.GaugeVec
+	remoteAcceptedTotal         *prometheus.GaugeVec
+	remoteAcceptedByErrors      *prometheus.GaugeVec
+	remoteSignal                *prometheus.GaugeVec
+	remoteNoise                 *prometheus.GaugeVec
+	remotePeakSignal            *prometheus.GaugeVec
+	remoteStrongSignals         *prometheus.GaugeVec
+	remoteSamplesProcessed      *prometheus.GaugeVec
+	remoteSamplesDropped        *prometheus.GaugeVec
+	remoteGainDB                *prometheus.GaugeVec
+	cprSurface                  *prometheus.GaugeVec
+	cprAirborne                 *prometheus.GaugeVec
+	cprGlobalOk                 *prometheus.GaugeVec
+	cprGlobalBad                *prometheus.GaugeVec
+	cprGlobalRange              *prometheus.GaugeVec
+	cprGlobalSpeed              *prometheus.GaugeVec
+	cprGlobalSkipped            *prometheus.GaugeVec
+	cprLocalOk                  *prometheus.GaugeVec
+	cprLocalAircraftRelative    *prometheus.GaugeVec
+	cprLocalReceiverRelative    *prometheus.GaugeVec
+	cprLocalSkipped             *prometheus.GaugeVec
+	cprLocalRange               *prometheus.GaugeVec
+	cprLocalSpeed               *prometheus.GaugeVec
+	cprFiltered                 *prometheus.GaugeVec
+	cprGlobalSuccessRatio       *prometheus.GaugeVec
+	cprLocalSuccessRatio        *prometheus.GaugeVec
+	tracks                      *prometheus.GaugeVec
+	tracksAll                   *prometheus.GaugeVec
+	tracksSingleMessage         *prometheus.GaugeVec
+	tracksUnreliable            *prometheus.GaugeVec
+	altitudeSuppressed          *prometheus.GaugeVec
+	// not a promauto metric: New registers it
+	adaptiveGainDistribution *periodHistograms
+}
+
+// newStatsMetrics creates the stats gauges; fresh is evaluated on every
+// gather for adsb_stats_fresh.
+func newStatsMetrics(f promauto.Factory, fresh func() float64) *statsMetrics {
+	return &statsMetrics{
+		up: f.NewGauge(prometheus.GaugeOpts{
+			Name: "adsb_stats_up",
+			Help: "Whether the last read of stats.json succeeded (1) or failed (0)",
+		}),
+		totalResets: f.NewCounter(prometheus.CounterOpts{
+			Name: "adsb_stats_total_resets_total",
+			Help: "Times the total messages in stats.json went backwards, i.e. the receiver restarted",
+		}),
+		fresh: f.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "adsb_stats_fresh",
+			Help: "1 while the total period's end in stats.json keeps advancing, 0 once it hasn't for the stale timeout or before any stats were read",
+		}, fresh),
+		periodStart: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_period_start_seconds",
+			Help: "Unix time the stats period starts",
+		}, []string{"period"}),
+		periodEnd: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_period_end_seconds",
+			Help: "Unix time the stats period ends",
+		}, []string{"period"}),
+		messages: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_messages_total",
+			Help: "Number of messages for given stats period",
+		}, []string{"period"}),
+		messagesPerSecond: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_messages_per_second",
+			Help: "Messages per second over the stats period",
+		}, []string{"period"}),
+		localAcceptedPerSecond: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_local_accepted_per_second",
+			Help: "Accepted local messages per second over the stats period",
+		}, []string{"period"}),
+		positions: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_positions_total",
+			Help: "Positions decoded in the stats period: cpr global_ok plus local_ok",
+		}, []string{"period"}),
+		positionsDecoded: f.NewCounter(prometheus.CounterOpts{
+			Name: "adsb_stats_positions_decoded_total",
+			Help: "Positions decoded since the exporter started, from the total period of stats.json; keeps counting across readsb restarts",
+		}),
+		cprPositionsPerSecond: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_cpr_positions_per_second",
+			Help: "Positions decoded (global_ok plus local_ok) per second over the stats period",
+		}, []string{"period"}),
+		localModes: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_local_modes_total",
+			Help: "Local modes (modes) count by period",
+		}, []string{"period"}),
+		localBad: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_local_bad_total",
+			Help: "Local bad messages count by period",
+		}, []string{"period"}),
+		localAcceptRatio: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_local_accept_ratio",
+			Help: "Share of the local Mode S messages demodulated that were accepted: accepted over modes",
+		}, []string{"period"}),
+		localBadRatio: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_local_bad_ratio",
+			Help: "Share of the local Mode S messages demodulated that were bad: bad over modes",
+		}, []string{"period"}),
+		localStrongSignalRatio: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_local_strong_signal_ratio",
+			Help: "Share of the local accepted messages stronger than -3 dBFS: strong_signals over accepted",
+		}, []string{"period"}),
+		messagesByDF: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_messages_by_df",
+			Help: "Messages per DF for a given period",
+		}, []string{"period", "df"}),
+
+		// CPU metrics (milliseconds)
+		cpuDemod: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_cpu_demod_ms",
+			Help: "Milliseconds spent doing demodulation (per period)",
+		}, []string{"period"}),
+		cpuReader: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_cpu_reader_ms",
+			Help: "Milliseconds spent reading samples from SDR (per period)",
+		}, []string{"period"}),
+		cpuBackground: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_cpu_background_ms",
+			Help: "Milliseconds spent in background processing (per period)",
+		}, []string{"period"}),
+		cpuDemodUtilization: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_cpu_demod_utilization",
+			Help: "Share of one CPU core spent doing demodulation over the period (can exceed 1)",
+		}, []string{"period"}),
+		cpuReaderUtilization: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_cpu_reader_utilization",
+			Help: "Share of one CPU core spent reading samples from SDR over the period (can exceed 1)",
+		}, []string{"period"}),
+		cpuBackgroundUtilization: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_cpu_background_utilization",
+			Help: "Share of one CPU core spent in background processing over the period (can exceed 1)",
+		}, []string{"period"}),
+
+		// local gain
+		localGainDB: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_local_gain_db",
+			Help: "SDR gain reported under stats.local.gain_db (dB)",
+		}, []string{"period"}),
+
+		gainDB: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_receiver_gain_db",
+			Help: "SDR gain from stats.local.gain_db, or adaptive.gain_db when that is absent (dB)",
+		}, []string{"period"}),
+
+		// adaptive metrics
+		adaptiveGainDB: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_adaptive_gain_db",
+			Help: "Adaptive latest SDR gain (legacy; prefer local.gain_db) (dB)",
+		}, []string{"period"}),
+		adaptiveDynamicRangeLimitDB: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_adaptive_dynamic_range_limit_db",
+			Help: "Adaptive dynamic range limit (dB)",
+		}, []string{"period"}),
+		adaptiveGainChanges: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_adaptive_gain_changes_total",
+			Help: "Number of adaptive gain changes in this period",
+		}, []string{"period"}),
+		adaptiveGainChangesPerMin: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_adaptive_gain_changes_per_minute",
+			Help: "Adaptive gain changes per minute over the period; only for last1min, last5min and last15min",
+		}, []string{"period"}),
+		adaptiveLoudUndecoded: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_adaptive_loud_undecoded_total",
+			Help: "Number of loud undecoded bursts seen",
+		}, []string{"period"}),
+		adaptiveLoudDecoded: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_adaptive_loud_decoded_total",
+			Help: "Number of loud decoded messages seen",
+		}, []string{"period"}),
+		adaptiveNoiseDBFS: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_adaptive_noise_dbfs",
+			Help: "Adaptive noise floor estimate (dBFS)",
+		}, []string{"period"}),
+
+		// gain_seconds: period, gain_step, gain_db -> seconds
+		adaptiveGainSeconds: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_adaptive_gain_seconds",
+			Help: "Number of seconds spent at a given adaptive gain step",
+		}, []string{"period", "gain_step", "gain_db"}),
+		// the same as a histogram; adsb_stats_adaptive_gain_seconds is
+		// taken by the gauge above
+		adaptiveGainDistribution: &periodHistograms{
+			desc: prometheus.NewDesc("adsb_stats_adaptive_gain_distribution",
+				"Seconds spent at each adaptive gain (dB) in the period, as a histogram: le is the gain and counts are whole seconds",
+				[]string{"period"}, nil),
+			byPeriod: map[string]prometheus.Metric{},
+		},
+
+		// Stats metrics - Local stats additional fields
+		localSamplesProcessed: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_local_samples_processed_total",
+			Help: "Number of samples processed by local SDR",
+		}, []string{"period"}),
+		localSamplesDropped: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_local_samples_dropped_total",
+			Help: "Number of samples dropped by local SDR",
+		}, []string{"period"}),
+		localModeAC: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_local_modeac_total",
+			Help: "Number of Mode A/C messages decoded",
+		}, []string{"period"}),
+		localUnknownICAO: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_local_unknown_icao_total",
+			Help: "Number of messages with unknown ICAO addresses",
+		}, []string{"period"}),
+		localAcceptedTotal: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_local_accepted_total",
+			Help: "Total number of accepted messages",
+		}, []string{"period"}),
+		localAcceptedCorrectedRatio: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_local_accepted_corrected_ratio",
+			Help: "Fraction of accepted messages that needed one or more bit errors corrected",
+		}, []string{"period"}),
+		localAcceptedByErrors: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_local_accepted_by_errors",
+			Help: "Number of accepted messages by error correction bits",
+		}, []string{"period", "errors"}),
+		localSignal: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_local_signal_dbfs",
+			Help: "Mean signal power (dBFS)",
+		}, []string{"period"}),
+		localNoise: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_local_noise_dbfs",
+			Help: "Mean noise power (dBFS)",
+		}, []string{"period"}),
+		localPeakSignal: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_local_peak_signal_dbfs",
+			Help: "Peak signal power (dBFS)",
+		}, []string{"period"}),
+		localSNR: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_local_snr_db",
+			Help: "Mean signal power over mean noise power (dB)",
+		}, []string{"period"}),
+		localPeakSNR: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_local_peak_snr_db",
+			Help: "Peak signal power over mean noise power (dB)",
+		}, []string{"period"}),
+		localStrongSignals: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_local_strong_signals_total",
+			Help: "Number of messages with strong signal (above -3dBFS)",
+		}, []string{"period"}),
+
+		// Remote stats
+		remoteModeAC: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_remote_modeac_total",
+			Help: "Number of Mode A/C messages received remotely",
+		}, []string{"period"}),
+		remoteModes: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_remote_modes_total",
+			Help: "Number of Mode S messages received remotely",
+		}, []string{"period"}),
+		remoteBad: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_remote_bad_total",
+			Help: "Number of bad messages received remotely",
+		}, []string{"period"}),
+		remoteUnknownICAO: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_remote_unknown_icao_total",
+			Help: "Number of remote messages with unknown ICAO",
+		}, []string{"period"}),
+		remoteAcceptedTotal: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_remote_accepted_total",
+			Help: "Total number of accepted remote messages",
+		}, []string{"period"}),
+		remoteAcceptedByErrors: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_remote_accepted_by_errors",
+			Help: "Number of accepted remote messages by error correction bits",
+		}, []string{"period", "errors"}),
+		remoteSignal: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_remote_signal_dbfs",
+			Help: "Mean signal power of remote messages (dBFS)",
+		}, []string{"period"}),
+		remoteNoise: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_remote_noise_dbfs",
+			Help: "Mean noise power of remote messages (dBFS)",
+		}, []string{"period"}),
+		remotePeakSignal: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_remote_peak_signal_dbfs",
+			Help: "Peak signal power of remote messages (dBFS)",
+		}, []string{"period"}),
+		remoteStrongSignals: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_remote_strong_signals_total",
+			Help: "Number of remote messages with strong signal (above -3dBFS)",
+		}, []string{"period"}),
+		remoteSamplesProcessed: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_remote_samples_processed_total",
+			Help: "Number of samples processed by remote receivers",
+		}, []string{"period"}),
+		remoteSamplesDropped: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_remote_samples_dropped_total",
+			Help: "Number of samples dropped by remote receivers",
+		}, []string{"period"}),
+		remoteGainDB: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_remote_gain_db",
+			Help: "Gain reported for remote receivers (dB)",
+		}, []string{"period"}),
+
+		// CPR stats
+		cprSurface: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_cpr_surface_total",
+			Help: "Total surface CPR messages received",
+		}, []string{"period"}),
+		cprAirborne: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_cpr_airborne_total",
+			Help: "Total airborne CPR messages received",
+		}, []string{"period"}),
+		cprGlobalOk: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_cpr_global_ok_total",
+			Help: "Global positions successfully derived",
+		}, []string{"period"}),
+		cprGlobalBad: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_cpr_global_bad_total",
+			Help: "Global positions rejected (inconsistent)",
+		}, []string{"period"}),
+		cprGlobalRange: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_cpr_global_range_total",
+			Help: "Global positions rejected (exceeded max range)",
+		}, []string{"period"}),
+		cprGlobalSpeed: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_cpr_global_speed_total",
+			Help: "Global positions rejected (failed speed check)",
+		}, []string{"period"}),
+		cprGlobalSkipped: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_cpr_global_skipped_total",
+			Help: "Global position attempts skipped",
+		}, []string{"period"}),
+		cprLocalOk: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_cpr_local_ok_total",
+			Help: "Local positions successfully found",
+		}, []string{"period"}),
+		cprLocalAircraftRelative: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_cpr_local_aircraft_relative_total",
+			Help: "Local positions relative to previous aircraft position",
+		}, []string{"period"}),
+		cprLocalReceiverRelative: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_cpr_local_receiver_relative_total",
+			Help: "Local positions relative to receiver position",
+		}, []string{"period"}),
+		cprLocalSkipped: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_cpr_local_skipped_total",
+			Help: "Local position attempts skipped",
+		}, []string{"period"}),
+		cprLocalRange: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_cpr_local_range_total",
+			Help: "Local positions not used (exceeded range)",
+		}, []string{"period"}),
+		cprLocalSpeed: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_cpr_local_speed_total",
+			Help: "Local positions not used (failed speed check)",
+		}, []string{"period"}),
+		cprFiltered: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_cpr_filtered_total",
+			Help: "CPR messages filtered (faulty transponder)",
+		}, []string{"period"}),
+		cprGlobalSuccessRatio: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_cpr_global_success_ratio",
+			Help: "Share of global CPR decodes that succeeded: global_ok over global_ok, global_bad, global_range, global_speed and global_skipped",
+		}, []string{"period"}),
+		cprLocalSuccessRatio: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_cpr_local_success_ratio",
+			Help: "Share of local CPR decodes that succeeded: local_ok over local_ok, local_range, local_speed and local_skipped",
+		}, []string{"period"}),
+
+		// Tracks stats
+		tracks: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_tracks",
+			Help: "Tracks by kind, one series per key of the stats period's tracks object",
+		}, []string{"period", "kind"}),
+		tracksAll: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_tracks_all_total",
+			Help: "Total tracks created (deprecated: adsb_stats_tracks{kind=\"all\"})",
+		}, []string{"period"}),
+		tracksSingleMessage: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_tracks_single_message_total",
+			Help: "Tracks with only single message (deprecated: adsb_stats_tracks{kind=\"single_message\"})",
+		}, []string{"period"}),
+		tracksUnreliable: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_tracks_unreliable_total",
+			Help: "Tracks never marked as reliable (deprecated: adsb_stats_tracks{kind=\"unreliable\"})",
+		}, []string{"period"}),
+
+		// Altitude suppressed
+		altitudeSuppressed: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_stats_altitude_suppressed_total",
+			Help: "Number of altitude suppressed messages",
+		}, []string{"period"}),
+	}
+}
+
+// reset drops every per-period series so the families go absent until the
+// next successful update. up, fresh and the totalResets and
+// positionsDecoded counters are left alone.
+func (m *statsMetrics) reset() {
+	m.periodStart.Reset()
+	m.periodEnd.Reset()
+	m.messages.Reset()
+	m.messagesPerSecond.Reset()
+	m.localAcceptedPerSecond.Reset()
+	m.cprPositionsPerSecond.Reset()
+	m.positions.Reset()
+	m.localModes.Reset()
+	m.localBad.Reset()
+	m.localAcceptRatio.Reset()
+	m.localBadRatio.Reset()
+	m.localStrongSignalRatio.Reset()
+	m.messagesByDF.Reset()
+	m.cpuDemod.Reset()
+	m.cpuReader.Reset()
+	m.cpuBackground.Reset()
+	m.cpuDemodUtilization.Reset()
+	m.cpuReaderUtilization.Reset()
+	m.cpuBackgroundUtilization.Reset()
+	m.localGainDB.Reset()
+	m.gainDB.Reset()
+	m.adaptiveGainDB.Reset()
+	m.adaptiveDynamicRangeLimitDB.Reset()
+	m.adaptiveGainChanges.Reset()
+	m.adaptiveGainChangesPerMin.Reset()
+	m.adaptiveLoudUndecoded.Reset()
+	m.adaptiveLoudDecoded.Reset()
+	m.adaptiveNoiseDBFS.Reset()
+	m.adaptiveGainSeconds.Reset()
+	m.adaptiveGainDistribution.reset()
+	m.localSamplesProcessed.Reset()
+	m.localSamplesDropped.Reset()
+	m.localModeAC.Reset()
+	m.localUnknownICAO.Reset()
+	m.localAcceptedTotal.Reset()
+	m.localAcceptedByErrors.Reset()
+	m.localAcceptedCorrectedRatio.Reset()
+	m.localSignal.Reset()
+	m.localNoise.Reset()
+	m.localPeakSignal.Reset()
+	m.localSNR.Reset()
+	m.localPeakSNR.Reset()
+	m.localStrongSignals.Reset()
+	m.remoteModeAC.Reset()
+	m.remoteModes.Reset()
+	m.remoteBad.Reset()
+	m.remoteUnknownICAO.Reset()
+	m.remoteAcceptedTotal.Reset()
+	m.remoteAcceptedByErrors.Reset()
+	m.remoteSignal.Reset()
+	m.remoteNoise.Reset()
+	m.remotePeakSignal.Reset()
+	m.remoteStrongSignals.Reset()
+	m.remoteSamplesProcessed.Reset()
+	m.remoteSamplesDropped.Reset()
+	m.remoteGainDB.Reset()
+	m.cprSurface.Reset()
+	m.cprAirborne.Reset()
+	m.cprGlobalOk.Reset()
+	m.cprGlobalBad.Reset()
+	m.cprGlobalRange.Reset()
+	m.cprGlobalSpeed.Reset()
+	m.cprGlobalSkipped.Reset()
+	m.cprLocalOk.Reset()
+	m.cprLocalAircraftRelative.Reset()
+	m.cprLocalReceiverRelative.Reset()
+	m.cprLocalSkipped.Reset()
+	m.cprLocalRange.Reset()
+	m.cprLocalSpeed.Reset()
+	m.cprFiltered.Reset()
+	m.cprGlobalSuccessRatio.Reset()
+	m.cprLocalSuccessRatio.Reset()
+	m.tracks.Reset()
+	m.tracksAll.Reset()
+	m.tracksSingleMessage.Reset()
+	m.tracksUnreliable.Reset()
+	m.altitudeSuppressed.Reset()
+}
+
+// periodHistograms serves one const histogram per stats period, replaced on
+// every update. Updates hold applyMu, so gathers through Gatherer never see
+// one half done; mu only keeps a direct Collect safe.
+type periodHistograms struct {
+	desc     *prometheus.Desc
+	mu       sync.Mutex
+	byPeriod map[string]prometheus.Metric
+}
+
+func (h *periodHistograms) Describe(ch chan<- *prometheus.Desc) {
+	ch <- h.desc
+}
+
+func (h *periodHistograms) Collect(ch chan<- prometheus.Metric) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, m := range h.byPeriod {
+		ch <- m
+	}
+}
+
+// set replaces period's histogram with seconds by bucket upper bound,
+// deleting it if there are none. Seconds are summed cumulatively and then
+// rounded, so fractions don't drift across buckets.
+func (h *periodHistograms) set(period string, seconds map[float64]float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(seconds) == 0 {
+		delete(h.byPeriod, period)
+		return
+	}
+	les := slices.Sorted(maps.Keys(seconds))
+	buckets := make(map[float64]uint64, len(les))
+	var cum, sum float64
+	for _, le := range les {
+		cum += seconds[le]
+		sum += le * seconds[le]
+		buckets[le] = uint64(math.Round(cum))
+	}
+	h.byPeriod[period] = prometheus.MustNewConstHistogram(h.desc, uint64(math.Round(cum)), sum, buckets, period)
+}
+
+func (h *periodHistograms) reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	clear(h.byPeriod)
+}
+
+// receiverMetrics holds the gauges populated from receiver.json and, when
+// enabled, the history files next to it. They have no labels but are vecs so
+// they can go absent while the source is down.
+type receiverMetrics struct {
+	historyFiles           *prometheus.GaugeVec
+	historyOldestTimestamp *prometheus.GaugeVec
+	historyMaxGap          *prometheus.GaugeVec
+}
+
+func newReceiverMetrics(f promauto.Factory) *receiverMetrics {
+	return &receiverMetrics{
+		historyFiles: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_receiver_history_files",
+			Help: "Number of history_N.json files the receiver keeps, from receiver.json",
+		}, nil),
+		historyOldestTimestamp: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_receiver_history_oldest_timestamp_seconds",
+			Help: "Unix time of the oldest readable history file (only with history reading enabled)",
+		}, nil),
+		historyMaxGap: f.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "adsb_receiver_history_max_gap_seconds",
+			Help: "Longest interval between consecutive readable history files (only with history reading enabled)",
+		}, nil),
+	}
+}
+
+// reset drops every receiver series.
+func (m *receiverMetrics) reset() {
+	m.historyFiles.Reset()
+	m.historyOldestTimestamp.Reset()
+	m.historyMaxGap.Reset()
+}
+
+// aircraftMetrics holds the metrics populated from aircraft.json. The
+// per-aircraft and aggregate gauges are served as const metrics built by each
+// update and swapped in whole, so a scrape sees every aircraft from the same
+// file; aircraftMetrics is the prometheus.Collector serving them.
+type aircraftMetrics struct {
+	descs   []*prometheus.Desc
+	current atomic.Pointer[[]prometheus.Metric]
+
+	altBaro       *prometheus.Desc
+	rssi          *prometheus.Desc
+	gs            *prometheus.Desc
+	lat           *prometheus.Desc
+	lon           *prometheus.Desc
+	navQNH        *prometheus.Desc
+	navHeading    *prometheus.Desc
+	altGeom       *prometheus.Desc
+	altBaroMeters *prometheus.Desc
+	altGeomMeters *prometheus.Desc
+	ias           *prometheus.Desc
+	tas           *prometheus.Desc
+	mach          *prometheus.Desc
+	gsKmh         *prometheus.Desc
+	iasKmh        *prometheus.Desc
+	tasKmh        *prometheus.Desc
+	track         *prometheus.Desc
+	trackRate     *prometheus.Desc
+	roll          *prometheus.Desc
+	turning       *prometheus.Desc
+	magHeading    *prometheus.Desc
+	trueHeading   *prometheus.Desc
+	// sin/cos components of track and headings
+	trackSin          *prometheus.Desc
+	trackCos          *prometheus.Desc
+	magHeadingSin     *prometheus.Desc
+	magHeadingCos     *prometheus.Desc
+	trueHeadingSin    *prometheus.Desc
+	trueHeadingCos    *prometheus.Desc
+	baroRate          *prometheus.Desc
+	geomRate          *prometheus.Desc
+	navAltMCP         *prometheus.Desc
+	navAltFMS         *prometheus.Desc
+	navQNHDeviation   *prometheus.Desc
+	altDeviation      *prometheus.Desc
+	windSpeed         *prometheus.Desc
+	windDirection     *prometheus.Desc
+	messageRate       *prometheus.Desc
+	messagesReceived  *prometheus.Desc
+	sessionDuration   *prometheus.Desc
+	navModeActive     *prometheus.Desc
+	nic               *prometheus.Desc
+	rc                *prometheus.Desc
+	nicBaro           *prometheus.Desc
+	nacp              *prometheus.Desc
+	nacv              *prometheus.Desc
+	sil               *prometheus.Desc
+	gva               *prometheus.Desc
+	sda               *prometheus.Desc
+	version           *prometheus.Desc
+	alert             *prometheus.Desc
+	spi               *prometheus.Desc
+	acasRAActive      *prometheus.Desc
+	dbMilitary        *prometheus.Desc
+	dbInteresting     *prometheus.Desc
+	dbPIA             *prometheus.Desc
+	dbLADD            *prometheus.Desc
+	seenPos           *prometheus.Desc
+	seen              *prometheus.Desc
+	messages          *prometheus.Desc
+	info              *prometheus.Desc
+	dbInfo            *prometheus.Desc
+	nonICAO           *prometheus.Desc
+	categoryCount     *prometheus.Desc
+	categoryInfo      *prometheus.Desc
+	navModeCount      *prometheus.Desc
+	alertCount        *prometheus.Desc
+	spiCount          *prometheus.Desc
+	flights           *prometheus.Desc
+	operatorCount     *prometheus.Desc
+	countryCount      *prometheus.Desc
+	unfilteredCount   *prometheus.Desc
+	fileEntries       *prometheus.Desc
+	fileTimestamp     *prometheus.Desc
+	altitudeBandCount *prometheus.Desc
+	versionCount      *prometheus.Desc
+	geohashCount      *prometheus.Desc
+	rssiMin           *prometheus.Desc
+	rssiMax           *prometheus.Desc
+	rssiMean          *prometheus.Desc
+	rssiMedian        *prometheus.Desc
+	strongestRSSI     *prometheus.Desc
+	weakestRSSI       *prometheus.Desc
+	// reported by the aircraft, unlike windSpeed and windDirection
+	windSpeedReported     *prometheus.Desc
+	windDirectionReported *prometheus.Desc
+	oat                   *prometheus.Desc
+	tat                   *prometheus.Desc
+	// only exported with Options.RSSIHistogram set
+	rssiDistribution *prometheus.Desc
+	// only exported with Options.Receiver set
+	distanceBandCount *prometheus.Desc
+	rangeByBearing    *prometheus.Desc
+	closestDistance   *prometheus.Desc
+	closestAltBaro    *prometheus.Desc
+	closestGS         *prometheus.Desc
+	strongestDistance *prometheus.Desc
+	// also need Options.ClosestAircraftHex and OverheadRadius
+	closestInfo    *prometheus.Desc
+	overhead       *prometheus.Desc
+	overheadEvents *prometheus.Desc
+	// only exported with Options.MaxAircraft set
+	droppedByLimit *prometheus.Desc
+	fileMessages   prometheus.Counter
+	noHex          prometheus.Counter
+	acasRAEvents   prometheus.Counter
+	newAircraft    prometheus.Counter
+	lostAircraft   prometheus.Counter
+	discarded      *prometheus.CounterVec
+}
+
+func newAircraftMetrics(f promauto.Factory) *aircraftMetrics {
+	var descs []*prometheus.Desc
+	desc := func(name, help string, labels []string) *prometheus.Desc {
+		d := prometheus.NewDesc(name, help, labels, nil)
+		descs = append(descs, d)
+		return d
+	}
+	m := &aircraftMetrics{
+		altBaro: desc("adsb_aircraft_alt_baro_feet",
+			"Aircraft barometric altitude (feet)",
+			[]string{"hex", "flight", "category"}),
+		rssi: desc("adsb_aircraft_rssi_dbfs",
+			"Recent average RSSI (dBFS)",
+			[]string{"hex", "flight", "category"}),
+		gs: desc("adsb_aircraft_ground_speed_kts",
+			"Aircraft ground speed (knots)",
+			[]string{"hex", "flight", "category"}),
+		lat: desc("adsb_aircraft_lat",
+			"Aircraft latitude",
+			[]string{"hex", "flight", "category"}),
+		lon: desc("adsb_aircraft_lon",
+			"Aircraft longitude",
+			[]string{"hex", "flight", "category"}),
+		navQNH: desc("adsb_aircraft_nav_qnh_hpa",
+			"Aircraft nav QNH (hPa)",
+			[]string{"hex", "flight", "category"}),
+		navQNHDeviation: desc("adsb_aircraft_nav_qnh_deviation_hpa",
+			"Aircraft nav QNH less the standard 1013.25 hPa",
+			[]string{"hex", "flight", "category"}),
+		windSpeed: desc("adsb_aircraft_wind_speed_kts",
+			"Wind speed at the aircraft estimated from tas, gs, track and heading (knots)",
+			[]string{"hex", "flight", "category"}),
+		windDirection: desc("adsb_aircraft_wind_direction_deg",
+			"Direction the wind blows from at the aircraft, estimated from tas, gs, track and heading (degrees)",
+			[]string{"hex", "flight", "category"}),
+		windSpeedReported: desc("adsb_aircraft_wind_speed_reported_kts",
+			"Wind speed reported by the aircraft (knots)",
+			[]string{"hex", "flight", "category"}),
+		windDirectionReported: desc("adsb_aircraft_wind_direction_reported_deg",
+			"Wind direction reported by the aircraft (degrees)",
+			[]string{"hex", "flight", "category"}),
+		oat: desc("adsb_aircraft_oat_celsius",
+			"Outside air temperature reported by the aircraft (°C)",
+			[]string{"hex", "flight", "category"}),
+		tat: desc("adsb_aircraft_tat_celsius",
+			"Total air temperature reported by the aircraft (°C)",
+			[]string{"hex", "flight", "category"}),
+		messageRate: desc("adsb_aircraft_message_rate_per_sec",
+			"Messages received from the aircraft per second since the previous refresh",
+			[]string{"hex", "flight", "category"}),
+		messagesReceived: desc("adsb_aircraft_messages_received_total",
+			"Messages received from the aircraft, as a counter: readsb's count going backwards is taken as a reset",
+			[]string{"hex", "flight", "category"}),
+		sessionDuration: desc("adsb_aircraft_session_seconds",
+			"Seconds since the aircraft's current spell in coverage began, by aircraft.json now",
+			[]string{"hex", "flight", "category"}),
+		navHeading: desc("adsb_aircraft_nav_heading_deg",
+			"Aircraft selected nav heading (degrees)",
+			[]string{"hex", "flight", "category"}),
+
+		// Additional aircraft metrics - altitude
+		altGeom: desc("adsb_aircraft_alt_geom_feet",
+			"Aircraft geometric (GNSS/INS) altitude (feet)",
+			[]string{"hex", "flight", "category"}),
+		altBaroMeters: desc("adsb_aircraft_alt_baro_meters",
+			"Aircraft barometric altitude (meters)",
+			[]string{"hex", "flight", "category"}),
+		altGeomMeters: desc("adsb_aircraft_alt_geom_meters",
+			"Aircraft geometric (GNSS/INS) altitude (meters)",
+			[]string{"hex", "flight", "category"}),
+
+		// Speed metrics
+		ias: desc("adsb_aircraft_ias_kts",
+			"Aircraft indicated air speed (knots)",
+			[]string{"hex", "flight", "category"}),
+		tas: desc("adsb_aircraft_tas_kts",
+			"Aircraft true air speed (knots)",
+			[]string{"hex", "flight", "category"}),
+		mach: desc("adsb_aircraft_mach",
+			"Aircraft Mach number",
+			[]string{"hex", "flight", "category"}),
+
+		// Speed metrics in km/h, only populated with SpeedUnit "kmh"
+		gsKmh: desc("adsb_aircraft_ground_speed_kmh",
+			"Aircraft ground speed (km/h)",
+			[]string{"hex", "flight", "category"}),
+		iasKmh: desc("adsb_aircraft_ias_kmh",
+			"Aircraft indicated air speed (km/h)",
+			[]string{"hex", "flight", "category"}),
+		tasKmh: desc("adsb_aircraft_tas_kmh",
+			"Aircraft true air speed (km/h)",
+			[]string{"hex", "flight", "category"}),
+
+		// Track and heading metrics
+		track: desc("adsb_aircraft_track_deg",
+			"Aircraft true track over ground (degrees)",
+			[]string{"hex", "flight", "category"}),
+		trackRate: desc("adsb_aircraft_track_rate_deg_per_sec",
+			"Aircraft rate of change of track (degrees/second)",
+			[]string{"hex", "flight", "category"}),
+		roll: desc("adsb_aircraft_roll_deg",
+			"Aircraft roll angle (degrees, negative is left)",
+			[]string{"hex", "flight", "category"}),
+		turning: desc("adsb_aircraft_turning",
+			"Aircraft turn direction from its roll: -1 left, 0 straight (within TURN_DEADBAND_DEGREES), 1 right",
+			[]string{"hex", "flight", "category"}),
+		magHeading: desc("adsb_aircraft_mag_heading_deg",
+			"Aircraft magnetic heading (degrees)",
+			[]string{"hex", "flight", "category"}),
+		trueHeading: desc("adsb_aircraft_true_heading_deg",
+			"Aircraft true heading (degrees)",
+			[]string{"hex", "flight", "category"}),
+		trackSin: desc("adsb_aircraft_track_sin",
+			"Sine of the aircraft track; average with track_cos and atan2 back rather than averaging degrees",
+			[]string{"hex", "flight", "category"}),
+		trackCos: desc("adsb_aircraft_track_cos",
+			"Cosine of the aircraft track",
+			[]string{"hex", "flight", "category"}),
+		magHeadingSin: desc("adsb_aircraft_mag_heading_sin",
+			"Sine of the aircraft magnetic heading",
+			[]string{"hex", "flight", "category"}),
+		magHeadingCos: desc("adsb_aircraft_mag_heading_cos",
+			"Cosine of the aircraft magnetic heading",
+			[]string{"hex", "flight", "category"}),
+		trueHeadingSin: desc("adsb_aircraft_true_heading_sin",
+			"Sine of the aircraft true heading",
+			[]string{"hex", "flight", "category"}),
+		trueHeadingCos: desc("adsb_aircraft_true_heading_cos",
+			"Cosine of the aircraft true heading",
+			[]string{"hex", "flight", "category"}),
+
+		// Rate of climb/descent
+		baroRate: desc("adsb_aircraft_baro_rate_feet_per_min",
+			"Aircraft barometric altitude rate of change (feet/minute)",
+			[]string{"hex", "flight", "category"}),
+		geomRate: desc("adsb_aircraft_geom_rate_feet_per_min",
+			"Aircraft geometric altitude rate of change (feet/minute)",
+			[]string{"hex", "flight", "category"}),
+
+		// Navigation metrics
+		navAltMCP: desc("adsb_aircraft_nav_altitude_mcp_feet",
+			"Aircraft selected altitude from MCP/FCU (feet)",
+			[]string{"hex", "flight", "category"}),
+		navAltFMS: desc("adsb_aircraft_nav_altitude_fms_feet",
+			"Aircraft selected altitude from FMS (feet)",
+			[]string{"hex", "flight", "category"}),
+		altDeviation: desc("adsb_aircraft_alt_deviation_feet",
+			"Aircraft barometric altitude less its selected altitude, from MCP or else FMS; positive when above it (feet)",
+			[]string{"hex", "flight", "category"}),
+		navModeActive: desc("adsb_aircraft_nav_mode_active",
+			"Navigation mode the aircraft reports as active (always 1; absent when not reported)",
+			[]string{"hex", "flight", "category", "mode"}),
+
+		// Quality and integrity metrics
+		nic: desc("adsb_aircraft_nic",
+			"Aircraft Navigation Integrity Category",
+			[]string{"hex", "flight", "category"}),
+		rc: desc("adsb_aircraft_rc_meters",
+			"Aircraft Radius of Containment (meters)",
+			[]string{"hex", "flight", "category"}),
+		nicBaro: desc("adsb_aircraft_nic_baro",
+			"Aircraft Navigation Integrity Category for Barometric Altitude",
+			[]string{"hex", "flight", "category"}),
+		nacp: desc("adsb_aircraft_nac_p",
+			"Aircraft Navigation Accuracy for Position",
+			[]string{"hex", "flight", "category"}),
+		nacv: desc("adsb_aircraft_nac_v",
+			"Aircraft Navigation Accuracy for Velocity",
+			[]string{"hex", "flight", "category"}),
+		sil: desc("adsb_aircraft_sil",
+			"Aircraft Source Integrity Level",
+			[]string{"hex", "flight", "category"}),
+		gva: desc("adsb_aircraft_gva",
+			"Aircraft Geometric Vertical Accuracy",
+			[]string{"hex", "flight", "category"}),
+		sda: desc("adsb_aircraft_sda",
+			"Aircraft System Design Assurance",
+			[]string{"hex", "flight", "category"}),
+		alert: desc("adsb_aircraft_alert",
+			"1 while the aircraft's flight status alert flag is set, after a squawk change or with an emergency (absent otherwise)",
+			[]string{"hex", "flight", "category"}),
+		spi: desc("adsb_aircraft_spi",
+			"1 while the aircraft's special position identification (IDENT) flag is set (absent otherwise)",
+			[]string{"hex", "flight", "category"}),
+		dbMilitary: desc("adsb_aircraft_db_military",
+			"1 if tar1090's database flags the aircraft as military, else 0 (absent without dbFlags)",
+			[]string{"hex", "flight", "category"}),
+		dbInteresting: desc("adsb_aircraft_db_interesting",
+			"1 if tar1090's database flags the aircraft as interesting, else 0 (absent without dbFlags)",
+			[]string{"hex", "flight", "category"}),
+		dbPIA: desc("adsb_aircraft_db_pia",
+			"1 if tar1090's database flags the address as a Privacy ICAO Address, else 0 (absent without dbFlags)",
+			[]string{"hex", "flight", "category"}),
+		dbLADD: desc("adsb_aircraft_db_ladd",
+			"1 if tar1090's database flags the aircraft as on the FAA LADD list, else 0 (absent without dbFlags)",
+			[]string{"hex", "flight", "category"}),
+		acasRAActive: desc("adsb_aircraft_acas_ra_active",
+			"1 while the aircraft reports an ACAS/TCAS resolution advisory (absent otherwise)",
+			[]string{"hex", "flight", "category"}),
+		version: desc("adsb_aircraft_version",
+			"Aircraft ADS-B Version Number",
+			[]string{"hex", "flight", "category"}),
+
+		// Timing metrics
+		seenPos: desc("adsb_aircraft_seen_pos_seconds",
+			"Seconds since last position update",
+			[]string{"hex", "flight", "category"}),
+		seen: desc("adsb_aircraft_seen_seconds",
+			"Seconds since last message received",
+			[]string{"hex", "flight", "category"}),
+		messages: desc("adsb_aircraft_messages_total",
+			"Total messages received from the aircraft, a gauge; use adsb_aircraft_messages_received_total for rate()",
+			[]string{"hex", "flight", "category"}),
+
+		// Info metrics for string fields
+		nonICAO: desc("adsb_aircraft_non_icao",
+			"1 for aircraft with a non-ICAO (\"~\" prefixed) address, such as TIS-B targets; the hex label keeps the prefix",
+			[]string{"hex", "flight", "category"}),
+		info: desc("adsb_aircraft_info",
+			"Aircraft information (squawk, emergency, type, sil_type)",
+			[]string{"hex", "flight", "category", "squawk", "emergency", "type", "sil_type"}),
+		dbInfo: desc("adsb_aircraft_db_info",
+			"Registration, ICAO type and operator of the aircraft from AIRCRAFT_DB_PATH (always 1; absent when not in the database)",
+			[]string{"hex", "registration", "type", "operator"}),
+
+		// Aggregates over all current aircraft
+		categoryCount: desc("adsb_aircraft_category_count",
+			"Number of current aircraft per emitter category (unknown when unset)",
+			[]string{"category"}),
+		categoryInfo: desc("adsb_aircraft_category_info",
+			"Human readable description of each emitter category currently seen",
+			[]string{"category", "description"}),
+		navModeCount: desc("adsb_aircraft_nav_mode_count",
+			"Number of current aircraft reporting each navigation mode",
+			[]string{"mode"}),
+		alertCount: desc("adsb_aircraft_alert_count",
+			"Number of current aircraft with the flight status alert flag set",
+			nil),
+		spiCount: desc("adsb_aircraft_spi_count",
+			"Number of current aircraft with the IDENT flag set",
+			nil),
+		altitudeBandCount: desc("adsb_aircraft_count_by_altitude_band",
+			"Number of current aircraft per barometric altitude band (feet)",
+			[]string{"band"}),
+		versionCount: desc("adsb_aircraft_count_by_adsb_version",
+			"Number of current aircraft per ADS-B version (0 DO-260, 1 DO-260A, 2 DO-260B; unknown when not reported)",
+			[]string{"version"}),
+		distanceBandCount: desc("adsb_aircraft_count_by_distance_band",
+			"Number of current aircraft per distance band (km) from the receiver",
+			[]string{"band"}),
+		rangeByBearing: desc("adsb_receiver_range_by_bearing_km",
+			"Distance of the farthest aircraft per bearing sector from the receiver (km)",
+			[]string{"sector"}),
+		closestDistance: desc("adsb_receiver_closest_aircraft_distance_km",
+			"Distance of the closest aircraft with a fresh position from the receiver (km)",
+			nil),
+		closestAltBaro: desc("adsb_receiver_closest_aircraft_alt_baro_feet",
+			"Barometric altitude of the closest aircraft (feet)",
+			nil),
+		closestGS: desc("adsb_receiver_closest_aircraft_ground_speed_kts",
+			"Ground speed of the closest aircraft (knots)",
+			nil),
+		closestInfo: desc("adsb_receiver_closest_aircraft_info",
+			"Hex address of the closest aircraft",
+			[]string{"hex"}),
+		overhead: desc("adsb_receiver_aircraft_overhead",
+			"Number of aircraft currently within the configured overhead radius and altitude",
+			nil),
+		overheadEvents: desc("adsb_receiver_aircraft_overhead_events_total",
+			"Number of times an aircraft came within the configured overhead radius and altitude",
+			nil),
+		rssiMin: desc("adsb_aircraft_rssi_min_dbfs",
+			"Lowest RSSI of the current aircraft with a recent signal (dBFS)",
+			nil),
+		rssiMax: desc("adsb_aircraft_rssi_max_dbfs",
+			"Highest RSSI of the current aircraft with a recent signal (dBFS)",
+			nil),
+		rssiMean: desc("adsb_aircraft_rssi_mean_dbfs",
+			"Mean RSSI of the current aircraft with a recent signal (dBFS)",
+			nil),
+		rssiMedian: desc("adsb_aircraft_rssi_median_dbfs",
+			"Median RSSI of the current aircraft with a recent signal (dBFS)",
+			nil),
+		strongestRSSI: desc("adsb_receiver_strongest_aircraft_rssi_dbfs",
+			"RSSI of the strongest current aircraft with a recent signal (dBFS)",
+			nil),
+		weakestRSSI: desc("adsb_receiver_weakest_aircraft_rssi_dbfs",
+			"RSSI of the weakest current aircraft with a recent signal (dBFS)",
+			nil),
+		strongestDistance: desc("adsb_receiver_strongest_aircraft_distance_km",
+			"Distance of the strongest current aircraft from the receiver (km)",
+			nil),
+		rssiDistribution: desc("adsb_aircraft_rssi_distribution",
+			"RSSI of the current aircraft with a recent signal (dBFS); rebuilt on every refresh, so not a counter to rate()",
+			nil),
+		geohashCount: desc("adsb_aircraft_geohash_count",
+			"Number of current aircraft with a position per geohash cell",
+			[]string{"geohash"}),
+		flights: desc("adsb_flights_total",
+			"Number of distinct callsigns among the current aircraft; aircraft without one aren't counted and MLAT duplicates count once",
+			nil),
+		operatorCount: desc("adsb_aircraft_count_by_operator",
+			"Number of current aircraft per ICAO airline designator, the first three letters of callsigns like UAL123; other for the rest, such as registrations and aircraft without a callsign",
+			[]string{"operator"}),
+		countryCount: desc("adsb_aircraft_count_by_country",
+			"Number of current aircraft per state of registration, from the ICAO address allocation; unassigned for non-ICAO addresses and unallocated blocks",
+			[]string{"country"}),
+		unfilteredCount: desc("adsb_aircraft_unfiltered_count",
+			"Aircraft with a hex address in the last aircraft.json, before category filters and MAX_AIRCRAFT",
+			nil),
+		fileEntries: desc("adsb_aircraft_file_entries",
+			"Entries in the aircraft list of the last aircraft.json, before any filtering; with several files, the count once merged by hex",
+			nil),
+		fileTimestamp: desc("adsb_aircraft_file_timestamp_seconds",
+			"The now field of the last aircraft.json: Unix time the receiver wrote it",
+			nil),
+		droppedByLimit: desc("adsb_aircraft_dropped_by_limit",
+			"Aircraft in the last aircraft.json left out of the per-aircraft metrics by MAX_AIRCRAFT",
+			nil),
+		fileMessages: f.NewCounter(prometheus.CounterOpts{
+			Name: "adsb_aircraft_file_messages_total",
+			Help: "Total messages processed by the receiver, from the top-level messages field of aircraft.json",
+		}),
+		noHex: f.NewCounter(prometheus.CounterOpts{
+			Name: "adsb_exporter_aircraft_no_hex_total",
+			Help: "Aircraft entries skipped because they had no hex address",
+		}),
+		newAircraft: f.NewCounter(prometheus.CounterOpts{
+			Name: "adsb_receiver_aircraft_new_total",
+			Help: "Aircraft, by hex, present in an aircraft.json but not in the one before",
+		}),
+		lostAircraft: f.NewCounter(prometheus.CounterOpts{
+			Name: "adsb_receiver_aircraft_lost_total",
+			Help: "Aircraft, by hex, present in an aircraft.json but not in the one after",
+		}),
+		acasRAEvents: f.NewCounter(prometheus.CounterOpts{
+			Name: "adsb_acas_ra_events_total",
+			Help: "Number of times an aircraft started reporting an ACAS/TCAS resolution advisory",
+		}),
+		discarded: f.NewCounterVec(prometheus.CounterOpts{
+			Name: "adsb_exporter_discarded_values_total",
+			Help: "Aircraft field values discarded as NaN, infinite or outside sanity bounds",
+		}, []string{"field"}),
+	}
+	m.descs = descs
+	return m
+}
+
+// Describe implements prometheus.Collector.
+func (m *aircraftMetrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range m.descs {
+		ch <- d
+	}
+}
+
+// Collect implements prometheus.Collector. The counters are registered
+// separately.
+func (m *aircraftMetrics) Collect(ch chan<- prometheus.Metric) {
+	if ms := m.current.Load(); ms != nil {
+		for _, metric := range *ms {
+			ch <- metric
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package collector
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// parseAltitude reads an alt_baro or alt_geom value: a number, a numeric
+// string or "ground", bare or wrapped in a one-element array or an object
+// with a "value" key, as some dump1090 forks write it. valid is false for
+// "ground" and anything unparseable, including NaN and ±Inf.
+func parseAltitude(v interface{}) (alt float64, valid, onGround bool) {
+	switch t := v.(type) {
+	case string:
+		if strings.EqualFold(strings.TrimSpace(t), "ground") {
+			return 0, false, true
+		}
+	case []interface{}:
+		if len(t) != 1 {
+			return 0, false, false
+		}
+		return parseAltitude(t[0])
+	case map[string]interface{}:
+		return parseAltitude(t["value"])
+	}
+	alt, valid = numericFromInterface(v)
+	return alt, valid, false
+}
+
+// numericFromInterface converts a decoded JSON value to a finite float64.
+// NaN and ±Inf (e.g. a "nan" string) are rejected.
+func numericFromInterface(v interface{}) (float64, bool) {
+	f, ok := anyToFloat(v)
+	if !ok || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, false
+	}
+	return f, true
+}
+
+func anyToFloat(v interface{}) (float64, bool) {
+	switch t := v.(type) {
+	case float64:
+		return t, true
+	case float32:
+		return float64(t), true
+	case int:
+		return float64(t), true
+	case int64:
+		return float64(t), true
+	case json.Number:
+		if f, err := t.Float64(); err == nil {
+			return f, true
+		}
+	case string:
+		if f, err := strconv.ParseFloat(t, 64); err == nil {
+			return f, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,76 @@
+package collector
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestNumericFromInterface(t *testing.T) {
+	tests := []struct {
+		name string
+		in   interface{}
+		want float64
+		ok   bool
+	}{
+		{"nil", nil, 0, false},
+		{"float64", 35000.0, 35000, true},
+		{"float32", float32(1.5), 1.5, true},
+		{"int", 42, 42, true},
+		{"int64", int64(-7), -7, true},
+		{"json number", json.Number("12.5"), 12.5, true},
+		{"bad json number", json.Number("x"), 0, false},
+		{"numeric string", "1200", 1200, true},
+		{"ground", "ground", 0, false},
+		{"nan string", "nan", 0, false},
+		{"inf string", "-Inf", 0, false},
+		{"nan", math.NaN(), 0, false},
+		{"bool", true, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := numericFromInterface(tt.in)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("numericFromInterface(%#v) = %v, %v; want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestParseAltitude(t *testing.T) {
+	tests := []struct {
+		name      string
+		in        string
+		want      float64
+		ok, onGnd bool
+	}{
+		{"number", `35000`, 35000, true, false},
+		{"negative", `-150`, -150, true, false},
+		{"numeric string", `"1200"`, 1200, true, false},
+		{"ground", `"ground"`, 0, false, true},
+		{"padded ground", `" Ground "`, 0, false, true},
+		{"wrapped in array", `[36000]`, 36000, true, false},
+		{"wrapped in object", `{"value": 8000}`, 8000, true, false},
+		{"wrapped ground", `{"value": "ground"}`, 0, false, true},
+		{"nested", `[{"value": "4100"}]`, 4100, true, false},
+		{"null", `null`, 0, false, false},
+		{"nan string", `"nan"`, 0, false, false},
+		{"other string", `"unknown"`, 0, false, false},
+		{"bool", `true`, 0, false, false},
+		{"empty array", `[]`, 0, false, false},
+		{"two elements", `[1, 2]`, 0, false, false},
+		{"object without value", `{"alt": 1}`, 0, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v interface{}
+			if err := json.Unmarshal([]byte(tt.in), &v); err != nil {
+				t.Fatal(err)
+			}
+			got, ok, onGnd := parseAltitude(v)
+			if got != tt.want || ok != tt.ok || onGnd != tt.onGnd {
+				t.Errorf("parseAltitude(%s) = %v, %v, %v; want %v, %v, %v", tt.in, got, ok, onGnd, tt.want, tt.ok, tt.onGnd)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package collector
+
+import dto "github.com/prometheus/client_model/go"
+
+// messageSample is an aircraft's message count as of a file's now, kept
+// between passes to derive adsb_aircraft_message_rate_per_sec and
+// adsb_aircraft_messages_received_total.
+type messageSample struct {
+	messages int
+	now      float64
+	rate     float64
+	hasRate  bool
+	// counter value: messages summed across the resets of the count
+	total float64
+}
+
+// messageCount is what an aircraft pass records for the rate: the count and
+// the label pairs of the aircraft's series.
+type messageCount struct {
+	messages int
+	labels   []*dto.LabelPair
+}
+
+// appendMessageRates adds adsb_aircraft_message_rate_per_sec to the
+// aircraft in u, from the change in their message count since the previous
+// pass, and adsb_aircraft_messages_received_total, advanced by the same
+// change. It runs once the whole file is decoded, as now may follow the
+// aircraft list. A new aircraft gets no rate until its second pass; a count
+// that went backwards, a new session for the same hex, gives 0 and adds the
+// new count to the counter. Only aircraft in the file, and those
+// keepAbsentAircraft holds, are carried to the next pass, so one that drops
+// out for longer starts over when it comes back.
+func (c *Collector) appendMessageRates(u *aircraftUpdate, now float64) {
+	for key, mc := range u.counts {
+		cur := messageSample{messages: mc.messages, now: now, total: float64(mc.messages)}
+		if prev, ok := c.prevMessages[key.hex]; ok {
+			switch {
+			case now <= prev.now:
+				// no time has passed; keep the last rate
+				cur = prev
+			case mc.messages < prev.messages:
+				cur.rate, cur.hasRate = 0, true
+				cur.total = prev.total + float64(mc.messages)
+			default:
+				cur.rate = float64(mc.messages-prev.messages) / (now - prev.now)
+				cur.hasRate = true
+				cur.total = prev.total + float64(mc.messages-prev.messages)
+			}
+		}
+		u.messages[key.hex] = cur
+		u.cur[key] = append(u.cur[key], aircraftGauge{desc: c.aircraft.messagesReceived, labels: mc.labels, value: cur.total, counter: true})
+		u.n++
+		if cur.hasRate {
+			u.cur[key] = append(u.cur[key], aircraftGauge{desc: c.aircraft.messageRate, labels: mc.labels, value: cur.rate})
+			u.n++
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package collector
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMessageRate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aircraft.json")
+	c := New(prometheus.NewRegistry(), Options{})
+	for i, tt := range []struct {
+		data     string
+		expected string
+	}{
+		// first sighting: no rate yet
+		{`{"now": 1700000010, "aircraft": [{"hex": "aaaaaa", "messages": 100}]}`, ""},
+		// now after the aircraft list, and a new aircraft
+		{`{"aircraft": [{"hex": "aaaaaa", "messages": 150}, {"hex": "bbbbbb", "messages": 7}], "now": 1700000015}`,
+			`adsb_aircraft_message_rate_per_sec{category="",flight="",hex="aaaaaa"} 10`},
+		// aaaaaa starts a new session
+		{`{"now": 1700000020, "aircraft": [{"hex": "aaaaaa", "messages": 3}, {"hex": "bbbbbb", "messages": 27}]}`,
+			`adsb_aircraft_message_rate_per_sec{category="",flight="",hex="aaaaaa"} 0
+adsb_aircraft_message_rate_per_sec{category="",flight="",hex="bbbbbb"} 4`},
+		// the same snapshot again keeps the rates
+		{`{"now": 1700000020, "aircraft": [{"hex": "aaaaaa", "messages": 3}, {"hex": "bbbbbb", "messages": 27}]}`,
+			`adsb_aircraft_message_rate_per_sec{category="",flight="",hex="aaaaaa"} 0
+adsb_aircraft_message_rate_per_sec{category="",flight="",hex="bbbbbb"} 4`},
+		// bbbbbb is gone, aaaaaa comes back after a gap
+		{`{"now": 1700000030, "aircraft": [{"hex": "aaaaaa", "messages": 23}]}`,
+			`adsb_aircraft_message_rate_per_sec{category="",flight="",hex="aaaaaa"} 2`},
+	} {
+		if err := os.WriteFile(path, []byte(tt.data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.UpdateAircraftsFromFile(path); err != nil {
+			t.Fatal(err)
+		}
+		expected := ""
+		if tt.expected != "" {
+			expected = fmt.Sprintf(`
+# HELP adsb_aircraft_message_rate_per_sec Messages received from the aircraft per second since the previous refresh
+# TYPE adsb_aircraft_message_rate_per_sec gauge
+%s
+`, tt.expected)
+		}
+		if err := testutil.CollectAndCompare(c.aircraft, strings.NewReader(expected), "adsb_aircraft_message_rate_per_sec"); err != nil {
+			t.Errorf("update %d: %v", i+1, err)
+		}
+	}
+}
+
+func TestMessagesReceivedCounter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aircraft.json")
+	c := New(prometheus.NewRegistry(), Options{})
+	for i, tt := range []struct {
+		data     string
+		expected string
+	}{
+		{`{"now": 1700000010, "aircraft": [{"hex": "aaaaaa", "messages": 100}]}`,
+			`adsb_aircraft_messages_received_total{category="",flight="",hex="aaaaaa"} 100`},
+		{`{"now": 1700000015, "aircraft": [{"hex": "aaaaaa", "messages": 150}, {"hex": "bbbbbb", "messages": 7}]}`,
+			`adsb_aircraft_messages_received_total{category="",flight="",hex="aaaaaa"} 150
+adsb_aircraft_messages_received_total{category="",flight="",hex="bbbbbb"} 7`},
+		// readsb restarted: aaaaaa's count went back, and the counter
+		// carries on from where it was
+		{`{"now": 1700000020, "aircraft": [{"hex": "aaaaaa", "messages": 3}, {"hex": "bbbbbb", "messages": 27}]}`,
+			`adsb_aircraft_messages_received_total{category="",flight="",hex="aaaaaa"} 153
+adsb_aircraft_messages_received_total{category="",flight="",hex="bbbbbb"} 27`},
+		// the same snapshot again adds nothing
+		{`{"now": 1700000020, "aircraft": [{"hex": "aaaaaa", "messages": 3}, {"hex": "bbbbbb", "messages": 27}]}`,
+			`adsb_aircraft_messages_received_total{category="",flight="",hex="aaaaaa"} 153
+adsb_aircraft_messages_received_total{category="",flight="",hex="bbbbbb"} 27`},
+		// bbbbbb is gone with its state, and starts over when back
+		{`{"now": 1700000025, "aircraft": [{"hex": "aaaaaa", "messages": 13}]}`,
+			`adsb_aircraft_messages_received_total{category="",flight="",hex="aaaaaa"} 163`},
+		{`{"now": 1700000030, "aircraft": [{"hex": "aaaaaa", "messages": 23}, {"hex": "bbbbbb", "messages": 5}]}`,
+			`adsb_aircraft_messages_received_total{category="",flight="",hex="aaaaaa"} 173
+adsb_aircraft_messages_received_total{category="",flight="",hex="bbbbbb"} 5`},
+	} {
+		if err := os.WriteFile(path, []byte(tt.data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.UpdateAircraftsFromFile(path); err != nil {
+			t.Fatal(err)
+		}
+		expected := fmt.Sprintf(`
+# HELP adsb_aircraft_messages_received_total Messages received from the aircraft, as a counter: readsb's count going backwards is taken as a reset
+# TYPE adsb_aircraft_messages_received_total counter
+%s
+`, tt.expected)
+		if err := testutil.CollectAndCompare(c.aircraft, strings.NewReader(expected), "adsb_aircraft_messages_received_total"); err != nil {
+			t.Errorf("update %d: %v", i+1, err)
+		}
+	}
+	if n := len(c.prevMessages); n != 2 {
+		t.Errorf("per-hex state for %d aircraft, want 2", n)
+	}
+}
+
+func TestMessagesReceivedDeleteGrace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aircraft.json")
+	c := New(prometheus.NewRegistry(), Options{DeleteGrace: 2})
+	for i, tt := range []struct {
+		data string
+		want float64
+	}{
+		{`{"now": 1700000010, "aircraft": [{"hex": "aaaaaa", "messages": 100}]}`, 100},
+		// readsb restarted
+		{`{"now": 1700000015, "aircraft": [{"hex": "aaaaaa", "messages": 3}]}`, 103},
+		// missed a file: the series is held
+		{`{"now": 1700000020, "aircraft": []}`, 103},
+		// back within the grace, the counter carries on
+		{`{"now": 1700000025, "aircraft": [{"hex": "aaaaaa", "messages": 13}]}`, 113},
+	} {
+		if err := os.WriteFile(path, []byte(tt.data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.UpdateAircraftsFromFile(path); err != nil {
+			t.Fatal(err)
+		}
+		expected := fmt.Sprintf(`
+# HELP adsb_aircraft_messages_received_total Messages received from the aircraft, as a counter: readsb's count going backwards is taken as a reset
+# TYPE adsb_aircraft_messages_received_total counter
+adsb_aircraft_messages_received_total{category="",flight="",hex="aaaaaa"} %v
+`, tt.want)
+		if err := testutil.CollectAndCompare(c.aircraft, strings.NewReader(expected), "adsb_aircraft_messages_received_total"); err != nil {
+			t.Errorf("update %d: %v", i+1, err)
+		}
+	}
+}
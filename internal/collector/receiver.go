@@ -0,0 +1,98 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+)
+
+// ReceiverFile is the part of readsb's receiver.json the exporter uses.
+type ReceiverFile struct {
+	// History is how many history_N.json files the receiver rotates
+	// through, numbered from 0.
+	History *int `json:"history,omitempty"`
+}
+
+// UpdateReceiverFromFile parses the receiver.json at path. With readHistory
+// it also reads the history_N.json files beside it, which is up to a few
+// hundred files per call, to export the oldest snapshot's time and the
+// longest gap between snapshots; files that are missing, as they are for a
+// while after the receiver starts, or unreadable are skipped.
+func (c *Collector) UpdateReceiverFromFile(path string, readHistory bool) error {
+	return c.UpdateReceiverFromFileContext(context.Background(), path, readHistory)
+}
+
+// UpdateReceiverFromFileContext is UpdateReceiverFromFile, except that
+// nothing is applied once ctx is done.
+func (c *Collector) UpdateReceiverFromFileContext(ctx context.Context, path string, readHistory bool) error {
+	b, err := safeReadFile(path)
+	if err != nil {
+		return err
+	}
+	var r ReceiverFile
+	if err := json.Unmarshal(b, &r); err != nil {
+		return fmt.Errorf("unmarshal receiver: %w", err)
+	}
+	var times []float64
+	if readHistory && r.History != nil {
+		times = readHistoryTimes(filepath.Dir(path), *r.History)
+	}
+
+	if err := c.lockApply(ctx); err != nil {
+		return err
+	}
+	defer c.applyMu.Unlock()
+	m := c.receiver
+	m.reset()
+	if r.History != nil {
+		m.historyFiles.WithLabelValues().Set(float64(*r.History))
+	}
+	if len(times) > 0 {
+		m.historyOldestTimestamp.WithLabelValues().Set(times[0])
+		m.historyMaxGap.WithLabelValues().Set(maxGap(times))
+	}
+	return nil
+}
+
+// ClearReceiver removes the receiver series until the next successful
+// UpdateReceiverFromFile.
+func (c *Collector) ClearReceiver() {
+	c.applyMu.Lock()
+	defer c.applyMu.Unlock()
+	c.receiver.reset()
+}
+
+// readHistoryTimes returns the sorted "now" of each readable history file
+// among the n in dir.
+func readHistoryTimes(dir string, n int) []float64 {
+	var times []float64
+	for i := range n {
+		b, err := os.ReadFile(filepath.Join(dir, "history_"+strconv.Itoa(i)+".json"))
+		if err != nil {
+			continue
+		}
+		var h struct {
+			Now float64 `json:"now"`
+		}
+		if json.Unmarshal(b, &h) != nil || h.Now <= 0 {
+			continue
+		}
+		times = append(times, h.Now)
+	}
+	slices.Sort(times)
+	return times
+}
+
+// maxGap returns the longest interval between consecutive sorted times, zero
+// for fewer than two.
+func maxGap(times []float64) float64 {
+	gap := 0.0
+	for i := 1; i < len(times); i++ {
+		gap = max(gap, times[i]-times[i-1])
+	}
+	return gap
+}
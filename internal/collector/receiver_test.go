@@ -0,0 +1,62 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestReceiverHistory(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("receiver.json", `{"version": "readsb", "refresh": 1000, "history": 4}`)
+	// rotated out of order; history_2 hasn't been written yet
+	write("history_0.json", `{"now": 1030, "aircraft": []}`)
+	write("history_1.json", `{"now": 1000, "aircraft": []}`)
+	write("history_3.json", `{"now": 1090, "aircraft": []}`)
+	path := filepath.Join(dir, "receiver.json")
+
+	reg := prometheus.NewRegistry()
+	c := New(reg, Options{})
+	if err := c.UpdateReceiverFromFile(path, false); err != nil {
+		t.Fatal(err)
+	}
+	const files = `
+# HELP adsb_receiver_history_files Number of history_N.json files the receiver keeps, from receiver.json
+# TYPE adsb_receiver_history_files gauge
+adsb_receiver_history_files 4
+`
+	names := []string{"adsb_receiver_history_files", "adsb_receiver_history_oldest_timestamp_seconds", "adsb_receiver_history_max_gap_seconds"}
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(files), names...); err != nil {
+		t.Error(err)
+	}
+
+	if err := c.UpdateReceiverFromFile(path, true); err != nil {
+		t.Fatal(err)
+	}
+	expected := files + `
+# HELP adsb_receiver_history_max_gap_seconds Longest interval between consecutive readable history files (only with history reading enabled)
+# TYPE adsb_receiver_history_max_gap_seconds gauge
+adsb_receiver_history_max_gap_seconds 60
+# HELP adsb_receiver_history_oldest_timestamp_seconds Unix time of the oldest readable history file (only with history reading enabled)
+# TYPE adsb_receiver_history_oldest_timestamp_seconds gauge
+adsb_receiver_history_oldest_timestamp_seconds 1000
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected), names...); err != nil {
+		t.Error(err)
+	}
+
+	c.ClearReceiver()
+	if n, err := testutil.GatherAndCount(reg, names...); err != nil || n != 0 {
+		t.Errorf("%d series after ClearReceiver (%v), want 0", n, err)
+	}
+}
@@ -0,0 +1,73 @@
+package collector
+
+import (
+	"slices"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RSSIBuckets are the upper bounds, in dBFS, of adsb_aircraft_rssi_distribution.
+var RSSIBuckets = []float64{-40, -35, -30, -25, -20, -15, -10, -5, 0}
+
+// strongestAircraft is the aircraft with the highest RSSI so far in a pass;
+// hex is empty until one has been seen.
+type strongestAircraft struct {
+	hex     string
+	rssi    float64
+	dist    float64
+	hasDist bool
+}
+
+// consider makes the aircraft the strongest if its rssi is higher than the
+// current one's. Of equal ones the lowest hex wins, so the choice doesn't
+// depend on file order.
+func (st *strongestAircraft) consider(hex string, rssi, dist float64, hasDist bool) {
+	if st.hex != "" && (rssi < st.rssi || rssi == st.rssi && hex >= st.hex) {
+		return
+	}
+	*st = strongestAircraft{hex: hex, rssi: rssi, dist: dist, hasDist: hasDist}
+}
+
+// appendRSSISummary appends the min, max, mean and median of rssi, the
+// strongest and weakest signal, the strongest aircraft's distance and, with
+// Options.RSSIHistogram, the histogram of rssi to ms. Nothing is appended
+// for an empty rssi. rssi is sorted in place.
+func (c *Collector) appendRSSISummary(ms []prometheus.Metric, rssi []float64, strongest strongestAircraft) []prometheus.Metric {
+	if len(rssi) == 0 {
+		return ms
+	}
+	m := c.aircraft
+	slices.Sort(rssi)
+	var sum float64
+	for _, v := range rssi {
+		sum += v
+	}
+	n := len(rssi)
+	median := rssi[n/2]
+	if n%2 == 0 {
+		median = (rssi[n/2-1] + rssi[n/2]) / 2
+	}
+	ms = append(ms,
+		prometheus.MustNewConstMetric(m.rssiMin, prometheus.GaugeValue, rssi[0]),
+		prometheus.MustNewConstMetric(m.rssiMax, prometheus.GaugeValue, rssi[n-1]),
+		prometheus.MustNewConstMetric(m.rssiMean, prometheus.GaugeValue, sum/float64(n)),
+		prometheus.MustNewConstMetric(m.rssiMedian, prometheus.GaugeValue, median),
+		prometheus.MustNewConstMetric(m.strongestRSSI, prometheus.GaugeValue, rssi[n-1]),
+		prometheus.MustNewConstMetric(m.weakestRSSI, prometheus.GaugeValue, rssi[0]))
+	if strongest.hasDist {
+		ms = append(ms, prometheus.MustNewConstMetric(m.strongestDistance, prometheus.GaugeValue, strongest.dist))
+	}
+	if !c.opts.RSSIHistogram {
+		return ms
+	}
+	buckets := make(map[float64]uint64, len(RSSIBuckets))
+	for _, le := range RSSIBuckets {
+		// rssi is sorted, so the count at or below le is where le would go
+		i, found := slices.BinarySearch(rssi, le)
+		for found && i < n && rssi[i] == le {
+			i++
+		}
+		buckets[le] = uint64(i)
+	}
+	return append(ms, prometheus.MustNewConstHistogram(m.rssiDistribution, uint64(n), sum, buckets))
+}
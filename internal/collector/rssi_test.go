@@ -0,0 +1,119 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRSSISummary(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aircraft.json")
+	write := func(data string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := New(prometheus.NewRegistry(), Options{RSSIHistogram: true})
+	names := []string{
+		"adsb_aircraft_rssi_min_dbfs",
+		"adsb_aircraft_rssi_max_dbfs",
+		"adsb_aircraft_rssi_mean_dbfs",
+		"adsb_aircraft_rssi_median_dbfs",
+		"adsb_aircraft_rssi_distribution",
+	}
+
+	// the -49.5 sentinel and the aircraft without rssi are left out
+	write(`{"now": 1700000010, "aircraft": [
+		{"hex": "aaaaaa", "rssi": -30},
+		{"hex": "bbbbbb", "rssi": -10},
+		{"hex": "cccccc", "rssi": -49.5},
+		{"hex": "dddddd", "rssi": -22},
+		{"hex": "eeeeee", "rssi": -6},
+		{"hex": "ffffff"}
+	]}`)
+	if err := c.UpdateAircraftsFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+	expected := `
+# HELP adsb_aircraft_rssi_distribution RSSI of the current aircraft with a recent signal (dBFS); rebuilt on every refresh, so not a counter to rate()
+# TYPE adsb_aircraft_rssi_distribution histogram
+adsb_aircraft_rssi_distribution_bucket{le="-40"} 0
+adsb_aircraft_rssi_distribution_bucket{le="-35"} 0
+adsb_aircraft_rssi_distribution_bucket{le="-30"} 1
+adsb_aircraft_rssi_distribution_bucket{le="-25"} 1
+adsb_aircraft_rssi_distribution_bucket{le="-20"} 2
+adsb_aircraft_rssi_distribution_bucket{le="-15"} 2
+adsb_aircraft_rssi_distribution_bucket{le="-10"} 3
+adsb_aircraft_rssi_distribution_bucket{le="-5"} 4
+adsb_aircraft_rssi_distribution_bucket{le="0"} 4
+adsb_aircraft_rssi_distribution_bucket{le="+Inf"} 4
+adsb_aircraft_rssi_distribution_sum -68
+adsb_aircraft_rssi_distribution_count 4
+# HELP adsb_aircraft_rssi_max_dbfs Highest RSSI of the current aircraft with a recent signal (dBFS)
+# TYPE adsb_aircraft_rssi_max_dbfs gauge
+adsb_aircraft_rssi_max_dbfs -6
+# HELP adsb_aircraft_rssi_mean_dbfs Mean RSSI of the current aircraft with a recent signal (dBFS)
+# TYPE adsb_aircraft_rssi_mean_dbfs gauge
+adsb_aircraft_rssi_mean_dbfs -17
+# HELP adsb_aircraft_rssi_median_dbfs Median RSSI of the current aircraft with a recent signal (dBFS)
+# TYPE adsb_aircraft_rssi_median_dbfs gauge
+adsb_aircraft_rssi_median_dbfs -16
+# HELP adsb_aircraft_rssi_min_dbfs Lowest RSSI of the current aircraft with a recent signal (dBFS)
+# TYPE adsb_aircraft_rssi_min_dbfs gauge
+adsb_aircraft_rssi_min_dbfs -30
+`
+	if err := testutil.CollectAndCompare(c.aircraft, strings.NewReader(expected), names...); err != nil {
+		t.Error(err)
+	}
+
+	// only the sentinel: nothing to summarise
+	write(`{"now": 1700000015, "aircraft": [{"hex": "cccccc", "rssi": -49.5}]}`)
+	if err := c.UpdateAircraftsFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if n := testutil.CollectAndCount(c.aircraft, names...); n != 0 {
+		t.Errorf("RSSI summary series without signals = %d, want 0", n)
+	}
+}
+
+func TestStrongestAndWeakestAircraft(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aircraft.json")
+	// bbbbbb and cccccc tie on RSSI and bbbbbb wins on hex; it is about
+	// 111 km north
+	data := `{"now": 1700000010, "aircraft": [
+		{"hex": "aaaaaa", "rssi": -30, "lat": 0, "lon": 0.5},
+		{"hex": "cccccc", "rssi": -4.5},
+		{"hex": "bbbbbb", "rssi": -4.5, "lat": 1, "lon": 0},
+		{"hex": "dddddd", "rssi": -49.5}
+	]}`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := New(prometheus.NewRegistry(), Options{Receiver: &Position{}})
+	if err := c.UpdateAircraftsFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+	expected := `
+# HELP adsb_receiver_strongest_aircraft_rssi_dbfs RSSI of the strongest current aircraft with a recent signal (dBFS)
+# TYPE adsb_receiver_strongest_aircraft_rssi_dbfs gauge
+adsb_receiver_strongest_aircraft_rssi_dbfs -4.5
+# HELP adsb_receiver_weakest_aircraft_rssi_dbfs RSSI of the weakest current aircraft with a recent signal (dBFS)
+# TYPE adsb_receiver_weakest_aircraft_rssi_dbfs gauge
+adsb_receiver_weakest_aircraft_rssi_dbfs -30
+`
+	if err := testutil.CollectAndCompare(c.aircraft, strings.NewReader(expected),
+		"adsb_receiver_strongest_aircraft_rssi_dbfs", "adsb_receiver_weakest_aircraft_rssi_dbfs"); err != nil {
+		t.Error(err)
+	}
+	if d := c.update.strongest; d.hex != "bbbbbb" || !d.hasDist || d.dist < 111 || d.dist > 111.4 {
+		t.Errorf("strongest aircraft = %+v, want bbbbbb at about 111.2 km", d)
+	}
+	if n := testutil.CollectAndCount(c.aircraft, "adsb_receiver_strongest_aircraft_distance_km"); n != 1 {
+		t.Errorf("strongest distance series = %d, want 1", n)
+	}
+}
@@ -0,0 +1,33 @@
+package collector
+
+// DefaultSessionGap is the Options.SessionGap used when none is set: five
+// minutes, longer than readsb keeps a silent aircraft in aircraft.json.
+const DefaultSessionGap = 300
+
+// session is an aircraft's current spell in coverage, as file now values.
+type session struct {
+	start, lastSeen float64
+}
+
+// appendSessionDurations adds adsb_aircraft_session_seconds to the aircraft
+// in u: the time since the first file of the hex's current session. A
+// session ends once the hex has been missing for more than
+// Options.SessionGap; it isn't affected by callsign changes. Sessions that
+// ended are dropped.
+func (c *Collector) appendSessionDurations(u *aircraftUpdate, now float64) {
+	for key, mc := range u.counts {
+		s, ok := c.sessions[key.hex]
+		if !ok || now-s.lastSeen > c.opts.SessionGap {
+			s.start = now
+		}
+		s.lastSeen = now
+		c.sessions[key.hex] = s
+		u.cur[key] = append(u.cur[key], aircraftGauge{desc: c.aircraft.sessionDuration, labels: mc.labels, value: max(now-s.start, 0)})
+		u.n++
+	}
+	for hex, s := range c.sessions {
+		if now-s.lastSeen > c.opts.SessionGap {
+			delete(c.sessions, hex)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package collector
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSessionDuration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aircraft.json")
+	c := New(prometheus.NewRegistry(), Options{SessionGap: 60})
+	for i, tt := range []struct {
+		now      float64
+		aircraft string
+		want     string
+	}{
+		{1000, `[{"hex": "aaaaaa", "flight": "ABC1"}]`, `
+adsb_aircraft_session_seconds{category="",flight="ABC1",hex="aaaaaa"} 0
+`},
+		{1030, `[{"hex": "aaaaaa", "flight": "ABC1"}, {"hex": "bbbbbb"}]`, `
+adsb_aircraft_session_seconds{category="",flight="ABC1",hex="aaaaaa"} 30
+adsb_aircraft_session_seconds{category="",flight="",hex="bbbbbb"} 0
+`},
+		// a callsign change keeps the session; bbbbbb drops out
+		{1060, `[{"hex": "aaaaaa", "flight": "ABC2"}]`, `
+adsb_aircraft_session_seconds{category="",flight="ABC2",hex="aaaaaa"} 60
+`},
+		// bbbbbb was gone 60s, within the gap, so it carries on
+		{1090, `[{"hex": "aaaaaa", "flight": "ABC2"}, {"hex": "bbbbbb"}]`, `
+adsb_aircraft_session_seconds{category="",flight="ABC2",hex="aaaaaa"} 90
+adsb_aircraft_session_seconds{category="",flight="",hex="bbbbbb"} 60
+`},
+		{1200, `[]`, ""},
+		// gone longer than the gap: a new session
+		{1200.5, `[{"hex": "aaaaaa", "flight": "ABC2"}]`, `
+adsb_aircraft_session_seconds{category="",flight="ABC2",hex="aaaaaa"} 0
+`},
+	} {
+		data := fmt.Sprintf(`{"now": %v, "aircraft": %s}`, tt.now, tt.aircraft)
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.UpdateAircraftsFromFile(path); err != nil {
+			t.Fatal(err)
+		}
+		expected := `
+# HELP adsb_aircraft_session_seconds Seconds since the aircraft's current spell in coverage began, by aircraft.json now
+# TYPE adsb_aircraft_session_seconds gauge
+` + strings.TrimPrefix(tt.want, "\n")
+		if err := testutil.CollectAndCompare(c.aircraft, strings.NewReader(expected), "adsb_aircraft_session_seconds"); err != nil {
+			t.Errorf("update %d: %v", i+1, err)
+		}
+	}
+	if len(c.sessions) != 1 {
+		t.Errorf("%d sessions kept, want 1 (bbbbbb's has ended)", len(c.sessions))
+	}
+}
@@ -0,0 +1,469 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// UpdateStatsFromFile parses the stats.json at path and applies every enabled
+// period.
+func (c *Collector) UpdateStatsFromFile(path string) error {
+	return c.UpdateStatsFromFileContext(context.Background(), path)
+}
+
+// UpdateStatsFromFileContext is UpdateStatsFromFile, except that nothing is
+// applied once ctx is done.
+func (c *Collector) UpdateStatsFromFileContext(ctx context.Context, path string) error {
+	b, err := safeReadFile(path)
+	if err != nil {
+		c.stats.up.Set(0)
+		return err
+	}
+	var s Stats
+	if err := json.Unmarshal(b, &s); err != nil {
+		c.stats.up.Set(0)
+		return fmt.Errorf("unmarshal stats: %w", err)
+	}
+	if err := c.lockApply(ctx); err != nil {
+		return err
+	}
+	defer c.applyMu.Unlock()
+	c.stats.up.Set(1)
+	c.storeParsedStats(path, &s)
+	c.detectTotalReset(&s.Total)
+	c.trackTotalEnd(&s.Total)
+	c.addTotalPositions(&s.Total)
+
+	for _, p := range []struct {
+		name   string
+		period *StatsPeriod
+	}{
+		{"latest", &s.Latest},
+		{"last1min", &s.Last1Min},
+		{"last5min", &s.Last5Min},
+		{"last15min", &s.Last15Min},
+		{"total", &s.Total},
+	} {
+		if c.periodEnabled(p.name) {
+			c.applyStatsPeriod(p.name, p.period)
+		}
+	}
+	return nil
+}
+
+// detectTotalReset counts a receiver restart: the total period's counters
+// start again from zero, so its message count goes backwards. A file without
+// a total period (end 0) is not compared.
+func (c *Collector) detectTotalReset(total *StatsPeriod) {
+	if total.End == 0 {
+		return
+	}
+	if total.Messages < c.prevTotalMessages {
+		c.stats.totalResets.Inc()
+	}
+	c.prevTotalMessages = total.Messages
+}
+
+// trackTotalEnd notes when the total period's end last advanced, for
+// adsb_stats_fresh. An end that stands still means readsb has stopped
+// updating the file even if something else keeps touching it. A file without
+// a total period (end 0) is ignored.
+func (c *Collector) trackTotalEnd(total *StatsPeriod) {
+	if total.End > c.prevTotalEnd {
+		c.prevTotalEnd = total.End
+		c.totalEndAdvanced.Store(c.now().UnixNano())
+	}
+}
+
+// statsFresh is adsb_stats_fresh: 1 if the total period's end advanced within
+// opts.StatsStaleAfter.
+func (c *Collector) statsFresh() float64 {
+	advanced := c.totalEndAdvanced.Load()
+	if advanced == 0 {
+		return 0
+	}
+	if c.now().Sub(time.Unix(0, advanced)).Seconds() > c.opts.StatsStaleAfter {
+		return 0
+	}
+	return 1
+}
+
+// periodEnabled reports whether the stats period name is exported.
+func (c *Collector) periodEnabled(name string) bool {
+	return len(c.opts.StatsPeriods) == 0 || slices.Contains(c.opts.StatsPeriods, name)
+}
+
+// ClearStats removes every per-period stats series, so the families go absent
+// until the next successful UpdateStatsFromFile. adsb_stats_up keeps
+// reporting the source as down meanwhile.
+func (c *Collector) ClearStats() {
+	c.applyMu.Lock()
+	defer c.applyMu.Unlock()
+	c.stats.reset()
+	clear(c.prevDFLabels)
+	clear(c.prevTrackKinds)
+	clear(c.prevLocalAccepted)
+	clear(c.prevRemoteAccepted)
+}
+
+func (c *Collector) applyStatsPeriod(name string, p *StatsPeriod) {
+	if p == nil {
+		return
+	}
+	m := c.stats
+	m.messages.WithLabelValues(name).Set(float64(p.Messages))
+	// a period missing from the file decodes as zero times
+	if p.End > 0 {
+		m.periodStart.WithLabelValues(name).Set(p.Start)
+		m.periodEnd.WithLabelValues(name).Set(p.End)
+	} else {
+		m.periodStart.DeleteLabelValues(name)
+		m.periodEnd.DeleteLabelValues(name)
+	}
+
+	// Local stats
+	var localAccepted *int64
+	if p.Local != nil {
+		m.localModes.WithLabelValues(name).Set(float64(p.Local.Modes))
+		m.localBad.WithLabelValues(name).Set(float64(p.Local.Bad))
+		m.localSamplesProcessed.WithLabelValues(name).Set(float64(p.Local.SamplesProcessed))
+		m.localSamplesDropped.WithLabelValues(name).Set(float64(p.Local.SamplesDropped))
+		m.localModeAC.WithLabelValues(name).Set(float64(p.Local.ModeAC))
+		m.localUnknownICAO.WithLabelValues(name).Set(float64(p.Local.UnknownICAO))
+
+		// Accepted messages - total and by error correction bits
+		sum, corrected := setAccepted(m.localAcceptedByErrors, m.localAcceptedTotal, c.prevLocalAccepted, name, p.Local.Accepted)
+		localAccepted = &sum
+		if sum > 0 {
+			m.localAcceptedCorrectedRatio.WithLabelValues(name).Set(float64(corrected) / float64(sum))
+		} else {
+			m.localAcceptedCorrectedRatio.DeleteLabelValues(name)
+		}
+
+		if p.Local.Signal != nil {
+			m.localSignal.WithLabelValues(name).Set(*p.Local.Signal)
+		}
+		if p.Local.Noise != nil {
+			m.localNoise.WithLabelValues(name).Set(*p.Local.Noise)
+		}
+		if p.Local.PeakSignal != nil {
+			m.localPeakSignal.WithLabelValues(name).Set(*p.Local.PeakSignal)
+		}
+		m.localStrongSignals.WithLabelValues(name).Set(float64(p.Local.StrongSignals))
+
+		if p.Local.GainDB != nil {
+			m.localGainDB.WithLabelValues(name).Set(*p.Local.GainDB)
+		}
+	}
+
+	// Of the Mode S messages demodulated, the share accepted and the share
+	// bad; left absent without any demodulated, or without accepted counts
+	var modes, bad int64
+	if p.Local != nil {
+		modes, bad = p.Local.Modes, p.Local.Bad
+	}
+	setRatio(m.localBadRatio, name, bad, modes)
+	if localAccepted != nil && len(p.Local.Accepted) > 0 {
+		setRatio(m.localAcceptRatio, name, *localAccepted, modes)
+	} else {
+		m.localAcceptRatio.DeleteLabelValues(name)
+	}
+
+	// Share of accepted messages above -3 dBFS, the usual gain-tuning
+	// figure (keep it under about 5%); absent without accepted messages
+	var strong, accepted int64
+	if localAccepted != nil {
+		strong, accepted = p.Local.StrongSignals, *localAccepted
+	}
+	setRatio(m.localStrongSignalRatio, name, strong, accepted)
+
+	// Signal over noise; both are dBFS, so the difference is in dB. Left
+	// absent unless the period has both.
+	var signal, peak, noise *float64
+	if p.Local != nil {
+		signal, peak, noise = p.Local.Signal, p.Local.PeakSignal, p.Local.Noise
+	}
+	setDifference(m.localSNR, name, signal, noise)
+	setDifference(m.localPeakSNR, name, peak, noise)
+
+	// Remote stats
+	if p.Remote != nil {
+		m.remoteModeAC.WithLabelValues(name).Set(float64(p.Remote.ModeAC))
+		m.remoteModes.WithLabelValues(name).Set(float64(p.Remote.Modes))
+		m.remoteBad.WithLabelValues(name).Set(float64(p.Remote.Bad))
+		m.remoteUnknownICAO.WithLabelValues(name).Set(float64(p.Remote.UnknownICAO))
+
+		setAccepted(m.remoteAcceptedByErrors, m.remoteAcceptedTotal, c.prevRemoteAccepted, name, p.Remote.Accepted)
+
+		if p.Remote.Signal != nil {
+			m.remoteSignal.WithLabelValues(name).Set(*p.Remote.Signal)
+		}
+		if p.Remote.Noise != nil {
+			m.remoteNoise.WithLabelValues(name).Set(*p.Remote.Noise)
+		}
+		if p.Remote.PeakSignal != nil {
+			m.remotePeakSignal.WithLabelValues(name).Set(*p.Remote.PeakSignal)
+		}
+		m.remoteStrongSignals.WithLabelValues(name).Set(float64(p.Remote.StrongSignals))
+
+		// network-only feeders report no samples or gain at all
+		if p.Remote.SamplesProcessed > 0 {
+			m.remoteSamplesProcessed.WithLabelValues(name).Set(float64(p.Remote.SamplesProcessed))
+			m.remoteSamplesDropped.WithLabelValues(name).Set(float64(p.Remote.SamplesDropped))
+		}
+		if p.Remote.GainDB != nil {
+			m.remoteGainDB.WithLabelValues(name).Set(*p.Remote.GainDB)
+		}
+	}
+
+	// readsb builds report the gain under either local or adaptive
+	switch {
+	case p.Local != nil && p.Local.GainDB != nil:
+		m.gainDB.WithLabelValues(name).Set(*p.Local.GainDB)
+	case p.Adaptive != nil && p.Adaptive.GainDB != nil:
+		m.gainDB.WithLabelValues(name).Set(*p.Adaptive.GainDB)
+	default:
+		m.gainDB.DeleteLabelValues(name)
+	}
+
+	// CPU metrics
+	if p.CPU != nil {
+		m.cpuDemod.WithLabelValues(name).Set(float64(p.CPU.Demod))
+		m.cpuReader.WithLabelValues(name).Set(float64(p.CPU.Reader))
+		m.cpuBackground.WithLabelValues(name).Set(float64(p.CPU.Background))
+	}
+
+	// CPR stats
+	if p.CPR != nil {
+		m.cprSurface.WithLabelValues(name).Set(float64(p.CPR.Surface))
+		m.cprAirborne.WithLabelValues(name).Set(float64(p.CPR.Airborne))
+		m.cprGlobalOk.WithLabelValues(name).Set(float64(p.CPR.GlobalOk))
+		m.cprGlobalBad.WithLabelValues(name).Set(float64(p.CPR.GlobalBad))
+		m.cprGlobalRange.WithLabelValues(name).Set(float64(p.CPR.GlobalRange))
+		m.cprGlobalSpeed.WithLabelValues(name).Set(float64(p.CPR.GlobalSpeed))
+		m.cprGlobalSkipped.WithLabelValues(name).Set(float64(p.CPR.GlobalSkipped))
+		m.cprLocalOk.WithLabelValues(name).Set(float64(p.CPR.LocalOk))
+		m.cprLocalAircraftRelative.WithLabelValues(name).Set(float64(p.CPR.LocalAircraftRel))
+		m.cprLocalReceiverRelative.WithLabelValues(name).Set(float64(p.CPR.LocalReceiverRel))
+		m.cprLocalSkipped.WithLabelValues(name).Set(float64(p.CPR.LocalSkipped))
+		m.cprLocalRange.WithLabelValues(name).Set(float64(p.CPR.LocalRange))
+		m.cprLocalSpeed.WithLabelValues(name).Set(float64(p.CPR.LocalSpeed))
+		m.cprFiltered.WithLabelValues(name).Set(float64(p.CPR.Filtered))
+	}
+	// Share of CPR decodes that succeeded, with skipped ones counted against
+	// it so the denominator covers every decode readsb reports
+	var globalOk, globalAll, localOk, localAll int64
+	if p.CPR != nil {
+		globalOk = p.CPR.GlobalOk
+		globalAll = globalOk + p.CPR.GlobalBad + p.CPR.GlobalRange + p.CPR.GlobalSpeed + p.CPR.GlobalSkipped
+		localOk = p.CPR.LocalOk
+		localAll = localOk + p.CPR.LocalRange + p.CPR.LocalSpeed + p.CPR.LocalSkipped
+	}
+	setRatio(m.cprGlobalSuccessRatio, name, globalOk, globalAll)
+	setRatio(m.cprLocalSuccessRatio, name, localOk, localAll)
+
+	// Positions decoded, global plus local
+	var positions *int64
+	if p.CPR != nil {
+		n := p.CPR.GlobalOk + p.CPR.LocalOk
+		positions = &n
+		m.positions.WithLabelValues(name).Set(float64(n))
+	} else {
+		m.positions.DeleteLabelValues(name)
+	}
+
+	// Rates over the period's length. Right after a restart latest may not
+	// have any length yet, so there's no rate.
+	length := p.End - p.Start
+	messages := int64(p.Messages)
+	setRate(m.messagesPerSecond, name, &messages, length)
+	setRate(m.localAcceptedPerSecond, name, localAccepted, length)
+	setRate(m.cprPositionsPerSecond, name, positions, length)
+	// CPU milliseconds over the period's, so 1 is one core busy throughout
+	var demod, reader, background *int64
+	if p.CPU != nil {
+		demod, reader, background = &p.CPU.Demod, &p.CPU.Reader, &p.CPU.Background
+	}
+	setRate(m.cpuDemodUtilization, name, demod, length*1000)
+	setRate(m.cpuReaderUtilization, name, reader, length*1000)
+	setRate(m.cpuBackgroundUtilization, name, background, length*1000)
+
+	// Tracks by kind: every key of the map, with kinds gone since the last
+	// pass deleted
+	kinds := make(map[string]struct{}, len(p.Tracks))
+	for kind, n := range p.Tracks {
+		kinds[kind] = struct{}{}
+		m.tracks.WithLabelValues(name, kind).Set(float64(n))
+	}
+	for _, kind := range c.prevTrackKinds.replace(name, kinds) {
+		m.tracks.DeleteLabelValues(name, kind)
+	}
+	// the per-kind metrics that predate adsb_stats_tracks
+	if p.Tracks != nil {
+		if all, ok := p.Tracks["all"]; ok {
+			m.tracksAll.WithLabelValues(name).Set(float64(all))
+		}
+		if single, ok := p.Tracks["single_message"]; ok {
+			m.tracksSingleMessage.WithLabelValues(name).Set(float64(single))
+		}
+		if unreliable, ok := p.Tracks["unreliable"]; ok {
+			m.tracksUnreliable.WithLabelValues(name).Set(float64(unreliable))
+		}
+	}
+
+	// Adaptive metrics
+	if p.Adaptive != nil {
+		if p.Adaptive.GainDB != nil {
+			m.adaptiveGainDB.WithLabelValues(name).Set(*p.Adaptive.GainDB)
+		}
+		if p.Adaptive.DynamicRangeLimitDB != nil {
+			m.adaptiveDynamicRangeLimitDB.WithLabelValues(name).Set(*p.Adaptive.DynamicRangeLimitDB)
+		}
+		if p.Adaptive.GainChanges != nil {
+			m.adaptiveGainChanges.WithLabelValues(name).Set(float64(*p.Adaptive.GainChanges))
+		}
+		if p.Adaptive.LoudUndecoded != nil {
+			m.adaptiveLoudUndecoded.WithLabelValues(name).Set(float64(*p.Adaptive.LoudUndecoded))
+		}
+		if p.Adaptive.LoudDecoded != nil {
+			m.adaptiveLoudDecoded.WithLabelValues(name).Set(float64(*p.Adaptive.LoudDecoded))
+		}
+		if p.Adaptive.NoiseDBFS != nil {
+			m.adaptiveNoiseDBFS.WithLabelValues(name).Set(*p.Adaptive.NoiseDBFS)
+		}
+	}
+
+	// Gain changes per minute, only over the fixed windows: latest is too
+	// short to say much and total spans readsb's whole run
+	var gainChanges *int64
+	if p.Adaptive != nil && windowedPeriod(name) {
+		gainChanges = p.Adaptive.GainChanges
+	}
+	setRate(m.adaptiveGainChangesPerMin, name, gainChanges, length/60)
+
+	// gain_seconds is rebuilt on every pass so steps that disappear are
+	// deleted; gathers can't observe the gap as they wait for applyMu.
+	m.adaptiveGainSeconds.DeletePartialMatch(prometheus.Labels{"period": name})
+	// the same time by gain, for histogram_quantile and heatmaps; steps
+	// with the same gain share its bucket
+	byGain := map[float64]float64{}
+	if p.Adaptive != nil {
+		for step, raw := range p.Adaptive.GainSeconds {
+			if _, err := strconv.Atoi(step); err != nil {
+				continue
+			}
+			g, secs, ok := parseGainStep(raw)
+			if !ok {
+				continue
+			}
+			m.adaptiveGainSeconds.WithLabelValues(name, step, strconv.FormatFloat(g, 'f', 1, 64)).Set(secs)
+			byGain[g] += secs
+		}
+	}
+	m.adaptiveGainDistribution.set(name, byGain)
+
+	// Messages by DF; indexes beyond a shorter array, and with
+	// MessagesByDFNonZeroOnly zero ones, are deleted
+	dfs := make(map[string]struct{}, len(p.MessagesByDF))
+	for i, v := range p.MessagesByDF {
+		if v == 0 && c.opts.MessagesByDFNonZeroOnly {
+			continue
+		}
+		df := strconv.Itoa(i)
+		dfs[df] = struct{}{}
+		m.messagesByDF.WithLabelValues(name, df).Set(float64(v))
+	}
+	for _, df := range c.prevDFLabels.replace(name, dfs) {
+		m.messagesByDF.DeleteLabelValues(name, df)
+	}
+}
+
+// setAccepted sets the accepted total and per-error-count gauges for period
+// from accepted, deleting errors labels past the end of a shorter array. An
+// empty array still sets the total, to 0. It returns the total and the part
+// of it that needed error correction.
+func setAccepted(byErrors, total *prometheus.GaugeVec, prev labelSets, period string, accepted []int64) (sum, corrected int64) {
+	cur := make(map[string]struct{}, len(accepted))
+	for i, count := range accepted {
+		sum += count
+		if i > 0 {
+			corrected += count
+		}
+		errs := strconv.Itoa(i)
+		cur[errs] = struct{}{}
+		byErrors.WithLabelValues(period, errs).Set(float64(count))
+	}
+	total.WithLabelValues(period).Set(float64(sum))
+	for _, errs := range prev.replace(period, cur) {
+		byErrors.DeleteLabelValues(period, errs)
+	}
+	return sum, corrected
+}
+
+// setDifference sets g for period to a-b, or deletes it unless both are
+// present.
+func setDifference(g *prometheus.GaugeVec, period string, a, b *float64) {
+	if a == nil || b == nil {
+		g.DeleteLabelValues(period)
+		return
+	}
+	g.WithLabelValues(period).Set(*a - *b)
+}
+
+// addTotalPositions advances adsb_stats_positions_decoded_total to the
+// positions decoded in the total period, as addFileMessages does for
+// aircraft.json messages: a count going backwards means readsb restarted and
+// has decoded that many since. Like detectTotalReset it reads the total
+// period whether or not it is exported. A total without cpr is ignored.
+func (c *Collector) addTotalPositions(total *StatsPeriod) {
+	if total.CPR == nil {
+		return
+	}
+	n := total.CPR.GlobalOk + total.CPR.LocalOk
+	delta := n - c.prevTotalPositions
+	if delta < 0 {
+		delta = n
+	}
+	c.stats.positionsDecoded.Add(float64(delta))
+	c.prevTotalPositions = n
+}
+
+// windowedPeriod reports whether period is one of the fixed-length windows.
+func windowedPeriod(period string) bool {
+	return period == "last1min" || period == "last5min" || period == "last15min"
+}
+
+// setRatio sets g for period to n over of, or deletes it if of is zero.
+func setRatio(g *prometheus.GaugeVec, period string, n, of int64) {
+	if of == 0 {
+		g.DeleteLabelValues(period)
+		return
+	}
+	g.WithLabelValues(period).Set(float64(n) / float64(of))
+}
+
+// setRate sets g for period to count per second over length, or deletes it
+// unless count is present and length positive.
+func setRate(g *prometheus.GaugeVec, period string, count *int64, length float64) {
+	if count == nil || length <= 0 {
+		g.DeleteLabelValues(period)
+		return
+	}
+	g.WithLabelValues(period).Set(float64(*count) / length)
+}
+
+// parseGainStep decodes one gain_seconds entry, [gain_db, seconds]. Anything
+// else is reported as malformed.
+func parseGainStep(raw json.RawMessage) (gainDB, seconds float64, ok bool) {
+	var v []float64
+	if err := json.Unmarshal(raw, &v); err != nil || len(v) != 2 {
+		return 0, 0, false
+	}
+	return v[0], v[1], true
+}
@@ -0,0 +1,719 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestUpdateStatsFromFile(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	c := New(reg, Options{})
+	if err := c.UpdateStatsFromFile("testdata/stats.json"); err != nil {
+		t.Fatalf("UpdateStatsFromFile: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"adsb_stats_messages_total", `
+# HELP adsb_stats_messages_total Number of messages for given stats period
+# TYPE adsb_stats_messages_total gauge
+adsb_stats_messages_total{period="last15min"} 31200
+adsb_stats_messages_total{period="last1min"} 2100
+adsb_stats_messages_total{period="last5min"} 10500
+adsb_stats_messages_total{period="latest"} 300
+adsb_stats_messages_total{period="total"} 901234
+`},
+		{"adsb_stats_period_end_seconds", `
+# HELP adsb_stats_period_end_seconds Unix time the stats period ends
+# TYPE adsb_stats_period_end_seconds gauge
+adsb_stats_period_end_seconds{period="last15min"} 1.70000001e+09
+adsb_stats_period_end_seconds{period="last1min"} 1.70000001e+09
+adsb_stats_period_end_seconds{period="last5min"} 1.70000001e+09
+adsb_stats_period_end_seconds{period="latest"} 1.70000001e+09
+adsb_stats_period_end_seconds{period="total"} 1.70000001e+09
+`},
+		{"adsb_stats_local_accepted_by_errors", `
+# HELP adsb_stats_local_accepted_by_errors Number of accepted messages by error correction bits
+# TYPE adsb_stats_local_accepted_by_errors gauge
+adsb_stats_local_accepted_by_errors{errors="0",period="latest"} 280
+adsb_stats_local_accepted_by_errors{errors="1",period="latest"} 20
+`},
+		{"adsb_stats_local_accepted_total", `
+# HELP adsb_stats_local_accepted_total Total number of accepted messages
+# TYPE adsb_stats_local_accepted_total gauge
+adsb_stats_local_accepted_total{period="latest"} 300
+`},
+		{"adsb_stats_remote_accepted_total", `
+# HELP adsb_stats_remote_accepted_total Total number of accepted remote messages
+# TYPE adsb_stats_remote_accepted_total gauge
+adsb_stats_remote_accepted_total{period="last1min"} 900
+`},
+		{"adsb_stats_local_signal_dbfs", `
+# HELP adsb_stats_local_signal_dbfs Mean signal power (dBFS)
+# TYPE adsb_stats_local_signal_dbfs gauge
+adsb_stats_local_signal_dbfs{period="latest"} -20.5
+`},
+		{"adsb_stats_cpr_global_ok_total", `
+# HELP adsb_stats_cpr_global_ok_total Global positions successfully derived
+# TYPE adsb_stats_cpr_global_ok_total gauge
+adsb_stats_cpr_global_ok_total{period="latest"} 15
+`},
+		{"adsb_stats_tracks_unreliable_total", `
+# HELP adsb_stats_tracks_unreliable_total Tracks never marked as reliable (deprecated: adsb_stats_tracks{kind="unreliable"})
+# TYPE adsb_stats_tracks_unreliable_total gauge
+adsb_stats_tracks_unreliable_total{period="latest"} 2
+`},
+		{"adsb_stats_tracks", `
+# HELP adsb_stats_tracks Tracks by kind, one series per key of the stats period's tracks object
+# TYPE adsb_stats_tracks gauge
+adsb_stats_tracks{kind="all",period="latest"} 5
+adsb_stats_tracks{kind="single_message",period="latest"} 1
+adsb_stats_tracks{kind="unreliable",period="latest"} 2
+`},
+		{"adsb_stats_adaptive_gain_seconds", `
+# HELP adsb_stats_adaptive_gain_seconds Number of seconds spent at a given adaptive gain step
+# TYPE adsb_stats_adaptive_gain_seconds gauge
+adsb_stats_adaptive_gain_seconds{gain_db="49.6",gain_step="20",period="last1min"} 60
+`},
+		{"adsb_stats_messages_by_df", `
+# HELP adsb_stats_messages_by_df Messages per DF for a given period
+# TYPE adsb_stats_messages_by_df gauge
+adsb_stats_messages_by_df{df="0",period="latest"} 0
+adsb_stats_messages_by_df{df="1",period="latest"} 0
+adsb_stats_messages_by_df{df="10",period="latest"} 0
+adsb_stats_messages_by_df{df="11",period="latest"} 160
+adsb_stats_messages_by_df{df="12",period="latest"} 0
+adsb_stats_messages_by_df{df="13",period="latest"} 0
+adsb_stats_messages_by_df{df="14",period="latest"} 0
+adsb_stats_messages_by_df{df="15",period="latest"} 0
+adsb_stats_messages_by_df{df="16",period="latest"} 0
+adsb_stats_messages_by_df{df="17",period="latest"} 125
+adsb_stats_messages_by_df{df="2",period="latest"} 0
+adsb_stats_messages_by_df{df="3",period="latest"} 0
+adsb_stats_messages_by_df{df="4",period="latest"} 10
+adsb_stats_messages_by_df{df="5",period="latest"} 5
+adsb_stats_messages_by_df{df="6",period="latest"} 0
+adsb_stats_messages_by_df{df="7",period="latest"} 0
+adsb_stats_messages_by_df{df="8",period="latest"} 0
+adsb_stats_messages_by_df{df="9",period="latest"} 0
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := testutil.GatherAndCompare(reg, strings.NewReader(tt.expected), tt.name); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestUpdateStatsFromFileErrors(t *testing.T) {
+	for _, path := range []string{"testdata/missing.json", "testdata/invalid.json"} {
+		c := New(prometheus.NewRegistry(), Options{})
+		if err := c.UpdateStatsFromFile(path); err == nil {
+			t.Errorf("UpdateStatsFromFile(%q) succeeded, want error", path)
+		}
+		if s, _ := c.ParsedStats(); s != nil {
+			t.Errorf("ParsedStats after failed load of %q = %v, want nil", path, s)
+		}
+	}
+}
+
+func TestStatsDisappears(t *testing.T) {
+	b, err := os.ReadFile("testdata/stats.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "stats.json")
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := New(prometheus.NewRegistry(), Options{})
+	if err := c.UpdateStatsFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if up := testutil.ToFloat64(c.stats.up); up != 1 {
+		t.Errorf("adsb_stats_up = %v, want 1", up)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.UpdateStatsFromFile(path); err == nil {
+		t.Fatal("UpdateStatsFromFile succeeded on missing file")
+	}
+	if up := testutil.ToFloat64(c.stats.up); up != 0 {
+		t.Errorf("adsb_stats_up after missing file = %v, want 0", up)
+	}
+	if n := testutil.CollectAndCount(c.stats.messages); n != 5 {
+		t.Errorf("messages series kept during grace = %d, want 5", n)
+	}
+	c.ClearStats()
+	if n := testutil.CollectAndCount(c.stats.messages); n != 0 {
+		t.Errorf("messages series after clear = %d, want 0", n)
+	}
+
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.UpdateStatsFromFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if up := testutil.ToFloat64(c.stats.up); up != 1 {
+		t.Errorf("adsb_stats_up after recovery = %v, want 1", up)
+	}
+	if n := testutil.CollectAndCount(c.stats.messages); n != 5 {
+		t.Errorf("messages series after recovery = %d, want 5", n)
+	}
+}
+
+func TestMessagesByDFShrinks(t *testing.T) {
+	c := New(prometheus.NewRegistry(), Options{})
+	c.applyStatsPeriod("latest", &StatsPeriod{MessagesByDF: []int{1, 2, 3}})
+	c.applyStatsPeriod("total", &StatsPeriod{MessagesByDF: []int{4, 5, 6}})
+	c.applyStatsPeriod("latest", &StatsPeriod{MessagesByDF: []int{7}})
+
+	expected := `
+# HELP adsb_stats_messages_by_df Messages per DF for a given period
+# TYPE adsb_stats_messages_by_df gauge
+adsb_stats_messages_by_df{df="0",period="latest"} 7
+adsb_stats_messages_by_df{df="0",period="total"} 4
+adsb_stats_messages_by_df{df="1",period="total"} 5
+adsb_stats_messages_by_df{df="2",period="total"} 6
+`
+	if err := testutil.CollectAndCompare(c.stats.messagesByDF, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMessagesByDFNonZeroOnly(t *testing.T) {
+	c := New(prometheus.NewRegistry(), Options{MessagesByDFNonZeroOnly: true})
+	c.applyStatsPeriod("latest", &StatsPeriod{MessagesByDF: []int{3, 0, 0, 0, 8}})
+	// DF 4 drops to zero, DF 1 appears
+	c.applyStatsPeriod("latest", &StatsPeriod{MessagesByDF: []int{5, 2, 0, 0, 0}})
+
+	expected := `
+# HELP adsb_stats_messages_by_df Messages per DF for a given period
+# TYPE adsb_stats_messages_by_df gauge
+adsb_stats_messages_by_df{df="0",period="latest"} 5
+adsb_stats_messages_by_df{df="1",period="latest"} 2
+`
+	if err := testutil.CollectAndCompare(c.stats.messagesByDF, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTotalResets(t *testing.T) {
+	c := New(prometheus.NewRegistry(), Options{})
+	for i, tt := range []struct {
+		total StatsPeriod
+		want  float64
+	}{
+		{StatsPeriod{End: 100, Messages: 1000}, 0},
+		{StatsPeriod{End: 160, Messages: 1500}, 0},
+		// readsb restarted
+		{StatsPeriod{End: 220, Messages: 20}, 1},
+		{StatsPeriod{End: 280, Messages: 600}, 1},
+		// no total period at all: not compared
+		{StatsPeriod{}, 1},
+		{StatsPeriod{End: 340, Messages: 10}, 2},
+	} {
+		c.detectTotalReset(&tt.total)
+		if got := testutil.ToFloat64(c.stats.totalResets); got != tt.want {
+			t.Errorf("update %d: adsb_stats_total_resets_total = %v, want %v", i, got, tt.want)
+		}
+	}
+}
+
+func TestStatsFresh(t *testing.T) {
+	c := New(prometheus.NewRegistry(), Options{StatsStaleAfter: 100})
+	now := time.Unix(1000, 0)
+	c.now = func() time.Time { return now }
+	if got := testutil.ToFloat64(c.stats.fresh); got != 0 {
+		t.Errorf("before any stats: adsb_stats_fresh = %v, want 0", got)
+	}
+	for i, tt := range []struct {
+		elapsed time.Duration
+		end     float64
+		want    float64
+	}{
+		{0, 1000, 1},
+		{60 * time.Second, 1060, 1},
+		// the file is rewritten, or just touched, with the same end
+		{60 * time.Second, 1060, 1},
+		{41 * time.Second, 1060, 0},
+		// no total period at all: not an advance
+		{0, 0, 0},
+		{10 * time.Second, 1170, 1},
+	} {
+		now = now.Add(tt.elapsed)
+		c.trackTotalEnd(&StatsPeriod{End: tt.end})
+		if got := testutil.ToFloat64(c.stats.fresh); got != tt.want {
+			t.Errorf("update %d: adsb_stats_fresh = %v, want %v", i, got, tt.want)
+		}
+	}
+}
+
+func TestStatsRates(t *testing.T) {
+	c := New(prometheus.NewRegistry(), Options{})
+	c.applyStatsPeriod("latest", &StatsPeriod{
+		Start: 1000, End: 1010, Messages: 300,
+		Local: &LocalStats{Accepted: []int64{250, 20}},
+		CPR:   &CPRStats{GlobalOk: 12, LocalOk: 3},
+		CPU:   &CPUStats{Demod: 8000, Reader: 500, Background: 12000},
+	})
+	// a period with no accepted or CPR stats at all
+	c.applyStatsPeriod("last1min", &StatsPeriod{Start: 950, End: 1010, Messages: 2100})
+	// just after a restart
+	c.applyStatsPeriod("total", &StatsPeriod{Start: 1010, End: 1010, Local: &LocalStats{}})
+
+	expected := `
+# HELP adsb_stats_cpu_background_utilization Share of one CPU core spent in background processing over the period (can exceed 1)
+# TYPE adsb_stats_cpu_background_utilization gauge
+adsb_stats_cpu_background_utilization{period="latest"} 1.2
+# HELP adsb_stats_cpu_demod_utilization Share of one CPU core spent doing demodulation over the period (can exceed 1)
+# TYPE adsb_stats_cpu_demod_utilization gauge
+adsb_stats_cpu_demod_utilization{period="latest"} 0.8
+# HELP adsb_stats_cpu_reader_utilization Share of one CPU core spent reading samples from SDR over the period (can exceed 1)
+# TYPE adsb_stats_cpu_reader_utilization gauge
+adsb_stats_cpu_reader_utilization{period="latest"} 0.05
+# HELP adsb_stats_cpr_positions_per_second Positions decoded (global_ok plus local_ok) per second over the stats period
+# TYPE adsb_stats_cpr_positions_per_second gauge
+adsb_stats_cpr_positions_per_second{period="latest"} 1.5
+# HELP adsb_stats_local_accepted_per_second Accepted local messages per second over the stats period
+# TYPE adsb_stats_local_accepted_per_second gauge
+adsb_stats_local_accepted_per_second{period="latest"} 27
+# HELP adsb_stats_messages_per_second Messages per second over the stats period
+# TYPE adsb_stats_messages_per_second gauge
+adsb_stats_messages_per_second{period="last1min"} 35
+adsb_stats_messages_per_second{period="latest"} 30
+`
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(c.stats.messagesPerSecond, c.stats.localAcceptedPerSecond, c.stats.cprPositionsPerSecond,
+		c.stats.cpuDemodUtilization, c.stats.cpuReaderUtilization, c.stats.cpuBackgroundUtilization)
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAcceptedByErrorsShrinks(t *testing.T) {
+	c := New(prometheus.NewRegistry(), Options{})
+	c.applyStatsPeriod("latest", &StatsPeriod{
+		Local:  &LocalStats{Accepted: []int64{100, 20, 3}},
+		Remote: &RemoteStats{Accepted: []int64{50, 5, 1}},
+	})
+	c.applyStatsPeriod("latest", &StatsPeriod{
+		Local:  &LocalStats{Accepted: []int64{90}},
+		Remote: &RemoteStats{},
+	})
+
+	expected := `
+# HELP adsb_stats_local_accepted_by_errors Number of accepted messages by error correction bits
+# TYPE adsb_stats_local_accepted_by_errors gauge
+adsb_stats_local_accepted_by_errors{errors="0",period="latest"} 90
+# HELP adsb_stats_local_accepted_total Total number of accepted messages
+# TYPE adsb_stats_local_accepted_total gauge
+adsb_stats_local_accepted_total{period="latest"} 90
+# HELP adsb_stats_remote_accepted_total Total number of accepted remote messages
+# TYPE adsb_stats_remote_accepted_total gauge
+adsb_stats_remote_accepted_total{period="latest"} 0
+`
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(c.stats.localAcceptedByErrors, c.stats.localAcceptedTotal,
+		c.stats.remoteAcceptedByErrors, c.stats.remoteAcceptedTotal)
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAcceptedCorrectedRatio(t *testing.T) {
+	c := New(prometheus.NewRegistry(), Options{})
+	c.applyStatsPeriod("latest", &StatsPeriod{Local: &LocalStats{Accepted: []int64{75, 20, 5}}})
+	c.applyStatsPeriod("total", &StatsPeriod{Local: &LocalStats{Accepted: []int64{10}}})
+	c.applyStatsPeriod("last1min", &StatsPeriod{Local: &LocalStats{Accepted: []int64{4, 4}}})
+	// nothing accepted: no ratio
+	c.applyStatsPeriod("last1min", &StatsPeriod{Local: &LocalStats{}})
+
+	expected := `
+# HELP adsb_stats_local_accepted_corrected_ratio Fraction of accepted messages that needed one or more bit errors corrected
+# TYPE adsb_stats_local_accepted_corrected_ratio gauge
+adsb_stats_local_accepted_corrected_ratio{period="latest"} 0.25
+adsb_stats_local_accepted_corrected_ratio{period="total"} 0
+`
+	if err := testutil.CollectAndCompare(c.stats.localAcceptedCorrectedRatio, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCPRSuccessRatios(t *testing.T) {
+	c := New(prometheus.NewRegistry(), Options{})
+	c.applyStatsPeriod("latest", &StatsPeriod{CPR: &CPRStats{
+		GlobalOk: 15, GlobalBad: 1, GlobalRange: 2, GlobalSpeed: 2, GlobalSkipped: 30,
+		LocalOk: 6, LocalAircraftRel: 4, LocalReceiverRel: 2, LocalRange: 1, LocalSkipped: 1,
+	}})
+	c.applyStatsPeriod("total", &StatsPeriod{CPR: &CPRStats{GlobalOk: 8, LocalSkipped: 5}})
+	// nothing decoded, then no cpr section at all: no ratio
+	c.applyStatsPeriod("last1min", &StatsPeriod{CPR: &CPRStats{GlobalOk: 1, LocalOk: 1}})
+	c.applyStatsPeriod("last1min", &StatsPeriod{CPR: &CPRStats{Filtered: 4}})
+	c.applyStatsPeriod("last5min", &StatsPeriod{CPR: &CPRStats{GlobalOk: 1, LocalOk: 1}})
+	c.applyStatsPeriod("last5min", &StatsPeriod{})
+
+	expected := `
+# HELP adsb_stats_cpr_global_success_ratio Share of global CPR decodes that succeeded: global_ok over global_ok, global_bad, global_range, global_speed and global_skipped
+# TYPE adsb_stats_cpr_global_success_ratio gauge
+adsb_stats_cpr_global_success_ratio{period="latest"} 0.3
+adsb_stats_cpr_global_success_ratio{period="total"} 1
+# HELP adsb_stats_cpr_local_success_ratio Share of local CPR decodes that succeeded: local_ok over local_ok, local_range, local_speed and local_skipped
+# TYPE adsb_stats_cpr_local_success_ratio gauge
+adsb_stats_cpr_local_success_ratio{period="latest"} 0.75
+adsb_stats_cpr_local_success_ratio{period="total"} 0
+`
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(c.stats.cprGlobalSuccessRatio, c.stats.cprLocalSuccessRatio)
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLocalDecodeRatios(t *testing.T) {
+	c := New(prometheus.NewRegistry(), Options{})
+	c.applyStatsPeriod("latest", &StatsPeriod{Local: &LocalStats{Modes: 400, Bad: 100, Accepted: []int64{280, 20}}})
+	// no accepted counts: only the bad ratio
+	c.applyStatsPeriod("last1min", &StatsPeriod{Local: &LocalStats{Modes: 50, Bad: 5}})
+	// nothing demodulated, then no local section at all: no ratios
+	c.applyStatsPeriod("last5min", &StatsPeriod{Local: &LocalStats{Modes: 10, Bad: 1, Accepted: []int64{9}}})
+	c.applyStatsPeriod("last5min", &StatsPeriod{Local: &LocalStats{Accepted: []int64{0}}})
+	c.applyStatsPeriod("total", &StatsPeriod{Local: &LocalStats{Modes: 10, Bad: 1, Accepted: []int64{9}}})
+	c.applyStatsPeriod("total", &StatsPeriod{})
+
+	expected := `
+# HELP adsb_stats_local_accept_ratio Share of the local Mode S messages demodulated that were accepted: accepted over modes
+# TYPE adsb_stats_local_accept_ratio gauge
+adsb_stats_local_accept_ratio{period="latest"} 0.75
+# HELP adsb_stats_local_bad_ratio Share of the local Mode S messages demodulated that were bad: bad over modes
+# TYPE adsb_stats_local_bad_ratio gauge
+adsb_stats_local_bad_ratio{period="last1min"} 0.1
+adsb_stats_local_bad_ratio{period="latest"} 0.25
+`
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(c.stats.localAcceptRatio, c.stats.localBadRatio)
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLocalStrongSignalRatio(t *testing.T) {
+	c := New(prometheus.NewRegistry(), Options{})
+	c.applyStatsPeriod("latest", &StatsPeriod{Local: &LocalStats{StrongSignals: 15, Accepted: []int64{280, 20}}})
+	// no accepted counts, nothing accepted, then no local section: absent
+	c.applyStatsPeriod("last1min", &StatsPeriod{Local: &LocalStats{StrongSignals: 3}})
+	c.applyStatsPeriod("last5min", &StatsPeriod{Local: &LocalStats{StrongSignals: 3, Accepted: []int64{0, 0}}})
+	c.applyStatsPeriod("total", &StatsPeriod{Local: &LocalStats{StrongSignals: 1, Accepted: []int64{9, 1}}})
+	c.applyStatsPeriod("total", &StatsPeriod{})
+
+	expected := `
+# HELP adsb_stats_local_strong_signal_ratio Share of the local accepted messages stronger than -3 dBFS: strong_signals over accepted
+# TYPE adsb_stats_local_strong_signal_ratio gauge
+adsb_stats_local_strong_signal_ratio{period="latest"} 0.05
+`
+	if err := testutil.CollectAndCompare(c.stats.localStrongSignalRatio, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAdaptiveGainChangesPerMinute(t *testing.T) {
+	c := New(prometheus.NewRegistry(), Options{})
+	changes := func(n int64) *AdaptiveStats { return &AdaptiveStats{GainChanges: &n} }
+	c.applyStatsPeriod("last5min", &StatsPeriod{Start: 700, End: 1000, Adaptive: changes(15)})
+	// not a fixed window
+	c.applyStatsPeriod("latest", &StatsPeriod{Start: 990, End: 1000, Adaptive: changes(1)})
+	c.applyStatsPeriod("total", &StatsPeriod{Start: 0, End: 1000, Adaptive: changes(40)})
+	// no length, then no changes reported
+	c.applyStatsPeriod("last1min", &StatsPeriod{Start: 1000, End: 1000, Adaptive: changes(2)})
+	c.applyStatsPeriod("last15min", &StatsPeriod{Start: 100, End: 1000, Adaptive: changes(3)})
+	c.applyStatsPeriod("last15min", &StatsPeriod{Start: 100, End: 1000, Adaptive: &AdaptiveStats{}})
+
+	expected := `
+# HELP adsb_stats_adaptive_gain_changes_per_minute Adaptive gain changes per minute over the period; only for last1min, last5min and last15min
+# TYPE adsb_stats_adaptive_gain_changes_per_minute gauge
+adsb_stats_adaptive_gain_changes_per_minute{period="last5min"} 3
+`
+	if err := testutil.CollectAndCompare(c.stats.adaptiveGainChangesPerMin, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTracksKindsVanish(t *testing.T) {
+	c := New(prometheus.NewRegistry(), Options{})
+	c.applyStatsPeriod("latest", &StatsPeriod{Tracks: map[string]int{"all": 5, "mlat_position": 2}})
+	c.applyStatsPeriod("total", &StatsPeriod{Tracks: map[string]int{"all": 50}})
+	c.applyStatsPeriod("latest", &StatsPeriod{Tracks: map[string]int{"all": 6, "tisb_position": 1}})
+	c.applyStatsPeriod("total", &StatsPeriod{})
+
+	expected := `
+# HELP adsb_stats_tracks Tracks by kind, one series per key of the stats period's tracks object
+# TYPE adsb_stats_tracks gauge
+adsb_stats_tracks{kind="all",period="latest"} 6
+adsb_stats_tracks{kind="tisb_position",period="latest"} 1
+`
+	if err := testutil.CollectAndCompare(c.stats.tracks, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPositions(t *testing.T) {
+	c := New(prometheus.NewRegistry(), Options{})
+	c.applyStatsPeriod("latest", &StatsPeriod{CPR: &CPRStats{GlobalOk: 12, LocalOk: 3, LocalAircraftRel: 2, LocalReceiverRel: 1}})
+	c.applyStatsPeriod("last1min", &StatsPeriod{CPR: &CPRStats{GlobalOk: 1}})
+	c.applyStatsPeriod("last1min", &StatsPeriod{})
+	for i, tt := range []struct {
+		globalOk, localOk int64
+		want              float64
+	}{
+		{900, 100, 1000},
+		{1400, 100, 1500},
+		// readsb restarted and has decoded 30 since
+		{20, 10, 1530},
+		{50, 10, 1560},
+	} {
+		total := &StatsPeriod{CPR: &CPRStats{GlobalOk: tt.globalOk, LocalOk: tt.localOk}}
+		c.applyStatsPeriod("total", total)
+		c.addTotalPositions(total)
+		if got := testutil.ToFloat64(c.stats.positionsDecoded); got != tt.want {
+			t.Errorf("update %d: adsb_stats_positions_decoded_total = %v, want %v", i, got, tt.want)
+		}
+	}
+
+	expected := `
+# HELP adsb_stats_positions_total Positions decoded in the stats period: cpr global_ok plus local_ok
+# TYPE adsb_stats_positions_total gauge
+adsb_stats_positions_total{period="latest"} 15
+adsb_stats_positions_total{period="total"} 60
+`
+	if err := testutil.CollectAndCompare(c.stats.positions, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAdaptiveGainDistribution(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	c := New(reg, Options{})
+	// steps out of order and with gaps; 38 repeats 37's gain
+	c.applyStatsPeriod("last15min", &StatsPeriod{Adaptive: &AdaptiveStats{GainSeconds: map[string]json.RawMessage{
+		"37":  json.RawMessage(`[49.6, 300.4]`),
+		"5":   json.RawMessage(`[7.7, 60]`),
+		"38":  json.RawMessage(`[49.6, 100.3]`),
+		"20":  json.RawMessage(`[33.8, 439.3]`),
+		"bad": json.RawMessage(`[1, 1]`),
+	}}})
+	c.applyStatsPeriod("latest", &StatsPeriod{Adaptive: &AdaptiveStats{GainSeconds: map[string]json.RawMessage{
+		"20": json.RawMessage(`[33.8, 10]`),
+	}}})
+	c.applyStatsPeriod("latest", &StatsPeriod{Adaptive: &AdaptiveStats{}})
+
+	expected := `
+# HELP adsb_stats_adaptive_gain_distribution Seconds spent at each adaptive gain (dB) in the period, as a histogram: le is the gain and counts are whole seconds
+# TYPE adsb_stats_adaptive_gain_distribution histogram
+adsb_stats_adaptive_gain_distribution_bucket{period="last15min",le="7.7"} 60
+adsb_stats_adaptive_gain_distribution_bucket{period="last15min",le="33.8"} 499
+adsb_stats_adaptive_gain_distribution_bucket{period="last15min",le="49.6"} 900
+adsb_stats_adaptive_gain_distribution_bucket{period="last15min",le="+Inf"} 900
+adsb_stats_adaptive_gain_distribution_sum{period="last15min"} 35185.06
+adsb_stats_adaptive_gain_distribution_count{period="last15min"} 900
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected), "adsb_stats_adaptive_gain_distribution"); err != nil {
+		t.Error(err)
+	}
+	c.ClearStats()
+	if n, err := testutil.GatherAndCount(reg, "adsb_stats_adaptive_gain_distribution"); err != nil || n != 0 {
+		t.Errorf("%d histograms after ClearStats (%v), want 0", n, err)
+	}
+}
+
+func TestLocalSNR(t *testing.T) {
+	c := New(prometheus.NewRegistry(), Options{})
+	signal, peak, noise := -12.5, -2.0, -33.0
+	c.applyStatsPeriod("latest", &StatsPeriod{Local: &LocalStats{Signal: &signal, PeakSignal: &peak, Noise: &noise}})
+	c.applyStatsPeriod("total", &StatsPeriod{Local: &LocalStats{Signal: &signal, PeakSignal: &peak, Noise: &noise}})
+	// no noise this time, then no local section at all
+	c.applyStatsPeriod("latest", &StatsPeriod{Local: &LocalStats{Signal: &signal, PeakSignal: &peak}})
+	c.applyStatsPeriod("total", &StatsPeriod{})
+	c.applyStatsPeriod("last1min", &StatsPeriod{Local: &LocalStats{Signal: &signal, Noise: &noise}})
+
+	expected := `
+# HELP adsb_stats_local_snr_db Mean signal power over mean noise power (dB)
+# TYPE adsb_stats_local_snr_db gauge
+adsb_stats_local_snr_db{period="last1min"} 20.5
+`
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(c.stats.localSNR, c.stats.localPeakSNR)
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestParseGainStep(t *testing.T) {
+	tests := []struct {
+		raw     string
+		gain    float64
+		seconds float64
+		ok      bool
+	}{
+		{`[49.6, 60]`, 49.6, 60, true},
+		{`[49.60000000000001, 1.5]`, 49.60000000000001, 1.5, true},
+		{`[49.6]`, 0, 0, false},
+		{`[49.6, 60, 1]`, 0, 0, false},
+		{`["49.6", 60]`, 0, 0, false},
+		{`{"gain": 49.6}`, 0, 0, false},
+		{`null`, 0, 0, false},
+	}
+	for _, tt := range tests {
+		g, s, ok := parseGainStep(json.RawMessage(tt.raw))
+		if g != tt.gain || s != tt.seconds || ok != tt.ok {
+			t.Errorf("parseGainStep(%s) = %v, %v, %v; want %v, %v, %v", tt.raw, g, s, ok, tt.gain, tt.seconds, tt.ok)
+		}
+	}
+}
+
+func TestGainSecondsFormattingAndStaleSteps(t *testing.T) {
+	c := New(prometheus.NewRegistry(), Options{})
+	period := func(gs string) *StatsPeriod {
+		var a AdaptiveStats
+		if err := json.Unmarshal([]byte(`{"gain_seconds": `+gs+`}`), &a); err != nil {
+			t.Fatal(err)
+		}
+		return &StatsPeriod{Adaptive: &a}
+	}
+	c.applyStatsPeriod("total", period(`{"19": [43.9, 10], "20": [49.6, 60]}`))
+	c.applyStatsPeriod("total", period(`{"20": [49.60000000000001, 70], "21": [50.0], "x": [1, 2]}`))
+
+	expected := `
+# HELP adsb_stats_adaptive_gain_seconds Number of seconds spent at a given adaptive gain step
+# TYPE adsb_stats_adaptive_gain_seconds gauge
+adsb_stats_adaptive_gain_seconds{gain_db="49.6",gain_step="20",period="total"} 70
+`
+	if err := testutil.CollectAndCompare(c.stats.adaptiveGainSeconds, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStatsPeriodsOption(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	c := New(reg, Options{StatsPeriods: []string{"latest", "total"}})
+	if err := c.UpdateStatsFromFile("testdata/stats.json"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `
+# HELP adsb_stats_messages_total Number of messages for given stats period
+# TYPE adsb_stats_messages_total gauge
+adsb_stats_messages_total{period="latest"} 300
+adsb_stats_messages_total{period="total"} 901234
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected), "adsb_stats_messages_total"); err != nil {
+		t.Error(err)
+	}
+	// last1min carries the only remote and adaptive stats in the fixture
+	if n := testutil.CollectAndCount(c.stats.adaptiveGainSeconds); n != 0 {
+		t.Errorf("adaptive_gain_seconds series = %d, want 0", n)
+	}
+}
+
+func TestPositionsDecodedWithoutTotalPeriod(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.json")
+	c := New(prometheus.NewRegistry(), Options{StatsPeriods: []string{"last1min"}})
+	for i, tt := range []struct {
+		globalOk int64
+		want     float64
+	}{
+		{100, 100},
+		{150, 150},
+	} {
+		data := fmt.Sprintf(`{"total": {"end": %d, "cpr": {"global_ok": %d}}}`, 1700000000+i, tt.globalOk)
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.UpdateStatsFromFile(path); err != nil {
+			t.Fatal(err)
+		}
+		if got := testutil.ToFloat64(c.stats.positionsDecoded); got != tt.want {
+			t.Errorf("update %d: adsb_stats_positions_decoded_total = %v, want %v", i, got, tt.want)
+		}
+	}
+	// the total period itself is still not exported
+	if n := testutil.CollectAndCount(c.stats.positions); n != 0 {
+		t.Errorf("adsb_stats_positions_total series = %d, want 0", n)
+	}
+}
+
+func TestRemoteStats(t *testing.T) {
+	c := New(prometheus.NewRegistry(), Options{})
+	signal, noise, gain := -18.5, -33.0, 42.1
+	c.applyStatsPeriod("latest", &StatsPeriod{Remote: &RemoteStats{
+		Signal: &signal, Noise: &noise, StrongSignals: 4,
+		SamplesProcessed: 2400000, SamplesDropped: 12, GainDB: &gain,
+	}})
+	// a purely network-fed period without signal, samples or gain
+	c.applyStatsPeriod("total", &StatsPeriod{Remote: &RemoteStats{Modes: 10}})
+
+	expected := `
+# HELP adsb_stats_remote_gain_db Gain reported for remote receivers (dB)
+# TYPE adsb_stats_remote_gain_db gauge
+adsb_stats_remote_gain_db{period="latest"} 42.1
+# HELP adsb_stats_remote_noise_dbfs Mean noise power of remote messages (dBFS)
+# TYPE adsb_stats_remote_noise_dbfs gauge
+adsb_stats_remote_noise_dbfs{period="latest"} -33
+# HELP adsb_stats_remote_samples_dropped_total Number of samples dropped by remote receivers
+# TYPE adsb_stats_remote_samples_dropped_total gauge
+adsb_stats_remote_samples_dropped_total{period="latest"} 12
+# HELP adsb_stats_remote_samples_processed_total Number of samples processed by remote receivers
+# TYPE adsb_stats_remote_samples_processed_total gauge
+adsb_stats_remote_samples_processed_total{period="latest"} 2.4e+06
+# HELP adsb_stats_remote_signal_dbfs Mean signal power of remote messages (dBFS)
+# TYPE adsb_stats_remote_signal_dbfs gauge
+adsb_stats_remote_signal_dbfs{period="latest"} -18.5
+# HELP adsb_stats_remote_strong_signals_total Number of remote messages with strong signal (above -3dBFS)
+# TYPE adsb_stats_remote_strong_signals_total gauge
+adsb_stats_remote_strong_signals_total{period="latest"} 4
+adsb_stats_remote_strong_signals_total{period="total"} 0
+`
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(c.stats.remoteSignal, c.stats.remoteNoise, c.stats.remotePeakSignal, c.stats.remoteStrongSignals,
+		c.stats.remoteSamplesProcessed, c.stats.remoteSamplesDropped, c.stats.remoteGainDB)
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUnifiedGain(t *testing.T) {
+	c := New(prometheus.NewRegistry(), Options{})
+	local, adaptive := 49.6, 43.9
+	c.applyStatsPeriod("latest", &StatsPeriod{
+		Local:    &LocalStats{GainDB: &local},
+		Adaptive: &AdaptiveStats{GainDB: &adaptive},
+	})
+	c.applyStatsPeriod("last1min", &StatsPeriod{Adaptive: &AdaptiveStats{GainDB: &adaptive}})
+	c.applyStatsPeriod("total", &StatsPeriod{Adaptive: &AdaptiveStats{GainDB: &adaptive}})
+	// the gain went away from total
+	c.applyStatsPeriod("total", &StatsPeriod{Local: &LocalStats{}})
+
+	expected := `
+# HELP adsb_receiver_gain_db SDR gain from stats.local.gain_db, or adaptive.gain_db when that is absent (dB)
+# TYPE adsb_receiver_gain_db gauge
+adsb_receiver_gain_db{period="last1min"} 43.9
+adsb_receiver_gain_db{period="latest"} 49.6
+`
+	if err := testutil.CollectAndCompare(c.stats.gainDB, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,139 @@
+package collector
+
+import "encoding/json"
+
+// Simplified structures for stats.json
+type StatsPeriod struct {
+	Start        float64        `json:"start"`
+	End          float64        `json:"end"`
+	Local        *LocalStats    `json:"local,omitempty"`
+	Remote       *RemoteStats   `json:"remote,omitempty"`
+	CPU          *CPUStats      `json:"cpu,omitempty"`
+	CPR          *CPRStats      `json:"cpr,omitempty"`
+	Tracks       map[string]int `json:"tracks,omitempty"`
+	Messages     int            `json:"messages,omitempty"`
+	MessagesByDF []int          `json:"messages_by_df,omitempty"`
+	Adaptive     *AdaptiveStats `json:"adaptive,omitempty"`
+}
+
+type LocalStats struct {
+	SamplesProcessed int64    `json:"samples_processed,omitempty"`
+	SamplesDropped   int64    `json:"samples_dropped,omitempty"`
+	ModeAC           int64    `json:"modeac,omitempty"`
+	Modes            int64    `json:"modes,omitempty"`
+	Bad              int64    `json:"bad,omitempty"`
+	UnknownICAO      int64    `json:"unknown_icao,omitempty"`
+	Accepted         []int64  `json:"accepted,omitempty"`
+	Signal           *float64 `json:"signal,omitempty"`
+	Noise            *float64 `json:"noise,omitempty"`
+	PeakSignal       *float64 `json:"peak_signal,omitempty"`
+	StrongSignals    int64    `json:"strong_signals,omitempty"`
+	GainDB           *float64 `json:"gain_db,omitempty"`
+}
+
+type RemoteStats = LocalStats
+
+type CPUStats struct {
+	Demod      int64 `json:"demod,omitempty"`
+	Reader     int64 `json:"reader,omitempty"`
+	Background int64 `json:"background,omitempty"`
+}
+
+type CPRStats struct {
+	Surface          int64 `json:"surface,omitempty"`
+	Airborne         int64 `json:"airborne,omitempty"`
+	GlobalOk         int64 `json:"global_ok,omitempty"`
+	GlobalBad        int64 `json:"global_bad,omitempty"`
+	GlobalRange      int64 `json:"global_range,omitempty"`
+	GlobalSpeed      int64 `json:"global_speed,omitempty"`
+	GlobalSkipped    int64 `json:"global_skipped,omitempty"`
+	LocalOk          int64 `json:"local_ok,omitempty"`
+	LocalAircraftRel int64 `json:"local_aircraft_relative,omitempty"`
+	LocalReceiverRel int64 `json:"local_receiver_relative,omitempty"`
+	LocalSkipped     int64 `json:"local_skipped,omitempty"`
+	LocalRange       int64 `json:"local_range,omitempty"`
+	LocalSpeed       int64 `json:"local_speed,omitempty"`
+	Filtered         int64 `json:"filtered,omitempty"`
+}
+
+// Adaptive gain stats (see README-json.md)
+type AdaptiveStats struct {
+	GainDB              *float64 `json:"gain_db,omitempty"`
+	DynamicRangeLimitDB *float64 `json:"dynamic_range_limit_db,omitempty"`
+	GainChanges         *int64   `json:"gain_changes,omitempty"`
+	LoudUndecoded       *int64   `json:"loud_undecoded,omitempty"`
+	LoudDecoded         *int64   `json:"loud_decoded,omitempty"`
+	NoiseDBFS           *float64 `json:"noise_dbfs,omitempty"`
+	// gain_seconds keyed by integer gain step; value is [gain_db, seconds].
+	// Kept raw so one malformed entry doesn't fail the whole file; see
+	// parseGainStep.
+	GainSeconds map[string]json.RawMessage `json:"gain_seconds,omitempty"`
+}
+
+type Stats struct {
+	Latest    StatsPeriod `json:"latest"`
+	Last1Min  StatsPeriod `json:"last1min"`
+	Last5Min  StatsPeriod `json:"last5min"`
+	Last15Min StatsPeriod `json:"last15min"`
+	Total     StatsPeriod `json:"total"`
+}
+
+// aircrafts.json structures
+type Aircraft struct {
+	Hex         string      `json:"hex"`
+	Flight      string      `json:"flight,omitempty"`
+	AltBaro     interface{} `json:"alt_baro,omitempty"`
+	AltGeom     interface{} `json:"alt_geom,omitempty"`
+	GS          *float64    `json:"gs,omitempty"`
+	IAS         *float64    `json:"ias,omitempty"`
+	TAS         *float64    `json:"tas,omitempty"`
+	Mach        *float64    `json:"mach,omitempty"`
+	Track       *float64    `json:"track,omitempty"`
+	TrackRate   *float64    `json:"track_rate,omitempty"`
+	Roll        *float64    `json:"roll,omitempty"`
+	MagHeading  *float64    `json:"mag_heading,omitempty"`
+	TrueHeading *float64    `json:"true_heading,omitempty"`
+	BaroRate    *float64    `json:"baro_rate,omitempty"`
+	GeomRate    *float64    `json:"geom_rate,omitempty"`
+	Squawk      string      `json:"squawk,omitempty"`
+	Emergency   string      `json:"emergency,omitempty"`
+	Category    string      `json:"category,omitempty"`
+	NavQNH      *float64    `json:"nav_qnh,omitempty"`
+	NavAltMCP   *float64    `json:"nav_altitude_mcp,omitempty"`
+	NavAltFMS   *float64    `json:"nav_altitude_fms,omitempty"`
+	NavHeading  *float64    `json:"nav_heading,omitempty"`
+	NavModes    interface{} `json:"nav_modes,omitempty"`
+	Lat         *float64    `json:"lat,omitempty"`
+	Lon         *float64    `json:"lon,omitempty"`
+	NIC         *int        `json:"nic,omitempty"`
+	RC          *int        `json:"rc,omitempty"`
+	SeenPos     *float64    `json:"seen_pos,omitempty"`
+	Version     *int        `json:"version,omitempty"`
+	NICBaro     *int        `json:"nic_baro,omitempty"`
+	NACP        *int        `json:"nac_p,omitempty"`
+	NACV        *int        `json:"nac_v,omitempty"`
+	SIL         *int        `json:"sil,omitempty"`
+	SILType     string      `json:"sil_type,omitempty"`
+	GVA         *int        `json:"gva,omitempty"`
+	SDA         *int        `json:"sda,omitempty"`
+	Alert       *int        `json:"alert,omitempty"`
+	SPI         *int        `json:"spi,omitempty"`
+	ACASRA      interface{} `json:"acas_ra,omitempty"`
+	WS          *float64    `json:"ws,omitempty"`
+	WD          *float64    `json:"wd,omitempty"`
+	OAT         *float64    `json:"oat,omitempty"`
+	TAT         *float64    `json:"tat,omitempty"`
+	Messages    int         `json:"messages,omitempty"`
+	Seen        *float64    `json:"seen,omitempty"`
+	RSSI        *float64    `json:"rssi,omitempty"`
+	MLAT        interface{} `json:"mlat,omitempty"`
+	TISB        interface{} `json:"tisb,omitempty"`
+	// tar1090's database flags: 1 military, 2 interesting, 4 PIA, 8 LADD
+	DBFlags *int `json:"dbFlags,omitempty"`
+}
+
+type AircraftsFile struct {
+	Now      float64    `json:"now"`
+	Messages int        `json:"messages"`
+	Aircraft []Aircraft `json:"aircraft"`
+}
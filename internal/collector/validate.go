@@ -0,0 +1,48 @@
+package collector
+
+import "math"
+
+// bounds is a sanity range for an aircraft field. hiOpen excludes hi itself,
+// as for angles where 360 should have wrapped to 0.
+type bounds struct {
+	lo, hi float64
+	hiOpen bool
+}
+
+// fieldBounds holds the sanity ranges checked unless Options.NoSanityBounds
+// is set, keyed by aircraft.json field name. Values outside them come from
+// corrupted frames rather than real aircraft.
+var fieldBounds = map[string]bounds{
+	"lat":          {lo: -90, hi: 90},
+	"lon":          {lo: -180, hi: 180},
+	"track":        {lo: 0, hi: 360, hiOpen: true},
+	"true_heading": {lo: 0, hi: 360, hiOpen: true},
+	"mag_heading":  {lo: 0, hi: 360, hiOpen: true},
+	"nav_heading":  {lo: 0, hi: 360, hiOpen: true},
+	"wd":           {lo: 0, hi: 360, hiOpen: true},
+	"alt_baro":     {lo: -2000, hi: 70000},
+	"alt_geom":     {lo: -2000, hi: 70000},
+	"gs":           {lo: 0, hi: 2000},
+	"ias":          {lo: 0, hi: 2000},
+	"tas":          {lo: 0, hi: 2000},
+}
+
+// valid reports whether v may be exported for field: it must be finite and,
+// unless disabled, within the field's sanity bounds. Rejected values are
+// counted by field and the caller leaves the previous sample in place.
+func (c *Collector) valid(field string, v float64) bool {
+	ok := c.inBounds(field, v)
+	if !ok {
+		c.aircraft.discarded.WithLabelValues(field).Inc()
+	}
+	return ok
+}
+
+// inBounds is valid without counting, for a value checked a second time.
+func (c *Collector) inBounds(field string, v float64) bool {
+	ok := !math.IsNaN(v) && !math.IsInf(v, 0)
+	if b, has := fieldBounds[field]; ok && has && !c.opts.NoSanityBounds {
+		ok = v >= b.lo && (v < b.hi || !b.hiOpen && v == b.hi)
+	}
+	return ok
+}
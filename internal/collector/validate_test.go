@@ -0,0 +1,87 @@
+package collector
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestValid(t *testing.T) {
+	c := New(prometheus.NewRegistry(), Options{})
+	tests := []struct {
+		field string
+		v     float64
+		want  bool
+	}{
+		{"lat", 51.5, true},
+		{"lat", -90, true},
+		{"lat", 90.1, false},
+		{"lon", -180.5, false},
+		{"track", 0, true},
+		{"track", 359.9, true},
+		{"track", 360, false},
+		{"alt_baro", -2000, true},
+		{"alt_baro", 70001, false},
+		{"gs", 4000, false},
+		{"rssi", -49.5, true},
+		{"rssi", math.Inf(1), false},
+	}
+	for _, tt := range tests {
+		if got := c.valid(tt.field, tt.v); got != tt.want {
+			t.Errorf("valid(%q, %v) = %v, want %v", tt.field, tt.v, got, tt.want)
+		}
+	}
+	if got := testutil.ToFloat64(c.aircraft.discarded.WithLabelValues("lat")); got != 1 {
+		t.Errorf("discarded{field=lat} = %v, want 1", got)
+	}
+
+	off := New(prometheus.NewRegistry(), Options{NoSanityBounds: true})
+	if !off.valid("gs", 4000) || off.valid("gs", math.Inf(1)) {
+		t.Error("NoSanityBounds should skip bounds but still reject Inf")
+	}
+}
+
+func TestOutOfRangeKeepsPreviousSample(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, fields string) string {
+		path := filepath.Join(dir, name)
+		data := `{"now": 1700000010, "aircraft": [{"hex": "abc123", ` + fields + `}]}`
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	c := New(prometheus.NewRegistry(), Options{})
+	for _, path := range []string{
+		write("good.json", `"lat": 51.5, "gs": 250, "alt_baro": 3000`),
+		write("bad.json", `"lat": 151.5, "gs": 25000, "alt_baro": "nan"`),
+	} {
+		if err := c.UpdateAircraftsFromFile(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := `
+# HELP adsb_aircraft_alt_baro_feet Aircraft barometric altitude (feet)
+# TYPE adsb_aircraft_alt_baro_feet gauge
+adsb_aircraft_alt_baro_feet{category="",flight="",hex="abc123"} 3000
+# HELP adsb_aircraft_ground_speed_kts Aircraft ground speed (knots)
+# TYPE adsb_aircraft_ground_speed_kts gauge
+adsb_aircraft_ground_speed_kts{category="",flight="",hex="abc123"} 250
+# HELP adsb_aircraft_lat Aircraft latitude
+# TYPE adsb_aircraft_lat gauge
+adsb_aircraft_lat{category="",flight="",hex="abc123"} 51.5
+`
+	if err := testutil.CollectAndCompare(c.aircraft, strings.NewReader(expected),
+		"adsb_aircraft_alt_baro_feet", "adsb_aircraft_ground_speed_kts", "adsb_aircraft_lat"); err != nil {
+		t.Errorf("previous samples not kept: %v", err)
+	}
+	if got := testutil.ToFloat64(c.aircraft.discarded.WithLabelValues("gs")); got != 1 {
+		t.Errorf("discarded{field=gs} = %v, want 1", got)
+	}
+}
@@ -0,0 +1,60 @@
+package collector
+
+import "math"
+
+// Below these the wind estimate is dominated by rounding in the reported
+// values: speeds in knots, and the angle in degrees between heading and
+// track, where the wind's direction hinges on gs and tas alone.
+const (
+	windMinSpeed      = 50
+	windMinDriftAngle = 0.5
+)
+
+// estimateWind derives the wind at the aircraft from its air vector (tas
+// along the true heading) and ground vector (gs along track). Without
+// true_heading, mag_heading corrected by Options.MagneticDeclination is used.
+// It reports false when an input is missing or invalid, or the case is
+// degenerate.
+func (c *Collector) estimateWind(ac *Aircraft) (speed, direction float64, ok bool) {
+	if ac.TAS == nil || ac.GS == nil || ac.Track == nil {
+		return 0, 0, false
+	}
+	tas, gs, track := *ac.TAS, *ac.GS, *ac.Track
+	if !c.inBounds("tas", tas) || !c.inBounds("gs", gs) || !c.inBounds("track", track) {
+		return 0, 0, false
+	}
+	var heading float64
+	switch {
+	case ac.TrueHeading != nil && c.inBounds("true_heading", *ac.TrueHeading):
+		heading = *ac.TrueHeading
+	case ac.MagHeading != nil && c.inBounds("mag_heading", *ac.MagHeading):
+		heading = *ac.MagHeading + c.opts.MagneticDeclination
+	default:
+		return 0, 0, false
+	}
+	if tas < windMinSpeed || gs < windMinSpeed || angleDiff(heading, track) < windMinDriftAngle {
+		return 0, 0, false
+	}
+	speed, direction = windFromVectors(tas, heading, gs, track)
+	return speed, direction, true
+}
+
+// windFromVectors returns the wind as ground vector minus air vector: its
+// speed and the direction it blows from, in degrees [0, 360).
+func windFromVectors(tas, heading, gs, track float64) (speed, direction float64) {
+	const rad = math.Pi / 180
+	hSin, hCos := math.Sincos(heading * rad)
+	tSin, tCos := math.Sincos(track * rad)
+	east := gs*tSin - tas*hSin
+	north := gs*tCos - tas*hCos
+	speed = math.Hypot(east, north)
+	direction = math.Mod(math.Atan2(-east, -north)/rad+360, 360)
+	return speed, direction
+}
+
+// angleDiff returns the absolute difference between two angles in degrees,
+// 0 to 180.
+func angleDiff(a, b float64) float64 {
+	d := math.Mod(math.Abs(a-b), 360)
+	return math.Min(d, 360-d)
+}
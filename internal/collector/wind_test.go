@@ -0,0 +1,54 @@
+package collector
+
+import (
+	"math"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestWindFromVectors(t *testing.T) {
+	crossGS := math.Hypot(20, 100)
+	crossTrack := math.Atan2(20, 100) * 180 / math.Pi
+	tests := []struct {
+		name                    string
+		tas, heading, gs, track float64
+		speed, direction        float64
+	}{
+		{"headwind from the east", 100, 90, 80, 90, 20, 90},
+		{"tailwind from the north", 100, 180, 130, 180, 30, 0},
+		{"crosswind from the west", 100, 0, crossGS, crossTrack, 20, 270},
+	}
+	for _, tt := range tests {
+		speed, dir := windFromVectors(tt.tas, tt.heading, tt.gs, tt.track)
+		if math.Abs(speed-tt.speed) > 1e-6 || angleDiff(dir, tt.direction) > 1e-6 {
+			t.Errorf("%s: wind = %v kt from %v°, want %v kt from %v°", tt.name, speed, dir, tt.speed, tt.direction)
+		}
+	}
+}
+
+func TestEstimateWind(t *testing.T) {
+	f := func(v float64) *float64 { return &v }
+	c := New(prometheus.NewRegistry(), Options{MagneticDeclination: -10})
+	tests := []struct {
+		name string
+		ac   Aircraft
+		ok   bool
+		dir  float64
+	}{
+		{"no heading", Aircraft{TAS: f(450), GS: f(430), Track: f(90)}, false, 0},
+		{"no tas", Aircraft{GS: f(430), Track: f(90), TrueHeading: f(90)}, false, 0},
+		{"taxiing", Aircraft{TAS: f(20), GS: f(15), Track: f(80), TrueHeading: f(90)}, false, 0},
+		{"heading along track", Aircraft{TAS: f(450), GS: f(430), Track: f(90), TrueHeading: f(90.2)}, false, 0},
+		{"invalid track", Aircraft{TAS: f(450), GS: f(430), Track: f(400), TrueHeading: f(90)}, false, 0},
+		{"true heading", Aircraft{TAS: f(100), GS: f(math.Hypot(20, 100)), Track: f(11.309932474020213), TrueHeading: f(0), MagHeading: f(50)}, true, 270},
+		// magnetic 10° is true 0° with the declination
+		{"magnetic heading", Aircraft{TAS: f(100), GS: f(math.Hypot(20, 100)), Track: f(11.309932474020213), MagHeading: f(10)}, true, 270},
+	}
+	for _, tt := range tests {
+		_, dir, ok := c.estimateWind(&tt.ac)
+		if ok != tt.ok || ok && angleDiff(dir, tt.dir) > 1e-6 {
+			t.Errorf("%s: estimateWind = %v from %v°, want %v from %v°", tt.name, ok, dir, tt.ok, tt.dir)
+		}
+	}
+}
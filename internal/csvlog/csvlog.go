@@ -0,0 +1,240 @@
+// Package csvlog appends a CSV line whenever an aircraft enters or leaves
+// coverage, giving a durable daily log without any external dependencies.
+package csvlog
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Kentaro1043/adsb-exporter/internal/collector"
+)
+
+var header = []string{"time", "event", "hex", "callsign", "category", "lat", "lon", "peak_altitude"}
+
+// Options configures a Log.
+type Options struct {
+	// Path is the CSV file. With Daily set the date is inserted before the
+	// extension, e.g. sightings-2024-05-01.csv.
+	Path string
+	// Daily rotates to a new file every UTC day.
+	Daily bool
+	// FlushInterval is how often buffered lines are written.
+	FlushInterval time.Duration
+	// MaxPending caps the lines held in memory while writes are failing.
+	// Newer lines are dropped once it is reached.
+	MaxPending int
+}
+
+type event struct {
+	at   time.Time
+	kind string
+	s    session
+}
+
+// session is what is known about an aircraft since it entered coverage.
+type session struct {
+	hex, callsign, category string
+	lat, lon                *float64
+	peakAltitude            *float64
+	lastSeen                time.Time
+}
+
+// Log tracks aircraft sessions across snapshots and writes enter/exit events.
+type Log struct {
+	opts Options
+	in   chan *collector.AircraftsFile
+
+	// owned by Run
+	sessions map[string]*session
+	pending  []event
+	dropped  int
+}
+
+// New returns a Log writing to opts.Path.
+func New(opts Options) (*Log, error) {
+	if opts.Path == "" {
+		return nil, fmt.Errorf("csvlog: empty path")
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = 10 * time.Second
+	}
+	if opts.MaxPending <= 0 {
+		opts.MaxPending = 10000
+	}
+	return &Log{
+		opts:     opts,
+		in:       make(chan *collector.AircraftsFile, 4),
+		sessions: map[string]*session{},
+	}, nil
+}
+
+// Observe queues a parsed aircraft.json. It never blocks; if the log has
+// fallen behind the snapshot is dropped and false is returned.
+func (l *Log) Observe(a *collector.AircraftsFile) bool {
+	select {
+	case l.in <- a:
+		return true
+	default:
+		return false
+	}
+}
+
+// Run processes snapshots and flushes every FlushInterval until ctx is
+// cancelled, then flushes once more.
+func (l *Log) Run(ctx context.Context) {
+	ticker := time.NewTicker(l.opts.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case a := <-l.in:
+			l.observe(a)
+		case <-ticker.C:
+			l.flushAndLog()
+		case <-ctx.Done():
+			l.flushAndLog()
+			return
+		}
+	}
+}
+
+func (l *Log) observe(a *collector.AircraftsFile) {
+	now := time.Unix(0, int64(a.Now*float64(time.Second)))
+	present := make(map[string]struct{}, len(a.Aircraft))
+	for i := range a.Aircraft {
+		ac := &a.Aircraft[i]
+		hex := collector.NormalizeHex(ac.Hex)
+		if hex == "" {
+			continue
+		}
+		present[hex] = struct{}{}
+
+		seenAt := now
+		if ac.Seen != nil {
+			seenAt = now.Add(-time.Duration(*ac.Seen * float64(time.Second)))
+		}
+		s, ok := l.sessions[hex]
+		if !ok {
+			s = &session{hex: hex}
+			l.sessions[hex] = s
+		}
+		if cs := collector.NormalizeFlight(ac.Flight); cs != "" {
+			s.callsign = cs
+		}
+		if ac.Category != "" {
+			s.category = ac.Category
+		}
+		if ac.Lat != nil && ac.Lon != nil {
+			s.lat, s.lon = ac.Lat, ac.Lon
+		}
+		if alt, ok := collector.BaroAltitude(ac); ok && (s.peakAltitude == nil || alt > *s.peakAltitude) {
+			s.peakAltitude = &alt
+		}
+		s.lastSeen = seenAt
+		if !ok {
+			l.queue(event{at: seenAt, kind: "enter", s: *s})
+		}
+	}
+	for hex, s := range l.sessions {
+		if _, ok := present[hex]; !ok {
+			l.queue(event{at: s.lastSeen, kind: "exit", s: *s})
+			delete(l.sessions, hex)
+		}
+	}
+}
+
+func (l *Log) queue(e event) {
+	if len(l.pending) >= l.opts.MaxPending {
+		l.dropped++
+		return
+	}
+	l.pending = append(l.pending, e)
+}
+
+func (l *Log) flushAndLog() {
+	if err := l.flush(); err != nil {
+		log.Printf("sighting log flush failed (%d lines pending): %v", len(l.pending), err)
+	}
+	if l.dropped > 0 {
+		log.Printf("sighting log buffer full, dropped %d lines", l.dropped)
+		l.dropped = 0
+	}
+}
+
+// flush writes pending events, grouped by target file. Events that could not
+// be written stay pending for the next attempt.
+func (l *Log) flush() error {
+	for len(l.pending) > 0 {
+		path := l.pathFor(l.pending[0].at)
+		n := 1
+		for n < len(l.pending) && l.pathFor(l.pending[n].at) == path {
+			n++
+		}
+		if err := appendEvents(path, l.pending[:n]); err != nil {
+			return err
+		}
+		l.pending = l.pending[n:]
+	}
+	l.pending = nil
+	return nil
+}
+
+func (l *Log) pathFor(t time.Time) string {
+	if !l.opts.Daily {
+		return l.opts.Path
+	}
+	ext := filepath.Ext(l.opts.Path)
+	return strings.TrimSuffix(l.opts.Path, ext) + "-" + t.UTC().Format(time.DateOnly) + ext
+}
+
+func appendEvents(path string, events []event) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(f)
+	w := csv.NewWriter(bw)
+	if fi.Size() == 0 {
+		w.Write(header)
+	}
+	for _, e := range events {
+		w.Write([]string{
+			e.at.UTC().Format(time.RFC3339),
+			e.kind,
+			e.s.hex,
+			e.s.callsign,
+			e.s.category,
+			formatFloat(e.s.lat),
+			formatFloat(e.s.lon),
+			formatFloat(e.s.peakAltitude),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func formatFloat(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*v, 'f', -1, 64)
+}
@@ -0,0 +1,63 @@
+package csvlog
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Kentaro1043/adsb-exporter/internal/collector"
+)
+
+func ptr(v float64) *float64 { return &v }
+
+func TestLogWritesEnterAndExit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sightings.csv")
+	l, err := New(Options{Path: path, Daily: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2023-11-14T22:13:30Z
+	l.observe(&collector.AircraftsFile{Now: 1700000010, Aircraft: []collector.Aircraft{
+		{Hex: "abc123", Flight: "SWA123  ", Category: "A3", AltBaro: 30000.0, Lat: ptr(35.1), Lon: ptr(139.2)},
+	}})
+	l.observe(&collector.AircraftsFile{Now: 1700000020, Aircraft: []collector.Aircraft{
+		{Hex: "abc123", Flight: "SWA123", Category: "A3", AltBaro: 35000.0, Lat: ptr(35.3), Lon: ptr(139.4)},
+	}})
+	l.observe(&collector.AircraftsFile{Now: 1700000030})
+	if err := l.flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(filepath.Dir(path), "sightings-2023-11-14.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		"time,event,hex,callsign,category,lat,lon,peak_altitude",
+		"2023-11-14T22:13:30Z,enter,abc123,SWA123,A3,35.1,139.2,30000",
+		"2023-11-14T22:13:40Z,exit,abc123,SWA123,A3,35.3,139.4,35000",
+		"",
+	}, "\n")
+	if string(b) != want {
+		t.Errorf("csv =\n%s\nwant\n%s", b, want)
+	}
+}
+
+func TestLogCapsPendingWhenWritesFail(t *testing.T) {
+	// a directory cannot be opened for appending
+	l, err := New(Options{Path: t.TempDir(), MaxPending: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, hex := range []string{"a00001", "a00002", "a00003"} {
+		l.observe(&collector.AircraftsFile{Now: 1700000010, Aircraft: []collector.Aircraft{{Hex: hex}}})
+	}
+	if err := l.flush(); err == nil {
+		t.Fatal("flush to a directory succeeded, want error")
+	}
+	if len(l.pending) != 2 || l.dropped == 0 {
+		t.Errorf("pending=%d dropped=%d, want 2 pending and some dropped", len(l.pending), l.dropped)
+	}
+}
@@ -0,0 +1,292 @@
+// Package history keeps a per-day record of every aircraft the station has
+// seen in a local SQLite database, independent of Prometheus retention.
+package history
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Kentaro1043/adsb-exporter/internal/collector"
+	_ "modernc.org/sqlite"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS sightings (
+	hex          TEXT    NOT NULL,
+	date         TEXT    NOT NULL,
+	first_seen   REAL    NOT NULL,
+	last_seen    REAL    NOT NULL,
+	max_altitude REAL,
+	min_distance REAL,
+	callsigns    TEXT    NOT NULL DEFAULT '',
+	messages     INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (hex, date)
+)`
+
+// Options configures a Sink.
+type Options struct {
+	// Path is the SQLite database file.
+	Path string
+	// FlushInterval is how often pending sightings are written.
+	FlushInterval time.Duration
+	// Retention drops rows whose date is older than this. Zero keeps rows
+	// forever.
+	Retention time.Duration
+	// Distance optionally returns an aircraft's distance from the receiver
+	// in km, used for min_distance.
+	Distance func(*collector.Aircraft) (float64, bool)
+}
+
+type key struct {
+	hex, date string
+}
+
+// sighting accumulates what was observed for one (hex, date) since the last
+// flush.
+type sighting struct {
+	firstSeen, lastSeen float64
+	maxAltitude         *float64
+	minDistance         *float64
+	callsigns           map[string]struct{}
+	messages            int64
+}
+
+// Sink aggregates aircraft snapshots in memory and writes them to SQLite on
+// its own goroutine, so database latency never delays a refresh.
+type Sink struct {
+	db   *sql.DB
+	opts Options
+	in   chan *collector.AircraftsFile
+
+	// owned by Run
+	pending      map[key]*sighting
+	lastMessages map[string]int
+}
+
+// Open opens (creating if needed) the database at opts.Path.
+func Open(opts Options) (*Sink, error) {
+	db, err := sql.Open("sqlite", opts.Path)
+	if err != nil {
+		return nil, fmt.Errorf("open history db: %w", err)
+	}
+	// a single connection keeps SQLite from contending with itself
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create history schema: %w", err)
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = time.Minute
+	}
+	return &Sink{
+		db:           db,
+		opts:         opts,
+		in:           make(chan *collector.AircraftsFile, 4),
+		pending:      map[key]*sighting{},
+		lastMessages: map[string]int{},
+	}, nil
+}
+
+// Observe queues a parsed aircraft.json for aggregation. It never blocks; if
+// the sink has fallen behind the snapshot is dropped and false is returned.
+func (s *Sink) Observe(a *collector.AircraftsFile) bool {
+	select {
+	case s.in <- a:
+		return true
+	default:
+		return false
+	}
+}
+
+// Run aggregates observed snapshots and flushes them every FlushInterval
+// until ctx is cancelled, then writes whatever is still pending.
+func (s *Sink) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.opts.FlushInterval)
+	defer ticker.Stop()
+
+	batches := make(chan map[key]*sighting, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for batch := range batches {
+			if err := s.flush(batch, time.Now()); err != nil {
+				log.Printf("history flush failed: %v", err)
+			}
+		}
+	}()
+
+	for {
+		select {
+		case a := <-s.in:
+			s.observe(a)
+		case <-ticker.C:
+			if len(s.pending) == 0 {
+				continue
+			}
+			select {
+			case batches <- s.pending:
+				s.pending = map[key]*sighting{}
+			default:
+				// writer is still busy with the previous batch; keep
+				// accumulating and try again next tick
+			}
+		case <-ctx.Done():
+			if len(s.pending) > 0 {
+				batches <- s.pending
+			}
+			close(batches)
+			<-done
+			return
+		}
+	}
+}
+
+// Close closes the database. Call it after Run has returned.
+func (s *Sink) Close() error {
+	return s.db.Close()
+}
+
+func (s *Sink) observe(a *collector.AircraftsFile) {
+	present := make(map[string]struct{}, len(a.Aircraft))
+	for i := range a.Aircraft {
+		ac := &a.Aircraft[i]
+		hex := collector.NormalizeHex(ac.Hex)
+		if hex == "" {
+			continue
+		}
+		present[hex] = struct{}{}
+
+		seenAt := a.Now
+		if ac.Seen != nil {
+			seenAt -= *ac.Seen
+		}
+		k := key{hex: hex, date: time.Unix(int64(seenAt), 0).UTC().Format(time.DateOnly)}
+		sg, ok := s.pending[k]
+		if !ok {
+			sg = &sighting{firstSeen: seenAt, lastSeen: seenAt, callsigns: map[string]struct{}{}}
+			s.pending[k] = sg
+		}
+		sg.firstSeen = min(sg.firstSeen, seenAt)
+		sg.lastSeen = max(sg.lastSeen, seenAt)
+		if alt, ok := collector.BaroAltitude(ac); ok {
+			sg.maxAltitude = maxPtr(sg.maxAltitude, alt)
+		}
+		if s.opts.Distance != nil {
+			if d, ok := s.opts.Distance(ac); ok {
+				sg.minDistance = minPtr(sg.minDistance, d)
+			}
+		}
+		if cs := collector.NormalizeFlight(ac.Flight); cs != "" {
+			sg.callsigns[cs] = struct{}{}
+		}
+
+		// messages is cumulative per tracking session; count the growth
+		// and treat a decrease as a new session
+		prev, seen := s.lastMessages[hex]
+		switch {
+		case !seen || ac.Messages < prev:
+			sg.messages += int64(ac.Messages)
+		default:
+			sg.messages += int64(ac.Messages - prev)
+		}
+		s.lastMessages[hex] = ac.Messages
+	}
+	for hex := range s.lastMessages {
+		if _, ok := present[hex]; !ok {
+			delete(s.lastMessages, hex)
+		}
+	}
+}
+
+// flush merges batch into the database in a single transaction and prunes
+// rows past the retention window.
+func (s *Sink) flush(batch map[key]*sighting, now time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for k, sg := range batch {
+		var (
+			first, last  float64
+			maxAlt, minD sql.NullFloat64
+			callsigns    string
+			messages     int64
+		)
+		err := tx.QueryRow(`SELECT first_seen, last_seen, max_altitude, min_distance, callsigns, messages
+			FROM sightings WHERE hex = ? AND date = ?`, k.hex, k.date).
+			Scan(&first, &last, &maxAlt, &minD, &callsigns, &messages)
+		switch {
+		case err == sql.ErrNoRows:
+			first, last = sg.firstSeen, sg.lastSeen
+		case err != nil:
+			return fmt.Errorf("read sighting %s/%s: %w", k.hex, k.date, err)
+		default:
+			first = min(first, sg.firstSeen)
+			last = max(last, sg.lastSeen)
+		}
+		if maxAlt.Valid {
+			sg.maxAltitude = maxPtr(sg.maxAltitude, maxAlt.Float64)
+		}
+		if minD.Valid {
+			sg.minDistance = minPtr(sg.minDistance, minD.Float64)
+		}
+		for _, cs := range strings.Split(callsigns, ",") {
+			if cs != "" {
+				sg.callsigns[cs] = struct{}{}
+			}
+		}
+		_, err = tx.Exec(`INSERT INTO sightings
+			(hex, date, first_seen, last_seen, max_altitude, min_distance, callsigns, messages)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT (hex, date) DO UPDATE SET
+				first_seen = excluded.first_seen,
+				last_seen = excluded.last_seen,
+				max_altitude = excluded.max_altitude,
+				min_distance = excluded.min_distance,
+				callsigns = excluded.callsigns,
+				messages = excluded.messages`,
+			k.hex, k.date, first, last, sg.maxAltitude, sg.minDistance,
+			joinSet(sg.callsigns), messages+sg.messages)
+		if err != nil {
+			return fmt.Errorf("write sighting %s/%s: %w", k.hex, k.date, err)
+		}
+	}
+
+	if s.opts.Retention > 0 {
+		cutoff := now.Add(-s.opts.Retention).UTC().Format(time.DateOnly)
+		if _, err := tx.Exec(`DELETE FROM sightings WHERE date < ?`, cutoff); err != nil {
+			return fmt.Errorf("prune sightings: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+func maxPtr(p *float64, v float64) *float64 {
+	if p == nil || v > *p {
+		return &v
+	}
+	return p
+}
+
+func minPtr(p *float64, v float64) *float64 {
+	if p == nil || v < *p {
+		return &v
+	}
+	return p
+}
+
+func joinSet(set map[string]struct{}) string {
+	l := make([]string, 0, len(set))
+	for s := range set {
+		l = append(l, s)
+	}
+	sort.Strings(l)
+	return strings.Join(l, ",")
+}
@@ -0,0 +1,129 @@
+package history
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Kentaro1043/adsb-exporter/internal/collector"
+)
+
+func ptr(v float64) *float64 { return &v }
+
+func TestSinkFlushMergesSightings(t *testing.T) {
+	s, err := Open(Options{Path: filepath.Join(t.TempDir(), "history.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// 2023-11-14T22:13:30Z
+	now := 1700000010.0
+	s.observe(&collector.AircraftsFile{Now: now, Aircraft: []collector.Aircraft{
+		{Hex: "abc123", Flight: "SWA123  ", AltBaro: 35000.0, Messages: 100, Seen: ptr(0)},
+		{Hex: "def456", AltBaro: "ground", Messages: 5},
+	}})
+	if err := s.flush(s.pending, time.Unix(int64(now), 0)); err != nil {
+		t.Fatal(err)
+	}
+	s.pending = map[key]*sighting{}
+
+	// same aircraft later with a new callsign, lower altitude, and a
+	// session reset of its message counter
+	s.observe(&collector.AircraftsFile{Now: now + 60, Aircraft: []collector.Aircraft{
+		{Hex: "abc123", Flight: "SWA124", AltBaro: 20000.0, Messages: 150, Seen: ptr(0)},
+	}})
+	s.observe(&collector.AircraftsFile{Now: now + 120, Aircraft: []collector.Aircraft{
+		{Hex: "abc123", Flight: "SWA124", AltBaro: 10000.0, Messages: 20, Seen: ptr(0)},
+	}})
+	if err := s.flush(s.pending, time.Unix(int64(now), 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		first, last float64
+		maxAlt      float64
+		callsigns   string
+		messages    int64
+	)
+	err = s.db.QueryRow(`SELECT first_seen, last_seen, max_altitude, callsigns, messages
+		FROM sightings WHERE hex = 'abc123' AND date = '2023-11-14'`).
+		Scan(&first, &last, &maxAlt, &callsigns, &messages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != now || last != now+120 {
+		t.Errorf("first/last = %v/%v, want %v/%v", first, last, now, now+120)
+	}
+	if maxAlt != 35000 {
+		t.Errorf("max_altitude = %v, want 35000", maxAlt)
+	}
+	if callsigns != "SWA123,SWA124" {
+		t.Errorf("callsigns = %q, want %q", callsigns, "SWA123,SWA124")
+	}
+	// 100 + (150-100) + 20 after the reset
+	if messages != 170 {
+		t.Errorf("messages = %d, want 170", messages)
+	}
+
+	var groundAlt *float64
+	if err := s.db.QueryRow(`SELECT max_altitude FROM sightings WHERE hex = 'def456'`).Scan(&groundAlt); err != nil {
+		t.Fatal(err)
+	}
+	if groundAlt != nil {
+		t.Errorf("max_altitude for a ground-only aircraft = %v, want NULL", *groundAlt)
+	}
+}
+
+func TestSinkPrunesOldRows(t *testing.T) {
+	s, err := Open(Options{Path: filepath.Join(t.TempDir(), "history.db"), Retention: 48 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	s.observe(&collector.AircraftsFile{Now: 1700000010, Aircraft: []collector.Aircraft{{Hex: "abc123"}}})
+	if err := s.flush(s.pending, time.Date(2023, 11, 20, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM sightings`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("rows after pruning = %d, want 0", n)
+	}
+}
+
+func TestSinkRunFlushesOnShutdown(t *testing.T) {
+	s, err := Open(Options{Path: filepath.Join(t.TempDir(), "history.db"), FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+	if !s.Observe(&collector.AircraftsFile{Now: 1700000010, Aircraft: []collector.Aircraft{{Hex: "abc123"}}}) {
+		t.Fatal("Observe dropped the first snapshot")
+	}
+	// give Run a chance to pick the snapshot up before shutting down
+	for len(s.in) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	var n int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM sightings`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("rows after shutdown = %d, want 1", n)
+	}
+}
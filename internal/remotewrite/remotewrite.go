@@ -0,0 +1,210 @@
+// Package remotewrite sends gathered metric families to a Prometheus
+// remote-write endpoint (Grafana Cloud, Mimir, Prometheus itself with the
+// receiver enabled), for feeders with no Prometheus of their own to scrape
+// them.
+package remotewrite
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Options configures a Client.
+type Options struct {
+	// URL is the remote-write endpoint, e.g.
+	// https://prometheus-prod-01-eu-west-0.grafana.net/api/prom/push.
+	URL string
+	// Username and Password, if Username is set, are sent as basic auth;
+	// otherwise BearerToken, if set, as a bearer token.
+	Username    string
+	Password    string
+	BearerToken string
+	// Timeout bounds each attempt; zero means 10 seconds.
+	Timeout time.Duration
+	// Retries is how many times a failed attempt is retried, waiting
+	// RetryBackoff, then twice that and so on, in between. Only network
+	// errors, 429 and 5xx answers are retried.
+	Retries      int
+	RetryBackoff time.Duration
+}
+
+// Client sends write requests to one endpoint.
+type Client struct {
+	opts Options
+	http *http.Client
+}
+
+// New returns a Client for opts.URL.
+func New(opts Options) (*Client, error) {
+	if opts.URL == "" {
+		return nil, fmt.Errorf("remotewrite: empty URL")
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = time.Second
+	}
+	return &Client{opts: opts, http: &http.Client{Timeout: opts.Timeout}}, nil
+}
+
+// Write sends every sample of families, stamped at ts unless a metric has a
+// timestamp of its own, and returns how many samples were sent. Histograms
+// and summaries are sent as their classic _bucket, _sum and _count (or
+// quantile) series.
+func (c *Client) Write(ctx context.Context, families []*dto.MetricFamily, ts time.Time) (int, error) {
+	body, n := encodeWriteRequest(families, ts.UnixMilli())
+	if n == 0 {
+		return 0, nil
+	}
+	body = snappy.Encode(nil, body)
+	backoff := c.opts.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		retry, err := c.post(ctx, body)
+		if err == nil {
+			return n, nil
+		}
+		if !retry || attempt == c.opts.Retries {
+			return 0, err
+		}
+		select {
+		case <-ctx.Done():
+			return 0, err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// post makes one attempt and reports whether a failure is worth retrying.
+func (c *Client) post(ctx context.Context, body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.opts.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	req.Header.Set("User-Agent", "adsb-exporter")
+	switch {
+	case c.opts.Username != "":
+		req.SetBasicAuth(c.opts.Username, c.opts.Password)
+	case c.opts.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+c.opts.BearerToken)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		io.Copy(io.Discard, resp.Body)
+		return false, nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("remote write: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode/100 == 5, err
+}
+
+// label is one name/value pair of a series.
+type label struct{ name, value string }
+
+// encodeWriteRequest encodes families as a prometheus.WriteRequest and
+// returns it with the number of samples in it. Every series holds one
+// sample.
+//
+//	WriteRequest { repeated TimeSeries timeseries = 1; }
+//	TimeSeries   { repeated Label labels = 1; repeated Sample samples = 2; }
+//	Label        { string name = 1; string value = 2; }
+//	Sample       { double value = 1; int64 timestamp = 2; }
+func encodeWriteRequest(families []*dto.MetricFamily, defaultTS int64) ([]byte, int) {
+	var buf, series []byte
+	var n int
+	add := func(name string, labels []label, value float64, ts int64) {
+		ls := make([]label, 0, len(labels)+1)
+		ls = append(ls, label{"__name__", name})
+		ls = append(ls, labels...)
+		// receivers require labels sorted by name
+		slices.SortFunc(ls, func(a, b label) int { return strings.Compare(a.name, b.name) })
+		series = series[:0]
+		for _, l := range ls {
+			var lb []byte
+			lb = protowire.AppendTag(lb, 1, protowire.BytesType)
+			lb = protowire.AppendString(lb, l.name)
+			lb = protowire.AppendTag(lb, 2, protowire.BytesType)
+			lb = protowire.AppendString(lb, l.value)
+			series = protowire.AppendTag(series, 1, protowire.BytesType)
+			series = protowire.AppendBytes(series, lb)
+		}
+		var sb []byte
+		sb = protowire.AppendTag(sb, 1, protowire.Fixed64Type)
+		sb = protowire.AppendFixed64(sb, math.Float64bits(value))
+		sb = protowire.AppendTag(sb, 2, protowire.VarintType)
+		sb = protowire.AppendVarint(sb, uint64(ts))
+		series = protowire.AppendTag(series, 2, protowire.BytesType)
+		series = protowire.AppendBytes(series, sb)
+		buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, series)
+		n++
+	}
+	for _, mf := range families {
+		name := mf.GetName()
+		for _, m := range mf.GetMetric() {
+			ts := defaultTS
+			if m.TimestampMs != nil {
+				ts = m.GetTimestampMs()
+			}
+			labels := make([]label, 0, len(m.GetLabel())+1)
+			for _, lp := range m.GetLabel() {
+				labels = append(labels, label{lp.GetName(), lp.GetValue()})
+			}
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				add(name, labels, m.GetCounter().GetValue(), ts)
+			case dto.MetricType_GAUGE:
+				add(name, labels, m.GetGauge().GetValue(), ts)
+			case dto.MetricType_UNTYPED:
+				add(name, labels, m.GetUntyped().GetValue(), ts)
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				for _, b := range h.GetBucket() {
+					if math.IsInf(b.GetUpperBound(), 1) {
+						continue
+					}
+					add(name+"_bucket", append(labels, label{"le", formatFloat(b.GetUpperBound())}), float64(b.GetCumulativeCount()), ts)
+				}
+				add(name+"_bucket", append(labels, label{"le", "+Inf"}), float64(h.GetSampleCount()), ts)
+				add(name+"_sum", labels, h.GetSampleSum(), ts)
+				add(name+"_count", labels, float64(h.GetSampleCount()), ts)
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				for _, q := range s.GetQuantile() {
+					add(name, append(labels, label{"quantile", formatFloat(q.GetQuantile())}), q.GetValue(), ts)
+				}
+				add(name+"_sum", labels, s.GetSampleSum(), ts)
+				add(name+"_count", labels, float64(s.GetSampleCount()), ts)
+			}
+		}
+	}
+	return buf, n
+}
+
+// formatFloat formats an le or quantile label as the text exposition does.
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
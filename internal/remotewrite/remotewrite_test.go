@@ -0,0 +1,162 @@
+package remotewrite
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// decodeWriteRequest turns a WriteRequest back into one line per series,
+// `{name="value",...} value @ts` with labels in wire order.
+func decodeWriteRequest(t *testing.T, b []byte) []string {
+	t.Helper()
+	// fields returns the length-delimited fields of b by number, and the
+	// fixed64 and varint ones as raw values
+	fields := func(b []byte) (bytesFields map[protowire.Number][][]byte, nums map[protowire.Number]uint64) {
+		bytesFields, nums = map[protowire.Number][][]byte{}, map[protowire.Number]uint64{}
+		for len(b) > 0 {
+			num, typ, n := protowire.ConsumeTag(b)
+			if n < 0 {
+				t.Fatalf("bad tag: %v", protowire.ParseError(n))
+			}
+			b = b[n:]
+			switch typ {
+			case protowire.BytesType:
+				v, n := protowire.ConsumeBytes(b)
+				if n < 0 {
+					t.Fatalf("bad bytes: %v", protowire.ParseError(n))
+				}
+				bytesFields[num] = append(bytesFields[num], v)
+				b = b[n:]
+			case protowire.Fixed64Type:
+				v, n := protowire.ConsumeFixed64(b)
+				nums[num], b = v, b[n:]
+			case protowire.VarintType:
+				v, n := protowire.ConsumeVarint(b)
+				nums[num], b = v, b[n:]
+			default:
+				t.Fatalf("unexpected wire type %v", typ)
+			}
+		}
+		return bytesFields, nums
+	}
+	var lines []string
+	req, _ := fields(b)
+	for _, ts := range req[1] {
+		series, _ := fields(ts)
+		var ls []string
+		for _, l := range series[1] {
+			kv, _ := fields(l)
+			ls = append(ls, string(kv[1][0])+"="+`"`+string(kv[2][0])+`"`)
+		}
+		if len(series[2]) != 1 {
+			t.Fatalf("%d samples in a series, want 1", len(series[2]))
+		}
+		_, sample := fields(series[2][0])
+		lines = append(lines, "{"+strings.Join(ls, ",")+"} "+
+			formatFloat(math.Float64frombits(sample[1]))+" @"+formatFloat(float64(sample[2])))
+	}
+	return lines
+}
+
+func TestWrite(t *testing.T) {
+	var got []string
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Encoding") != "snappy" || r.Header.Get("Content-Type") != "application/x-protobuf" {
+			t.Errorf("headers %v", r.Header)
+		}
+		user, pass, _ := r.BasicAuth()
+		auth = user + ":" + pass
+		body, _ := io.ReadAll(r.Body)
+		b, err := snappy.Decode(nil, body)
+		if err != nil {
+			t.Errorf("snappy: %v", err)
+		}
+		got = decodeWriteRequest(t, b)
+	}))
+	defer srv.Close()
+
+	reg := prometheus.NewRegistry()
+	g := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "b_gauge"}, []string{"period"})
+	g.WithLabelValues("latest").Set(1.5)
+	h := prometheus.NewHistogram(prometheus.HistogramOpts{Name: "a_hist", Buckets: []float64{1, 2}})
+	h.Observe(1.5)
+	reg.MustRegister(g, h)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := New(Options{URL: srv.URL, Username: "feeder", Password: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := c.Write(t.Context(), families, time.UnixMilli(1700000000000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`{__name__="a_hist_bucket",le="1"} 0 @1.7e+12`,
+		`{__name__="a_hist_bucket",le="2"} 1 @1.7e+12`,
+		`{__name__="a_hist_bucket",le="+Inf"} 1 @1.7e+12`,
+		`{__name__="a_hist_sum"} 1.5 @1.7e+12`,
+		`{__name__="a_hist_count"} 1 @1.7e+12`,
+		`{__name__="b_gauge",period="latest"} 1.5 @1.7e+12`,
+	}
+	if n != len(want) || !slices.Equal(got, want) {
+		t.Errorf("sent %d samples:\n%s\nwant:\n%s", n, strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if auth != "feeder:secret" {
+		t.Errorf("basic auth %q", auth)
+	}
+}
+
+func TestWriteRetries(t *testing.T) {
+	for _, tt := range []struct {
+		status   int
+		attempts int32
+		ok       bool
+	}{
+		// fails twice, then the last retry gets through
+		{http.StatusServiceUnavailable, 3, true},
+		{http.StatusTooManyRequests, 3, true},
+		// a bad request won't get better
+		{http.StatusBadRequest, 1, false},
+	} {
+		var attempts atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if attempts.Add(1) < 3 {
+				http.Error(w, "try later", tt.status)
+			}
+		}))
+		c, err := New(Options{URL: srv.URL, Retries: 2, RetryBackoff: time.Millisecond})
+		if err != nil {
+			t.Fatal(err)
+		}
+		v := 1.0
+		families := []*dto.MetricFamily{{
+			Name:   ptr("up"),
+			Type:   dto.MetricType_GAUGE.Enum(),
+			Metric: []*dto.Metric{{Gauge: &dto.Gauge{Value: &v}}},
+		}}
+		_, err = c.Write(t.Context(), families, time.Now())
+		if (err == nil) != tt.ok || attempts.Load() != tt.attempts {
+			t.Errorf("status %d: %d attempts, err %v; want %d attempts, ok %v", tt.status, attempts.Load(), err, tt.attempts, tt.ok)
+		}
+		srv.Close()
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// listen opens addr, either a TCP address or "unix:" followed by the path of
+// a socket to create. A socket file left at the path by an unclean exit is
+// removed first; any other kind of file is left alone and Listen fails.
+func listen(addr string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, "unix:")
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("remove stale socket: %w", err)
+		}
+	}
+	return net.Listen("unix", path)
+}
+
+// serve starts server on addr in the background and exits the process if it
+// can't listen or stops unexpectedly.
+func serve(server *http.Server, addr, name string) {
+	ln, err := listen(addr)
+	if err != nil {
+		log.Fatalf("listen on %s: %v", addr, err)
+	}
+	go func() {
+		log.Printf("starting %s server on %s", name, addr)
+		if err := server.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("%s server failed: %v", name, err)
+		}
+	}()
+}
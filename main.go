@@ -2,1179 +2,564 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
 	"log"
+	"math"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/Kentaro1043/adsb-exporter/internal/aircraftdb"
+	"github.com/Kentaro1043/adsb-exporter/internal/collector"
+	"github.com/Kentaro1043/adsb-exporter/internal/csvlog"
+	"github.com/Kentaro1043/adsb-exporter/internal/history"
+	"github.com/Kentaro1043/adsb-exporter/internal/remotewrite"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+	dto "github.com/prometheus/client_model/go"
 )
 
-// Simplified structures for stats.json
-type StatsPeriod struct {
-	Start        float64        `json:"start"`
-	End          float64        `json:"end"`
-	Local        *LocalStats    `json:"local,omitempty"`
-	Remote       *RemoteStats   `json:"remote,omitempty"`
-	CPU          *CPUStats      `json:"cpu,omitempty"`
-	CPR          *CPRStats      `json:"cpr,omitempty"`
-	Tracks       map[string]int `json:"tracks,omitempty"`
-	Messages     int            `json:"messages,omitempty"`
-	MessagesByDF []int          `json:"messages_by_df,omitempty"`
-	Adaptive     *AdaptiveStats `json:"adaptive,omitempty"`
-}
-
-type LocalStats struct {
-	SamplesProcessed int64    `json:"samples_processed,omitempty"`
-	SamplesDropped   int64    `json:"samples_dropped,omitempty"`
-	ModeAC           int64    `json:"modeac,omitempty"`
-	Modes            int64    `json:"modes,omitempty"`
-	Bad              int64    `json:"bad,omitempty"`
-	UnknownICAO      int64    `json:"unknown_icao,omitempty"`
-	Accepted         []int64  `json:"accepted,omitempty"`
-	Signal           *float64 `json:"signal,omitempty"`
-	Noise            *float64 `json:"noise,omitempty"`
-	PeakSignal       *float64 `json:"peak_signal,omitempty"`
-	StrongSignals    int64    `json:"strong_signals,omitempty"`
-	GainDB           *float64 `json:"gain_db,omitempty"`
-}
-
-type RemoteStats = LocalStats
-
-type CPUStats struct {
-	Demod      int64 `json:"demod,omitempty"`
-	Reader     int64 `json:"reader,omitempty"`
-	Background int64 `json:"background,omitempty"`
-}
-
-type CPRStats struct {
-	Surface          int64 `json:"surface,omitempty"`
-	Airborne         int64 `json:"airborne,omitempty"`
-	GlobalOk         int64 `json:"global_ok,omitempty"`
-	GlobalBad        int64 `json:"global_bad,omitempty"`
-	GlobalRange      int64 `json:"global_range,omitempty"`
-	GlobalSpeed      int64 `json:"global_speed,omitempty"`
-	GlobalSkipped    int64 `json:"global_skipped,omitempty"`
-	LocalOk          int64 `json:"local_ok,omitempty"`
-	LocalAircraftRel int64 `json:"local_aircraft_relative,omitempty"`
-	LocalReceiverRel int64 `json:"local_receiver_relative,omitempty"`
-	LocalSkipped     int64 `json:"local_skipped,omitempty"`
-	LocalRange       int64 `json:"local_range,omitempty"`
-	LocalSpeed       int64 `json:"local_speed,omitempty"`
-	Filtered         int64 `json:"filtered,omitempty"`
-}
+// registry holds the exporter's own metrics. It is never served directly;
+// scrapes are answered from the snapshot taken after each complete update.
+var registry = prometheus.NewRegistry()
 
-// Adaptive gain stats (see README-json.md)
-type AdaptiveStats struct {
-	GainDB              *float64 `json:"gain_db,omitempty"`
-	DynamicRangeLimitDB *float64 `json:"dynamic_range_limit_db,omitempty"`
-	GainChanges         *int64   `json:"gain_changes,omitempty"`
-	LoudUndecoded       *int64   `json:"loud_undecoded,omitempty"`
-	LoudDecoded         *int64   `json:"loud_decoded,omitempty"`
-	NoiseDBFS           *float64 `json:"noise_dbfs,omitempty"`
-	// gain_seconds keyed by integer gain step; value is [gain_db (float), seconds (number)]
-	GainSeconds map[string][]interface{} `json:"gain_seconds,omitempty"`
+// snapshotGatherer serves the metric families gathered after the last source
+// finished its update, so a scrape never observes a half-applied refresh.
+type snapshotGatherer struct {
+	mu       sync.Mutex // serializes update so snapshots are stored in gather order
+	families atomic.Pointer[[]*dto.MetricFamily]
 }
 
-type Stats struct {
-	Latest    StatsPeriod `json:"latest"`
-	Last1Min  StatsPeriod `json:"last1min"`
-	Last5Min  StatsPeriod `json:"last5min"`
-	Last15Min StatsPeriod `json:"last15min"`
-	Total     StatsPeriod `json:"total"`
-}
-
-// aircrafts.json structures
-type Aircraft struct {
-	Hex         string      `json:"hex"`
-	Flight      string      `json:"flight,omitempty"`
-	AltBaro     interface{} `json:"alt_baro,omitempty"`
-	AltGeom     interface{} `json:"alt_geom,omitempty"`
-	GS          *float64    `json:"gs,omitempty"`
-	IAS         *float64    `json:"ias,omitempty"`
-	TAS         *float64    `json:"tas,omitempty"`
-	Mach        *float64    `json:"mach,omitempty"`
-	Track       *float64    `json:"track,omitempty"`
-	TrackRate   *float64    `json:"track_rate,omitempty"`
-	Roll        *float64    `json:"roll,omitempty"`
-	MagHeading  *float64    `json:"mag_heading,omitempty"`
-	TrueHeading *float64    `json:"true_heading,omitempty"`
-	BaroRate    *float64    `json:"baro_rate,omitempty"`
-	GeomRate    *float64    `json:"geom_rate,omitempty"`
-	Squawk      string      `json:"squawk,omitempty"`
-	Emergency   string      `json:"emergency,omitempty"`
-	Category    string      `json:"category,omitempty"`
-	NavQNH      *float64    `json:"nav_qnh,omitempty"`
-	NavAltMCP   *float64    `json:"nav_altitude_mcp,omitempty"`
-	NavAltFMS   *float64    `json:"nav_altitude_fms,omitempty"`
-	NavHeading  *float64    `json:"nav_heading,omitempty"`
-	NavModes    interface{} `json:"nav_modes,omitempty"`
-	Lat         *float64    `json:"lat,omitempty"`
-	Lon         *float64    `json:"lon,omitempty"`
-	NIC         *int        `json:"nic,omitempty"`
-	RC          *int        `json:"rc,omitempty"`
-	SeenPos     *float64    `json:"seen_pos,omitempty"`
-	Version     *int        `json:"version,omitempty"`
-	NICBaro     *int        `json:"nic_baro,omitempty"`
-	NACP        *int        `json:"nac_p,omitempty"`
-	NACV        *int        `json:"nac_v,omitempty"`
-	SIL         *int        `json:"sil,omitempty"`
-	SILType     string      `json:"sil_type,omitempty"`
-	GVA         *int        `json:"gva,omitempty"`
-	SDA         *int        `json:"sda,omitempty"`
-	Messages    int         `json:"messages,omitempty"`
-	Seen        *float64    `json:"seen,omitempty"`
-	RSSI        *float64    `json:"rssi,omitempty"`
-	MLAT        interface{} `json:"mlat,omitempty"`
-	TISB        interface{} `json:"tisb,omitempty"`
+func (s *snapshotGatherer) Gather() ([]*dto.MetricFamily, error) {
+	if mfs := s.families.Load(); mfs != nil {
+		return *mfs, nil
+	}
+	return nil, nil
 }
 
-type AircraftsFile struct {
-	Now      float64    `json:"now"`
-	Messages int        `json:"messages"`
-	Aircraft []Aircraft `json:"aircraft"`
+// update gathers from g and swaps the result in. On error the previous
+// snapshot is kept.
+func (s *snapshotGatherer) update(g prometheus.Gatherer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mfs, err := g.Gather()
+	if err != nil {
+		return err
+	}
+	s.families.Store(&mfs)
+	return nil
 }
 
-// Prometheus metrics
-var (
-	metricsMessages = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_messages_total",
-		Help: "Number of messages for given stats period",
-	}, []string{"period"})
-
-	metricsLocalModes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_local_modes_total",
-		Help: "Local modes (modes) count by period",
-	}, []string{"period"})
-
-	metricsLocalBad = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_local_bad_total",
-		Help: "Local bad messages count by period",
-	}, []string{"period"})
-
-	metricsMessagesByDF = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_messages_by_df",
-		Help: "Messages per DF for a given period",
-	}, []string{"period", "df"})
-
-	// CPU metrics (milliseconds)
-	metricsCPUDemod = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_cpu_demod_ms",
-		Help: "Milliseconds spent doing demodulation (per period)",
-	}, []string{"period"})
-	metricsCPUReader = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_cpu_reader_ms",
-		Help: "Milliseconds spent reading samples from SDR (per period)",
-	}, []string{"period"})
-	metricsCPUBackground = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_cpu_background_ms",
-		Help: "Milliseconds spent in background processing (per period)",
-	}, []string{"period"})
-
-	// local gain
-	metricsLocalGainDB = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_local_gain_db",
-		Help: "SDR gain reported under stats.local.gain_db (dB)",
-	}, []string{"period"})
-
-	// adaptive metrics
-	metricsAdaptiveGainDB = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_adaptive_gain_db",
-		Help: "Adaptive latest SDR gain (legacy; prefer local.gain_db) (dB)",
-	}, []string{"period"})
-	metricsAdaptiveDynamicRangeLimitDB = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_adaptive_dynamic_range_limit_db",
-		Help: "Adaptive dynamic range limit (dB)",
-	}, []string{"period"})
-	metricsAdaptiveGainChanges = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_adaptive_gain_changes_total",
-		Help: "Number of adaptive gain changes in this period",
-	}, []string{"period"})
-	metricsAdaptiveLoudUndecoded = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_adaptive_loud_undecoded_total",
-		Help: "Number of loud undecoded bursts seen",
-	}, []string{"period"})
-	metricsAdaptiveLoudDecoded = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_adaptive_loud_decoded_total",
-		Help: "Number of loud decoded messages seen",
-	}, []string{"period"})
-	metricsAdaptiveNoiseDBFS = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_adaptive_noise_dbfs",
-		Help: "Adaptive noise floor estimate (dBFS)",
-	}, []string{"period"})
-	// gain_seconds: period, gain_step, gain_db -> seconds
-	metricsAdaptiveGainSeconds = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_adaptive_gain_seconds",
-		Help: "Number of seconds spent at a given adaptive gain step",
-	}, []string{"period", "gain_step", "gain_db"})
-
-	metricAircraftAltBaro = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_aircraft_alt_baro_feet",
-		Help: "Aircraft barometric altitude (feet)",
-	}, []string{"hex", "flight", "category"})
-
-	metricAircraftRssi = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_aircraft_rssi_dbfs",
-		Help: "Recent average RSSI (dBFS)",
-	}, []string{"hex", "flight", "category"})
-
-	metricAircraftGS = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_aircraft_ground_speed_kts",
-		Help: "Aircraft ground speed (knots)",
-	}, []string{"hex", "flight", "category"})
-
-	metricAircraftLat = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_aircraft_lat",
-		Help: "Aircraft latitude",
-	}, []string{"hex", "flight", "category"})
-
-	metricAircraftLon = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_aircraft_lon",
-		Help: "Aircraft longitude",
-	}, []string{"hex", "flight", "category"})
-
-	metricAircraftNavQNH = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_aircraft_nav_qnh_hpa",
-		Help: "Aircraft nav QNH (hPa)",
-	}, []string{"hex", "flight", "category"})
-
-	metricAircraftNavHeading = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_aircraft_nav_heading_deg",
-		Help: "Aircraft selected nav heading (degrees)",
-	}, []string{"hex", "flight", "category"})
-
-	// Additional aircraft metrics - altitude
-	metricAircraftAltGeom = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_aircraft_alt_geom_feet",
-		Help: "Aircraft geometric (GNSS/INS) altitude (feet)",
-	}, []string{"hex", "flight", "category"})
-
-	// Speed metrics
-	metricAircraftIAS = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_aircraft_ias_kts",
-		Help: "Aircraft indicated air speed (knots)",
-	}, []string{"hex", "flight", "category"})
-
-	metricAircraftTAS = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_aircraft_tas_kts",
-		Help: "Aircraft true air speed (knots)",
-	}, []string{"hex", "flight", "category"})
-
-	metricAircraftMach = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_aircraft_mach",
-		Help: "Aircraft Mach number",
-	}, []string{"hex", "flight", "category"})
-
-	// Track and heading metrics
-	metricAircraftTrack = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_aircraft_track_deg",
-		Help: "Aircraft true track over ground (degrees)",
-	}, []string{"hex", "flight", "category"})
-
-	metricAircraftTrackRate = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_aircraft_track_rate_deg_per_sec",
-		Help: "Aircraft rate of change of track (degrees/second)",
-	}, []string{"hex", "flight", "category"})
-
-	metricAircraftRoll = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_aircraft_roll_deg",
-		Help: "Aircraft roll angle (degrees, negative is left)",
-	}, []string{"hex", "flight", "category"})
-
-	metricAircraftMagHeading = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_aircraft_mag_heading_deg",
-		Help: "Aircraft magnetic heading (degrees)",
-	}, []string{"hex", "flight", "category"})
-
-	metricAircraftTrueHeading = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_aircraft_true_heading_deg",
-		Help: "Aircraft true heading (degrees)",
-	}, []string{"hex", "flight", "category"})
-
-	// Rate of climb/descent
-	metricAircraftBaroRate = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_aircraft_baro_rate_feet_per_min",
-		Help: "Aircraft barometric altitude rate of change (feet/minute)",
-	}, []string{"hex", "flight", "category"})
-
-	metricAircraftGeomRate = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_aircraft_geom_rate_feet_per_min",
-		Help: "Aircraft geometric altitude rate of change (feet/minute)",
-	}, []string{"hex", "flight", "category"})
-
-	// Navigation metrics
-	metricAircraftNavAltMCP = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_aircraft_nav_altitude_mcp_feet",
-		Help: "Aircraft selected altitude from MCP/FCU (feet)",
-	}, []string{"hex", "flight", "category"})
-
-	metricAircraftNavAltFMS = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_aircraft_nav_altitude_fms_feet",
-		Help: "Aircraft selected altitude from FMS (feet)",
-	}, []string{"hex", "flight", "category"})
-
-	metricAircraftNavModeActive = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_aircraft_nav_mode_active",
-		Help: "Aircraft navigation mode active (1=active, 0=inactive)",
-	}, []string{"hex", "flight", "category", "mode"})
-
-	// Quality and integrity metrics
-	metricAircraftNIC = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_aircraft_nic",
-		Help: "Aircraft Navigation Integrity Category",
-	}, []string{"hex", "flight", "category"})
-
-	metricAircraftRC = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_aircraft_rc_meters",
-		Help: "Aircraft Radius of Containment (meters)",
-	}, []string{"hex", "flight", "category"})
-
-	metricAircraftNICBaro = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_aircraft_nic_baro",
-		Help: "Aircraft Navigation Integrity Category for Barometric Altitude",
-	}, []string{"hex", "flight", "category"})
-
-	metricAircraftNACP = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_aircraft_nac_p",
-		Help: "Aircraft Navigation Accuracy for Position",
-	}, []string{"hex", "flight", "category"})
-
-	metricAircraftNACV = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_aircraft_nac_v",
-		Help: "Aircraft Navigation Accuracy for Velocity",
-	}, []string{"hex", "flight", "category"})
-
-	metricAircraftSIL = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_aircraft_sil",
-		Help: "Aircraft Source Integrity Level",
-	}, []string{"hex", "flight", "category"})
-
-	metricAircraftGVA = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_aircraft_gva",
-		Help: "Aircraft Geometric Vertical Accuracy",
-	}, []string{"hex", "flight", "category"})
-
-	metricAircraftSDA = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_aircraft_sda",
-		Help: "Aircraft System Design Assurance",
-	}, []string{"hex", "flight", "category"})
-
-	metricAircraftVersion = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_aircraft_version",
-		Help: "Aircraft ADS-B Version Number",
-	}, []string{"hex", "flight", "category"})
-
-	// Timing metrics
-	metricAircraftSeenPos = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_aircraft_seen_pos_seconds",
-		Help: "Seconds since last position update",
-	}, []string{"hex", "flight", "category"})
-
-	metricAircraftSeen = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_aircraft_seen_seconds",
-		Help: "Seconds since last message received",
-	}, []string{"hex", "flight", "category"})
-
-	metricAircraftMessages = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_aircraft_messages_total",
-		Help: "Total messages received from aircraft",
-	}, []string{"hex", "flight", "category"})
-
-	// Info metrics for string fields
-	metricAircraftInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_aircraft_info",
-		Help: "Aircraft information (squawk, emergency, type, sil_type)",
-	}, []string{"hex", "flight", "category", "squawk", "emergency", "type", "sil_type"})
-
-	// Stats metrics - Local stats additional fields
-	metricsLocalSamplesProcessed = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_local_samples_processed_total",
-		Help: "Number of samples processed by local SDR",
-	}, []string{"period"})
-
-	metricsLocalSamplesDropped = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_local_samples_dropped_total",
-		Help: "Number of samples dropped by local SDR",
-	}, []string{"period"})
-
-	metricsLocalModeAC = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_local_modeac_total",
-		Help: "Number of Mode A/C messages decoded",
-	}, []string{"period"})
-
-	metricsLocalUnknownICAO = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_local_unknown_icao_total",
-		Help: "Number of messages with unknown ICAO addresses",
-	}, []string{"period"})
-
-	metricsLocalAcceptedTotal = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_local_accepted_total",
-		Help: "Total number of accepted messages",
-	}, []string{"period"})
+var snapshot = &snapshotGatherer{}
 
-	metricsLocalAcceptedByErrors = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_local_accepted_by_errors",
-		Help: "Number of accepted messages by error correction bits",
-	}, []string{"period", "errors"})
+var startTime = prometheus.NewGauge(prometheus.GaugeOpts{
+	Name: "adsb_exporter_start_time_seconds",
+	Help: "Unix time the exporter process started",
+})
 
-	metricsLocalSignal = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_local_signal_dbfs",
-		Help: "Mean signal power (dBFS)",
-	}, []string{"period"})
+var pushgatewayFailures = promauto.With(registry).NewCounter(prometheus.CounterOpts{
+	Name: "adsb_exporter_pushgateway_failures_total",
+	Help: "Snapshots that could not be pushed to PUSHGATEWAY_URL",
+})
 
-	metricsLocalNoise = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_local_noise_dbfs",
-		Help: "Mean noise power (dBFS)",
-	}, []string{"period"})
+var remoteWriteFailures = promauto.With(registry).NewCounter(prometheus.CounterOpts{
+	Name: "adsb_exporter_remote_write_failures_total",
+	Help: "Snapshots that could not be sent to REMOTE_WRITE_URL after all retries, or were skipped because the previous one was still being sent",
+})
 
-	metricsLocalPeakSignal = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_local_peak_signal_dbfs",
-		Help: "Peak signal power (dBFS)",
-	}, []string{"period"})
-
-	metricsLocalStrongSignals = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_local_strong_signals_total",
-		Help: "Number of messages with strong signal (above -3dBFS)",
-	}, []string{"period"})
-
-	// Remote stats
-	metricsRemoteModeAC = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_remote_modeac_total",
-		Help: "Number of Mode A/C messages received remotely",
-	}, []string{"period"})
-
-	metricsRemoteModes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_remote_modes_total",
-		Help: "Number of Mode S messages received remotely",
-	}, []string{"period"})
-
-	metricsRemoteBad = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_remote_bad_total",
-		Help: "Number of bad messages received remotely",
-	}, []string{"period"})
-
-	metricsRemoteUnknownICAO = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_remote_unknown_icao_total",
-		Help: "Number of remote messages with unknown ICAO",
-	}, []string{"period"})
-
-	metricsRemoteAcceptedTotal = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_remote_accepted_total",
-		Help: "Total number of accepted remote messages",
-	}, []string{"period"})
-
-	metricsRemoteAcceptedByErrors = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_remote_accepted_by_errors",
-		Help: "Number of accepted remote messages by error correction bits",
-	}, []string{"period", "errors"})
-
-	// CPR stats
-	metricsCPRSurface = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_cpr_surface_total",
-		Help: "Total surface CPR messages received",
-	}, []string{"period"})
-
-	metricsCPRAirborne = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_cpr_airborne_total",
-		Help: "Total airborne CPR messages received",
-	}, []string{"period"})
-
-	metricsCPRGlobalOk = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_cpr_global_ok_total",
-		Help: "Global positions successfully derived",
-	}, []string{"period"})
-
-	metricsCPRGlobalBad = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_cpr_global_bad_total",
-		Help: "Global positions rejected (inconsistent)",
-	}, []string{"period"})
-
-	metricsCPRGlobalRange = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_cpr_global_range_total",
-		Help: "Global positions rejected (exceeded max range)",
-	}, []string{"period"})
-
-	metricsCPRGlobalSpeed = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_cpr_global_speed_total",
-		Help: "Global positions rejected (failed speed check)",
-	}, []string{"period"})
-
-	metricsCPRGlobalSkipped = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_cpr_global_skipped_total",
-		Help: "Global position attempts skipped",
-	}, []string{"period"})
-
-	metricsCPRLocalOk = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_cpr_local_ok_total",
-		Help: "Local positions successfully found",
-	}, []string{"period"})
-
-	metricsCPRLocalAircraftRelative = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_cpr_local_aircraft_relative_total",
-		Help: "Local positions relative to previous aircraft position",
-	}, []string{"period"})
-
-	metricsCPRLocalReceiverRelative = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_cpr_local_receiver_relative_total",
-		Help: "Local positions relative to receiver position",
-	}, []string{"period"})
-
-	metricsCPRLocalSkipped = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_cpr_local_skipped_total",
-		Help: "Local position attempts skipped",
-	}, []string{"period"})
-
-	metricsCPRLocalRange = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_cpr_local_range_total",
-		Help: "Local positions not used (exceeded range)",
-	}, []string{"period"})
-
-	metricsCPRLocalSpeed = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_cpr_local_speed_total",
-		Help: "Local positions not used (failed speed check)",
-	}, []string{"period"})
-
-	metricsCPRFiltered = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_cpr_filtered_total",
-		Help: "CPR messages filtered (faulty transponder)",
-	}, []string{"period"})
-
-	// Tracks stats
-	metricsTracksAll = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_tracks_all_total",
-		Help: "Total tracks created",
-	}, []string{"period"})
-
-	metricsTracksSingleMessage = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_tracks_single_message_total",
-		Help: "Tracks with only single message",
-	}, []string{"period"})
-
-	metricsTracksUnreliable = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_tracks_unreliable_total",
-		Help: "Tracks never marked as reliable",
-	}, []string{"period"})
-
-	// Altitude suppressed
-	metricsAltitudeSuppressed = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-		Name: "adsb_stats_altitude_suppressed_total",
-		Help: "Number of altitude suppressed messages",
-	}, []string{"period"})
-)
-
-// previous aircraft labels tracking for deletion of stale metrics
-var (
-	prevAircraftLabelsMu sync.Mutex
-	prevAircraftLabels   = map[string]prometheus.Labels{}
-)
+// runtimeRegistry holds the Go runtime and process metrics. They are
+// gathered live on every scrape rather than snapshotted.
+var runtimeRegistry = prometheus.NewRegistry()
 
 func init() {
-	prometheus.MustRegister(metricsMessages)
-	prometheus.MustRegister(metricsLocalModes)
-	prometheus.MustRegister(metricsLocalBad)
-	prometheus.MustRegister(metricsMessagesByDF)
-
-	// register CPU metrics
-	prometheus.MustRegister(metricsCPUDemod)
-	prometheus.MustRegister(metricsCPUReader)
-	prometheus.MustRegister(metricsCPUBackground)
-
-	// register local/adaptive metrics
-	prometheus.MustRegister(metricsLocalGainDB)
-	prometheus.MustRegister(metricsAdaptiveGainDB)
-	prometheus.MustRegister(metricsAdaptiveDynamicRangeLimitDB)
-	prometheus.MustRegister(metricsAdaptiveGainChanges)
-	prometheus.MustRegister(metricsAdaptiveLoudUndecoded)
-	prometheus.MustRegister(metricsAdaptiveLoudDecoded)
-	prometheus.MustRegister(metricsAdaptiveNoiseDBFS)
-	prometheus.MustRegister(metricsAdaptiveGainSeconds)
-
-	// register aircraft metrics
-	prometheus.MustRegister(metricAircraftAltBaro)
-	prometheus.MustRegister(metricAircraftAltGeom)
-	prometheus.MustRegister(metricAircraftRssi)
-	prometheus.MustRegister(metricAircraftGS)
-	prometheus.MustRegister(metricAircraftIAS)
-	prometheus.MustRegister(metricAircraftTAS)
-	prometheus.MustRegister(metricAircraftMach)
-	prometheus.MustRegister(metricAircraftTrack)
-	prometheus.MustRegister(metricAircraftTrackRate)
-	prometheus.MustRegister(metricAircraftRoll)
-	prometheus.MustRegister(metricAircraftMagHeading)
-	prometheus.MustRegister(metricAircraftTrueHeading)
-	prometheus.MustRegister(metricAircraftBaroRate)
-	prometheus.MustRegister(metricAircraftGeomRate)
-	prometheus.MustRegister(metricAircraftLat)
-	prometheus.MustRegister(metricAircraftLon)
-	prometheus.MustRegister(metricAircraftNavQNH)
-	prometheus.MustRegister(metricAircraftNavHeading)
-	prometheus.MustRegister(metricAircraftNavAltMCP)
-	prometheus.MustRegister(metricAircraftNavAltFMS)
-	prometheus.MustRegister(metricAircraftNavModeActive)
-	prometheus.MustRegister(metricAircraftNIC)
-	prometheus.MustRegister(metricAircraftRC)
-	prometheus.MustRegister(metricAircraftNICBaro)
-	prometheus.MustRegister(metricAircraftNACP)
-	prometheus.MustRegister(metricAircraftNACV)
-	prometheus.MustRegister(metricAircraftSIL)
-	prometheus.MustRegister(metricAircraftGVA)
-	prometheus.MustRegister(metricAircraftSDA)
-	prometheus.MustRegister(metricAircraftVersion)
-	prometheus.MustRegister(metricAircraftSeenPos)
-	prometheus.MustRegister(metricAircraftSeen)
-	prometheus.MustRegister(metricAircraftMessages)
-	prometheus.MustRegister(metricAircraftInfo)
-
-	// register additional local stats
-	prometheus.MustRegister(metricsLocalSamplesProcessed)
-	prometheus.MustRegister(metricsLocalSamplesDropped)
-	prometheus.MustRegister(metricsLocalModeAC)
-	prometheus.MustRegister(metricsLocalUnknownICAO)
-	prometheus.MustRegister(metricsLocalAcceptedTotal)
-	prometheus.MustRegister(metricsLocalAcceptedByErrors)
-	prometheus.MustRegister(metricsLocalSignal)
-	prometheus.MustRegister(metricsLocalNoise)
-	prometheus.MustRegister(metricsLocalPeakSignal)
-	prometheus.MustRegister(metricsLocalStrongSignals)
-
-	// register remote stats
-	prometheus.MustRegister(metricsRemoteModeAC)
-	prometheus.MustRegister(metricsRemoteModes)
-	prometheus.MustRegister(metricsRemoteBad)
-	prometheus.MustRegister(metricsRemoteUnknownICAO)
-	prometheus.MustRegister(metricsRemoteAcceptedTotal)
-	prometheus.MustRegister(metricsRemoteAcceptedByErrors)
-
-	// register CPR stats
-	prometheus.MustRegister(metricsCPRSurface)
-	prometheus.MustRegister(metricsCPRAirborne)
-	prometheus.MustRegister(metricsCPRGlobalOk)
-	prometheus.MustRegister(metricsCPRGlobalBad)
-	prometheus.MustRegister(metricsCPRGlobalRange)
-	prometheus.MustRegister(metricsCPRGlobalSpeed)
-	prometheus.MustRegister(metricsCPRGlobalSkipped)
-	prometheus.MustRegister(metricsCPRLocalOk)
-	prometheus.MustRegister(metricsCPRLocalAircraftRelative)
-	prometheus.MustRegister(metricsCPRLocalReceiverRelative)
-	prometheus.MustRegister(metricsCPRLocalSkipped)
-	prometheus.MustRegister(metricsCPRLocalRange)
-	prometheus.MustRegister(metricsCPRLocalSpeed)
-	prometheus.MustRegister(metricsCPRFiltered)
-
-	// register tracks stats
-	prometheus.MustRegister(metricsTracksAll)
-	prometheus.MustRegister(metricsTracksSingleMessage)
-	prometheus.MustRegister(metricsTracksUnreliable)
-
-	// register altitude suppressed
-	prometheus.MustRegister(metricsAltitudeSuppressed)
+	registry.MustRegister(startTime)
+	runtimeRegistry.MustRegister(
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewGoCollector(),
+	)
 }
 
-func safeReadFile(path string) ([]byte, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return nil, err
+func getenv(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
 	}
-	defer f.Close()
-	return io.ReadAll(f)
+	return def
 }
 
-func updateStatsFromFile(path string) error {
-	b, err := safeReadFile(path)
-	if err != nil {
-		return err
+// getenvInt parses key as a non-negative integer, falling back to def when
+// unset or invalid.
+func getenvInt(key string, def int) int {
+	s := os.Getenv(key)
+	if s == "" {
+		return def
 	}
-	var s Stats
-	if err := json.Unmarshal(b, &s); err != nil {
-		return fmt.Errorf("unmarshal stats: %w", err)
+	v, err := strconv.Atoi(s)
+	if err != nil || v < 0 {
+		log.Printf("invalid %s=%q, using %d", key, s, def)
+		return def
 	}
-
-	applyStatsPeriod("latest", &s.Latest)
-	applyStatsPeriod("last1min", &s.Last1Min)
-	applyStatsPeriod("last5min", &s.Last5Min)
-	applyStatsPeriod("last15min", &s.Last15Min)
-	applyStatsPeriod("total", &s.Total)
-	return nil
+	return v
 }
 
-func applyStatsPeriod(name string, p *StatsPeriod) {
-	if p == nil {
-		return
+// getenvFloat parses key as a non-negative number, falling back to def when
+// unset or invalid.
+func getenvFloat(key string, def float64) float64 {
+	s := os.Getenv(key)
+	if s == "" {
+		return def
 	}
-	metricsMessages.WithLabelValues(name).Set(float64(p.Messages))
-
-	// Local stats
-	if p.Local != nil {
-		metricsLocalModes.WithLabelValues(name).Set(float64(p.Local.Modes))
-		metricsLocalBad.WithLabelValues(name).Set(float64(p.Local.Bad))
-		metricsLocalSamplesProcessed.WithLabelValues(name).Set(float64(p.Local.SamplesProcessed))
-		metricsLocalSamplesDropped.WithLabelValues(name).Set(float64(p.Local.SamplesDropped))
-		metricsLocalModeAC.WithLabelValues(name).Set(float64(p.Local.ModeAC))
-		metricsLocalUnknownICAO.WithLabelValues(name).Set(float64(p.Local.UnknownICAO))
-
-		// Accepted messages - total and by error correction bits
-		if len(p.Local.Accepted) > 0 {
-			var total int64
-			for i, count := range p.Local.Accepted {
-				total += count
-				metricsLocalAcceptedByErrors.WithLabelValues(name, strconv.Itoa(i)).Set(float64(count))
-			}
-			metricsLocalAcceptedTotal.WithLabelValues(name).Set(float64(total))
-		}
-
-		if p.Local.Signal != nil {
-			metricsLocalSignal.WithLabelValues(name).Set(*p.Local.Signal)
-		}
-		if p.Local.Noise != nil {
-			metricsLocalNoise.WithLabelValues(name).Set(*p.Local.Noise)
-		}
-		if p.Local.PeakSignal != nil {
-			metricsLocalPeakSignal.WithLabelValues(name).Set(*p.Local.PeakSignal)
-		}
-		metricsLocalStrongSignals.WithLabelValues(name).Set(float64(p.Local.StrongSignals))
-
-		if p.Local.GainDB != nil {
-			metricsLocalGainDB.WithLabelValues(name).Set(*p.Local.GainDB)
-		}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+		log.Printf("invalid %s=%q, using %v", key, s, def)
+		return def
 	}
+	return v
+}
 
-	// Remote stats
-	if p.Remote != nil {
-		metricsRemoteModeAC.WithLabelValues(name).Set(float64(p.Remote.ModeAC))
-		metricsRemoteModes.WithLabelValues(name).Set(float64(p.Remote.Modes))
-		metricsRemoteBad.WithLabelValues(name).Set(float64(p.Remote.Bad))
-		metricsRemoteUnknownICAO.WithLabelValues(name).Set(float64(p.Remote.UnknownICAO))
+// Refresh interval bounds, in seconds. The maximum, which keeps a typo from
+// leaving the metrics stale for hours, can be changed with
+// INTERVAL_MAX_SECONDS.
+const (
+	defaultInterval    = 5
+	defaultMaxInterval = 300
+)
 
-		if len(p.Remote.Accepted) > 0 {
-			var total int64
-			for i, count := range p.Remote.Accepted {
-				total += count
-				metricsRemoteAcceptedByErrors.WithLabelValues(name, strconv.Itoa(i)).Set(float64(count))
-			}
-			metricsRemoteAcceptedTotal.WithLabelValues(name).Set(float64(total))
-		}
+// parseInterval parses INTERVAL_SECONDS s as whole seconds, at least one and
+// at most maxSec. An invalid value means defaultInterval and one over maxSec
+// is capped; problem then says so for the log.
+func parseInterval(s string, maxSec int) (sec int, problem string) {
+	if maxSec < 1 {
+		maxSec = defaultMaxInterval
 	}
-
-	// CPU metrics
-	if p.CPU != nil {
-		metricsCPUDemod.WithLabelValues(name).Set(float64(p.CPU.Demod))
-		metricsCPUReader.WithLabelValues(name).Set(float64(p.CPU.Reader))
-		metricsCPUBackground.WithLabelValues(name).Set(float64(p.CPU.Background))
+	sec, err := strconv.Atoi(s)
+	if err != nil || sec < 1 {
+		def := min(defaultInterval, maxSec)
+		return def, fmt.Sprintf("invalid INTERVAL_SECONDS=%q, using %d", s, def)
 	}
-
-	// CPR stats
-	if p.CPR != nil {
-		metricsCPRSurface.WithLabelValues(name).Set(float64(p.CPR.Surface))
-		metricsCPRAirborne.WithLabelValues(name).Set(float64(p.CPR.Airborne))
-		metricsCPRGlobalOk.WithLabelValues(name).Set(float64(p.CPR.GlobalOk))
-		metricsCPRGlobalBad.WithLabelValues(name).Set(float64(p.CPR.GlobalBad))
-		metricsCPRGlobalRange.WithLabelValues(name).Set(float64(p.CPR.GlobalRange))
-		metricsCPRGlobalSpeed.WithLabelValues(name).Set(float64(p.CPR.GlobalSpeed))
-		metricsCPRGlobalSkipped.WithLabelValues(name).Set(float64(p.CPR.GlobalSkipped))
-		metricsCPRLocalOk.WithLabelValues(name).Set(float64(p.CPR.LocalOk))
-		metricsCPRLocalAircraftRelative.WithLabelValues(name).Set(float64(p.CPR.LocalAircraftRel))
-		metricsCPRLocalReceiverRelative.WithLabelValues(name).Set(float64(p.CPR.LocalReceiverRel))
-		metricsCPRLocalSkipped.WithLabelValues(name).Set(float64(p.CPR.LocalSkipped))
-		metricsCPRLocalRange.WithLabelValues(name).Set(float64(p.CPR.LocalRange))
-		metricsCPRLocalSpeed.WithLabelValues(name).Set(float64(p.CPR.LocalSpeed))
-		metricsCPRFiltered.WithLabelValues(name).Set(float64(p.CPR.Filtered))
+	if sec > maxSec {
+		return maxSec, fmt.Sprintf("INTERVAL_SECONDS=%d is over INTERVAL_MAX_SECONDS=%d, using %d", sec, maxSec, maxSec)
 	}
+	return sec, ""
+}
 
-	// Tracks stats
-	if p.Tracks != nil {
-		if all, ok := p.Tracks["all"]; ok {
-			metricsTracksAll.WithLabelValues(name).Set(float64(all))
-		}
-		if single, ok := p.Tracks["single_message"]; ok {
-			metricsTracksSingleMessage.WithLabelValues(name).Set(float64(single))
-		}
-		if unreliable, ok := p.Tracks["unreliable"]; ok {
-			metricsTracksUnreliable.WithLabelValues(name).Set(float64(unreliable))
-		}
-	}
+// handleHealthz is the liveness probe: answering at all is the signal.
+func handleHealthz(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok\n"))
+}
 
-	// Adaptive metrics
-	if p.Adaptive != nil {
-		if p.Adaptive.GainDB != nil {
-			metricsAdaptiveGainDB.WithLabelValues(name).Set(*p.Adaptive.GainDB)
-		}
-		if p.Adaptive.DynamicRangeLimitDB != nil {
-			metricsAdaptiveDynamicRangeLimitDB.WithLabelValues(name).Set(*p.Adaptive.DynamicRangeLimitDB)
-		}
-		if p.Adaptive.GainChanges != nil {
-			metricsAdaptiveGainChanges.WithLabelValues(name).Set(float64(*p.Adaptive.GainChanges))
-		}
-		if p.Adaptive.LoudUndecoded != nil {
-			metricsAdaptiveLoudUndecoded.WithLabelValues(name).Set(float64(*p.Adaptive.LoudUndecoded))
-		}
-		if p.Adaptive.LoudDecoded != nil {
-			metricsAdaptiveLoudDecoded.WithLabelValues(name).Set(float64(*p.Adaptive.LoudDecoded))
-		}
-		if p.Adaptive.NoiseDBFS != nil {
-			metricsAdaptiveNoiseDBFS.WithLabelValues(name).Set(*p.Adaptive.NoiseDBFS)
-		}
-		// gain_seconds: map[string][]interface{} -> [gain_db, seconds]
-		for step, arr := range p.Adaptive.GainSeconds {
-			if len(arr) >= 2 {
-				if g, ok := numericFromInterface(arr[0]); ok {
-					if secs, ok2 := numericFromInterface(arr[1]); ok2 {
-						metricsAdaptiveGainSeconds.WithLabelValues(name, step, fmt.Sprintf("%v", g)).Set(secs)
-					}
-				}
-			}
+// getenvList splits key on commas, dropping blank items.
+func getenvList(key string) []string {
+	var l []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			l = append(l, v)
 		}
 	}
+	return l
+}
 
-	// Messages by DF
-	if p.MessagesByDF != nil {
-		for i, v := range p.MessagesByDF {
-			metricsMessagesByDF.WithLabelValues(name, strconv.Itoa(i)).Set(float64(v))
-		}
+// getenvBands parses key as comma-separated ascending band upper bounds,
+// returning nil (the collector's default) when unset or invalid.
+func getenvBands(key string) []float64 {
+	l := getenvList(key)
+	if len(l) == 0 {
+		return nil
+	}
+	bounds := make([]float64, len(l))
+	for i, v := range l {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			bounds = nil
+			break
+		}
+		bounds[i] = f
+	}
+	if !collector.ValidBands(bounds) {
+		log.Printf("invalid %s=%q, using the default bands", key, os.Getenv(key))
+		return nil
 	}
+	return bounds
 }
 
-func updateAircraftsFromFile(path string) error {
-	b, err := safeReadFile(path)
-	if err != nil {
-		return err
+// getenvPosition reads a position from latKey and lonKey, returning nil
+// unless both are set and valid.
+func getenvPosition(latKey, lonKey string) *collector.Position {
+	latStr, lonStr := os.Getenv(latKey), os.Getenv(lonKey)
+	if latStr == "" && lonStr == "" {
+		return nil
 	}
-	var a AircraftsFile
-	if err := json.Unmarshal(b, &a); err != nil {
-		return fmt.Errorf("unmarshal aircrafts: %w", err)
+	lat, errLat := strconv.ParseFloat(latStr, 64)
+	lon, errLon := strconv.ParseFloat(lonStr, 64)
+	if errLat != nil || errLon != nil || lat < -90 || lat > 90 || lon < -180 || lon > 180 {
+		log.Printf("invalid %s=%q %s=%q, ignoring", latKey, latStr, lonKey, lonStr)
+		return nil
 	}
+	return &collector.Position{Lat: lat, Lon: lon}
+}
 
-	// build current label set
-	cur := map[string]prometheus.Labels{}
-
-	for _, ac := range a.Aircraft {
-		hex := ac.Hex
-		flight := ac.Flight
-		category := ac.Category
-
-		labels := prometheus.Labels{"hex": hex, "flight": flight, "category": category}
-		key := hex + "|" + flight + "|" + category
-		cur[key] = labels
-
-		// Altitude metrics
-		if n, ok := numericFromInterface(ac.AltBaro); ok {
-			metricAircraftAltBaro.With(labels).Set(n)
-		}
-		if n, ok := numericFromInterface(ac.AltGeom); ok {
-			metricAircraftAltGeom.With(labels).Set(n)
-		}
-
-		// Speed metrics
-		if ac.GS != nil {
-			metricAircraftGS.With(labels).Set(*ac.GS)
-		}
-		if ac.IAS != nil {
-			metricAircraftIAS.With(labels).Set(*ac.IAS)
-		}
-		if ac.TAS != nil {
-			metricAircraftTAS.With(labels).Set(*ac.TAS)
-		}
-		if ac.Mach != nil {
-			metricAircraftMach.With(labels).Set(*ac.Mach)
-		}
-
-		// Track and heading metrics
-		if ac.Track != nil {
-			metricAircraftTrack.With(labels).Set(*ac.Track)
-		}
-		if ac.TrackRate != nil {
-			metricAircraftTrackRate.With(labels).Set(*ac.TrackRate)
-		}
-		if ac.Roll != nil {
-			metricAircraftRoll.With(labels).Set(*ac.Roll)
-		}
-		if ac.MagHeading != nil {
-			metricAircraftMagHeading.With(labels).Set(*ac.MagHeading)
-		}
-		if ac.TrueHeading != nil {
-			metricAircraftTrueHeading.With(labels).Set(*ac.TrueHeading)
-		}
+func main() {
+	startTime.Set(float64(time.Now().Unix()))
 
-		// Rate of climb/descent
-		if ac.BaroRate != nil {
-			metricAircraftBaroRate.With(labels).Set(*ac.BaroRate)
-		}
-		if ac.GeomRate != nil {
-			metricAircraftGeomRate.With(labels).Set(*ac.GeomRate)
-		}
+	statsPath := getenv("STATS_PATH", "stats.json")
+	// several files, e.g. from dump1090 and dump978, are merged by hex
+	aircraftsPaths := getenvList("AIRCRAFTS_PATH")
+	if len(aircraftsPaths) == 0 {
+		aircraftsPaths = []string{"aircrafts.json"}
+	}
+	listenAddr := getenv("LISTEN_ADDR", ":9187")
+	intervalSec, problem := parseInterval(getenv("INTERVAL_SECONDS", strconv.Itoa(defaultInterval)),
+		getenvInt("INTERVAL_MAX_SECONDS", defaultMaxInterval))
+	if problem != "" {
+		log.Print(problem)
+	}
+	interval := time.Duration(intervalSec) * time.Second
+	log.Printf("refreshing every %s", interval)
 
-		// Position
-		if ac.Lat != nil {
-			metricAircraftLat.With(labels).Set(*ac.Lat)
-		}
-		if ac.Lon != nil {
-			metricAircraftLon.With(labels).Set(*ac.Lon)
-		}
+	speedUnit := getenv("SPEED_UNIT", collector.SpeedUnitKts)
+	if speedUnit != collector.SpeedUnitKts && speedUnit != collector.SpeedUnitKmh {
+		log.Printf("invalid SPEED_UNIT=%q, using %s", speedUnit, collector.SpeedUnitKts)
+		speedUnit = collector.SpeedUnitKts
+	}
 
-		// Navigation metrics
-		if ac.NavQNH != nil {
-			metricAircraftNavQNH.With(labels).Set(*ac.NavQNH)
-		}
-		if ac.NavHeading != nil {
-			metricAircraftNavHeading.With(labels).Set(*ac.NavHeading)
-		}
-		if ac.NavAltMCP != nil {
-			metricAircraftNavAltMCP.With(labels).Set(*ac.NavAltMCP)
-		}
-		if ac.NavAltFMS != nil {
-			metricAircraftNavAltFMS.With(labels).Set(*ac.NavAltFMS)
-		}
+	altUnit := getenv("ALT_UNIT", collector.AltUnitFeet)
+	switch altUnit {
+	case collector.AltUnitFeet, collector.AltUnitMeters, collector.AltUnitBoth:
+	default:
+		log.Printf("invalid ALT_UNIT=%q, using %s", altUnit, collector.AltUnitFeet)
+		altUnit = collector.AltUnitFeet
+	}
 
-		// Nav modes - convert array to individual boolean metrics
-		if ac.NavModes != nil {
-			modes := make(map[string]bool)
-			// Parse nav_modes which can be array of strings or empty array
-			if modeArray, ok := ac.NavModes.([]interface{}); ok {
-				for _, m := range modeArray {
-					if modeStr, ok := m.(string); ok {
-						modes[modeStr] = true
-					}
-				}
+	var statsPeriods []string
+	if v := os.Getenv("STATS_PERIODS"); v != "" {
+		for _, p := range strings.Split(v, ",") {
+			p = strings.TrimSpace(p)
+			if !slices.Contains(collector.StatsPeriods, p) {
+				log.Printf("invalid period %q in STATS_PERIODS, ignoring", p)
+				continue
 			}
-			// Set all possible modes
-			possibleModes := []string{"autopilot", "vnav", "althold", "approach", "lnav", "tcas"}
-			for _, mode := range possibleModes {
-				modeLabels := prometheus.Labels{
-					"hex":      hex,
-					"flight":   flight,
-					"category": category,
-					"mode":     mode,
-				}
-				if modes[mode] {
-					metricAircraftNavModeActive.With(modeLabels).Set(1)
-				} else {
-					metricAircraftNavModeActive.With(modeLabels).Set(0)
-				}
-			}
-		}
-
-		// Quality and integrity metrics
-		if ac.NIC != nil {
-			metricAircraftNIC.With(labels).Set(float64(*ac.NIC))
+			statsPeriods = append(statsPeriods, p)
 		}
-		if ac.RC != nil {
-			metricAircraftRC.With(labels).Set(float64(*ac.RC))
+		if len(statsPeriods) == 0 {
+			log.Printf("no valid period in STATS_PERIODS=%q, exporting all", v)
 		}
-		if ac.NICBaro != nil {
-			metricAircraftNICBaro.With(labels).Set(float64(*ac.NICBaro))
-		}
-		if ac.NACP != nil {
-			metricAircraftNACP.With(labels).Set(float64(*ac.NACP))
-		}
-		if ac.NACV != nil {
-			metricAircraftNACV.With(labels).Set(float64(*ac.NACV))
-		}
-		if ac.SIL != nil {
-			metricAircraftSIL.With(labels).Set(float64(*ac.SIL))
-		}
-		if ac.GVA != nil {
-			metricAircraftGVA.With(labels).Set(float64(*ac.GVA))
-		}
-		if ac.SDA != nil {
-			metricAircraftSDA.With(labels).Set(float64(*ac.SDA))
-		}
-		if ac.Version != nil {
-			metricAircraftVersion.With(labels).Set(float64(*ac.Version))
-		}
-
-		// Timing metrics
-		if ac.SeenPos != nil {
-			metricAircraftSeenPos.With(labels).Set(*ac.SeenPos)
-		}
-		if ac.Seen != nil {
-			metricAircraftSeen.With(labels).Set(*ac.Seen)
-		}
-		metricAircraftMessages.With(labels).Set(float64(ac.Messages))
+	}
 
-		// RSSI
-		if ac.RSSI != nil {
-			metricAircraftRssi.With(labels).Set(*ac.RSSI)
-		}
+	receiver := getenvPosition("RECEIVER_LAT", "RECEIVER_LON")
 
-		// Info metric for string fields
-		infoLabels := prometheus.Labels{
-			"hex":       hex,
-			"flight":    flight,
-			"category":  category,
-			"squawk":    ac.Squawk,
-			"emergency": ac.Emergency,
-			"type":      "",
-			"sil_type":  ac.SILType,
+	// degrees east of true north; negative west
+	var declination float64
+	if s := os.Getenv("MAGNETIC_DECLINATION"); s != "" {
+		d, err := strconv.ParseFloat(s, 64)
+		if err != nil || d < -180 || d > 180 {
+			log.Printf("invalid MAGNETIC_DECLINATION=%q, using 0", s)
+		} else {
+			declination = d
 		}
-		metricAircraftInfo.With(infoLabels).Set(1)
 	}
 
-	// delete stale labels that were present previously but not in current set
-	prevAircraftLabelsMu.Lock()
-	defer prevAircraftLabelsMu.Unlock()
-
-	for k, labels := range prevAircraftLabels {
-		if _, ok := cur[k]; !ok {
-			// Delete all metrics for this aircraft
-			metricAircraftAltBaro.Delete(labels)
-			metricAircraftAltGeom.Delete(labels)
-			metricAircraftRssi.Delete(labels)
-			metricAircraftGS.Delete(labels)
-			metricAircraftIAS.Delete(labels)
-			metricAircraftTAS.Delete(labels)
-			metricAircraftMach.Delete(labels)
-			metricAircraftTrack.Delete(labels)
-			metricAircraftTrackRate.Delete(labels)
-			metricAircraftRoll.Delete(labels)
-			metricAircraftMagHeading.Delete(labels)
-			metricAircraftTrueHeading.Delete(labels)
-			metricAircraftBaroRate.Delete(labels)
-			metricAircraftGeomRate.Delete(labels)
-			metricAircraftLat.Delete(labels)
-			metricAircraftLon.Delete(labels)
-			metricAircraftNavQNH.Delete(labels)
-			metricAircraftNavHeading.Delete(labels)
-			metricAircraftNavAltMCP.Delete(labels)
-			metricAircraftNavAltFMS.Delete(labels)
-			metricAircraftNIC.Delete(labels)
-			metricAircraftRC.Delete(labels)
-			metricAircraftNICBaro.Delete(labels)
-			metricAircraftNACP.Delete(labels)
-			metricAircraftNACV.Delete(labels)
-			metricAircraftSIL.Delete(labels)
-			metricAircraftGVA.Delete(labels)
-			metricAircraftSDA.Delete(labels)
-			metricAircraftVersion.Delete(labels)
-			metricAircraftSeenPos.Delete(labels)
-			metricAircraftSeen.Delete(labels)
-			metricAircraftMessages.Delete(labels)
-
-			// Delete nav mode metrics
-			for _, mode := range []string{"autopilot", "vnav", "althold", "approach", "lnav", "tcas"} {
-				modeLabels := prometheus.Labels{
-					"hex":      labels["hex"],
-					"flight":   labels["flight"],
-					"category": labels["category"],
-					"mode":     mode,
-				}
-				metricAircraftNavModeActive.Delete(modeLabels)
+	// loaded in the background so a large database doesn't delay the
+	// first refresh; aircraft get no db_info until it is in
+	var aircraftDB func(string) (collector.AircraftInfo, bool)
+	if path := os.Getenv("AIRCRAFT_DB_PATH"); path != "" {
+		db := &aircraftdb.DB{}
+		aircraftDB = db.Lookup
+		go func() {
+			n, err := db.Load(path)
+			if err != nil {
+				log.Printf("aircraft db: %v, continuing without it", err)
+				return
 			}
-
-			delete(prevAircraftLabels, k)
-		}
+			log.Printf("loaded %d aircraft from %s", n, path)
+		}()
 	}
 
-	// replace previous set with current
-	for k, v := range cur {
-		prevAircraftLabels[k] = v
+	limitBy := getenv("MAX_AIRCRAFT_BY", collector.LimitByRSSI)
+	switch limitBy {
+	case collector.LimitByRSSI, collector.LimitBySeen:
+	case collector.LimitByDistance:
+		if receiver == nil {
+			log.Printf("MAX_AIRCRAFT_BY=%s needs RECEIVER_LAT and RECEIVER_LON, using %s", limitBy, collector.LimitByRSSI)
+			limitBy = collector.LimitByRSSI
+		}
+	default:
+		log.Printf("invalid MAX_AIRCRAFT_BY=%q, using %s", limitBy, collector.LimitByRSSI)
+		limitBy = collector.LimitByRSSI
 	}
 
-	return nil
-}
+	c := collector.New(registry, collector.Options{
+		SpeedUnit:      speedUnit,
+		AltUnit:        altUnit,
+		NoSanityBounds: os.Getenv("SANITY_BOUNDS") == "off",
+		StatsPeriods:   statsPeriods,
+		MaxAircraft:    getenvInt("MAX_AIRCRAFT", 0),
+		LimitBy:        limitBy,
+		Receiver:       receiver,
+		// e.g. CATEGORY_EXCLUDE=C*,B1 drops surface vehicles, obstacles
+		// and gliders
+		IncludeCategories:    getenvList("CATEGORY_INCLUDE"),
+		ExcludeCategories:    getenvList("CATEGORY_EXCLUDE"),
+		ExcludeEmptyCategory: getenv("EXCLUDE_EMPTY_CATEGORY", "false") == "true",
+		AltitudeBands:        getenvBands("ALTITUDE_BANDS"),
+		GeohashPrecision:     getenvInt("GEOHASH_PRECISION", collector.DefaultGeohashPrecision),
+		DistanceBands:        getenvBands("DISTANCE_BANDS"),
+		MaxPositionAge:       float64(getenvInt("POSITION_MAX_AGE_SECONDS", collector.DefaultMaxPositionAge)),
+		ExcludeMLATDistance:  getenv("EXCLUDE_MLAT_DISTANCE", "false") == "true",
+		RangeSector:          getenvInt("RANGE_SECTOR_DEGREES", collector.DefaultRangeSector),
+		RangePersistent:      getenv("RANGE_PERSISTENT", "false") == "true",
+		ClosestAircraftHex:   getenv("CLOSEST_AIRCRAFT_HEX", "false") == "true",
+		OverheadRadius:       getenvFloat("OVERHEAD_RADIUS_KM", 0),
+		OverheadMaxAltitude:  getenvFloat("OVERHEAD_MAX_ALT_FT", 0),
+		RSSIHistogram:        getenv("RSSI_HISTOGRAM", "false") == "true",
+		MagneticDeclination:  declination,
+		EmptyAircraftGrace:   getenvInt("EMPTY_AIRCRAFT_GRACE_CYCLES", 1),
+		DeleteGrace:          getenvInt("DELETE_GRACE_CYCLES", 0),
+		AircraftDB:           aircraftDB,
+		SessionGap:           float64(getenvInt("AIRCRAFT_SESSION_GAP_SECONDS", collector.DefaultSessionGap)),
+		StatsStaleAfter:      float64(getenvInt("STATS_STALE_SECONDS", collector.DefaultStatsStaleAfter)),
+		TurnDeadband:         getenvFloat("TURN_DEADBAND_DEGREES", collector.DefaultTurnDeadband),
+		// most DFs stay at zero on a small receiver
+		MessagesByDFNonZeroOnly: getenv("MESSAGES_BY_DF_NONZERO_ONLY", "false") == "true",
+	})
+	if getenv("VALIDATE", "false") == "true" {
+		os.Exit(validate(c, registry, statsPath, aircraftsPaths, os.Stdout, os.Stderr))
+	}
 
-func numericFromInterface(v interface{}) (float64, bool) {
-	if v == nil {
-		return 0, false
+	var r *refresher
+	if dir := os.Getenv("REPLAY_DIR"); dir != "" {
+		rp, err := newReplay(c, dir, getenvFloat("REPLAY_SPEED", 1))
+		if err != nil {
+			log.Fatalf("replay: %v", err)
+		}
+		// nothing to stat: what is due depends on the clock
+		r = newRefresher(c, statsPath, nil, getenvInt("FAILURE_GRACE_CYCLES", 3))
+		r.loadAircraft = func(ctx context.Context) error {
+			return rp.update(ctx, r.observeAircraft)
+		}
+		// as shown on the index page
+		aircraftsPaths = []string{dir}
+		log.Printf("replaying %d aircraft snapshots from %s at %gx", len(rp.files), dir, rp.speed)
+	} else {
+		r = newRefresher(c, statsPath, aircraftsPaths, getenvInt("FAILURE_GRACE_CYCLES", 3))
 	}
-	switch t := v.(type) {
-	case float64:
-		return t, true
-	case float32:
-		return float64(t), true
-	case int:
-		return float64(t), true
-	case int64:
-		return float64(t), true
-	case json.Number:
-		if f, err := t.Float64(); err == nil {
-			return f, true
-		}
-	case string:
-		if f, err := strconv.ParseFloat(t, 64); err == nil {
-			return f, true
-		}
+	r.alwaysReload = getenv("ALWAYS_RELOAD", "false") == "true"
+	// a read hanging on a stalled network mount fails the source instead
+	// of freezing its metrics; 0 waits indefinitely
+	r.readTimeout = time.Duration(getenvInt("READ_TIMEOUT_SECONDS", 30)) * time.Second
+	if receiverPath := os.Getenv("RECEIVER_PATH"); receiverPath != "" {
+		readHistory := getenv("RECEIVER_HISTORY", "false") == "true"
+		s := &source{name: "receiver", clear: c.ClearReceiver, update: func(ctx context.Context) error {
+			return c.UpdateReceiverFromFileContext(ctx, receiverPath, readHistory)
+		}}
+		// the history files change without receiver.json doing so
+		if !readHistory {
+			s.paths = []string{receiverPath}
+		}
+		r.add(s)
 	}
-	return 0, false
-}
+	// labelled once per snapshot rather than on every scrape
+	site := collector.SanitizeLabelValue(os.Getenv("SITE_NAME"))
+	if site != os.Getenv("SITE_NAME") {
+		log.Printf("SITE_NAME is not valid UTF-8 or longer than %d bytes, using %q", collector.MaxLabelValueLength, site)
+	}
+	r.gatherer = withSite(r.gatherer, site)
 
-func getenv(key, def string) string {
-	if v := os.Getenv(key); v != "" {
-		return v
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var background sync.WaitGroup
+	if path := os.Getenv("HISTORY_DB_PATH"); path != "" {
+		opts := history.Options{
+			Path:          path,
+			FlushInterval: time.Duration(getenvInt("HISTORY_FLUSH_SECONDS", 60)) * time.Second,
+			Retention:     time.Duration(getenvInt("HISTORY_RETENTION_DAYS", 0)) * 24 * time.Hour,
+		}
+		if receiver != nil {
+			opts.Distance = receiver.Distance
+		}
+		sink, err := history.Open(opts)
+		if err != nil {
+			log.Fatalf("history: %v", err)
+		}
+		defer sink.Close()
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			sink.Run(ctx)
+		}()
+		r.onAircraft = append(r.onAircraft, func(a *collector.AircraftsFile) {
+			if !sink.Observe(a) {
+				log.Printf("history sink is behind, dropped aircraft snapshot")
+			}
+		})
+		log.Printf("recording sighting history to %s", path)
 	}
-	return def
-}
 
-func main() {
-	statsPath := getenv("STATS_PATH", "stats.json")
-	aircraftsPath := getenv("AIRCRAFTS_PATH", "aircrafts.json")
-	listenAddr := getenv("LISTEN_ADDR", ":9187")
-	intervalSecStr := getenv("INTERVAL_SECONDS", "5")
-	intervalSec, err := strconv.Atoi(intervalSecStr)
-	if err != nil || intervalSec <= 0 {
-		log.Printf("invalid INTERVAL_SECONDS=%q, using 5", intervalSecStr)
-		intervalSec = 5
+	if path := os.Getenv("SIGHTINGS_CSV_PATH"); path != "" {
+		sl, err := csvlog.New(csvlog.Options{
+			Path:          path,
+			Daily:         getenv("SIGHTINGS_CSV_ROTATE", "daily") == "daily",
+			FlushInterval: time.Duration(getenvInt("SIGHTINGS_CSV_FLUSH_SECONDS", 10)) * time.Second,
+			MaxPending:    getenvInt("SIGHTINGS_CSV_MAX_PENDING", 10000),
+		})
+		if err != nil {
+			log.Fatalf("sighting log: %v", err)
+		}
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			sl.Run(ctx)
+		}()
+		r.onAircraft = append(r.onAircraft, func(a *collector.AircraftsFile) {
+			if !sl.Observe(a) {
+				log.Printf("sighting log is behind, dropped aircraft snapshot")
+			}
+		})
+		log.Printf("writing sighting log to %s", path)
 	}
-	interval := time.Duration(intervalSec) * time.Second
 
-	// initial load
-	if err := updateStatsFromFile(statsPath); err != nil {
-		log.Printf("initial stats load failed: %v", err)
+	if url := os.Getenv("PUSHGATEWAY_URL"); url != "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			log.Fatalf("pushgateway: hostname: %v", err)
+		}
+		pusher := push.New(url, getenv("PUSHGATEWAY_JOB", "adsb_exporter")).
+			Gatherer(snapshot).
+			Grouping("instance", hostname).
+			Client(&http.Client{Timeout: interval})
+		r.onSnapshot = append(r.onSnapshot, func() {
+			if err := pusher.PushContext(ctx); err != nil {
+				pushgatewayFailures.Inc()
+				log.Printf("push to pushgateway failed: %v", err)
+			}
+		})
+		log.Printf("pushing metrics to %s as instance %q", url, hostname)
 	}
-	if err := updateAircraftsFromFile(aircraftsPath); err != nil {
-		log.Printf("initial aircrafts load failed: %v", err)
+
+	if url := os.Getenv("REMOTE_WRITE_URL"); url != "" {
+		rw, err := remotewrite.New(remotewrite.Options{
+			URL:         url,
+			Username:    os.Getenv("REMOTE_WRITE_USERNAME"),
+			Password:    os.Getenv("REMOTE_WRITE_PASSWORD"),
+			BearerToken: os.Getenv("REMOTE_WRITE_BEARER_TOKEN"),
+			Timeout:     interval,
+			Retries:     getenvInt("REMOTE_WRITE_RETRIES", 3),
+		})
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		// a write still retrying when the next snapshot arrives makes that
+		// one be dropped rather than queued behind it
+		var busy atomic.Bool
+		r.onSnapshot = append(r.onSnapshot, func() {
+			if !busy.CompareAndSwap(false, true) {
+				remoteWriteFailures.Inc()
+				log.Printf("remote write is behind, dropped snapshot")
+				return
+			}
+			families, err := snapshot.Gather()
+			if err != nil {
+				busy.Store(false)
+				remoteWriteFailures.Inc()
+				log.Printf("remote write: gather: %v", err)
+				return
+			}
+			go func() {
+				defer busy.Store(false)
+				if _, err := rw.Write(ctx, families, time.Now()); err != nil {
+					remoteWriteFailures.Inc()
+					log.Printf("remote write failed: %v", err)
+				}
+			}()
+		})
+		log.Printf("remote-writing metrics to %s", url)
 	}
 
-	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-	defer stop()
+	// initial load
+	r.refresh(ctx).Wait()
 
 	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
+	background.Add(1)
 	go func() {
+		defer background.Done()
 		for {
 			select {
 			case <-ctx.Done():
 				return
 			case <-ticker.C:
-				if err := updateStatsFromFile(statsPath); err != nil {
-					log.Printf("reload stats failed: %v", err)
-				}
-				if err := updateAircraftsFromFile(aircraftsPath); err != nil {
-					log.Printf("reload aircrafts failed: %v", err)
-				}
+				r.refresh(ctx)
 			}
 		}
 	}()
 
 	mux := http.NewServeMux()
-	mux.Handle("/metrics", promhttp.Handler())
-
-	server := &http.Server{
-		Addr:    listenAddr,
-		Handler: mux,
+	// Go/process metrics come live from runtimeRegistry; exporter metrics
+	// come from the last complete snapshot.
+	gatherers := prometheus.Gatherers{snapshot}
+	if getenv("DISABLE_RUNTIME_METRICS", "false") != "true" {
+		gatherers = append(gatherers, withSite(runtimeRegistry, site))
+	}
+	mux.Handle("/metrics", promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{}))
+	a := &api{c: c, receiver: receiver}
+	mux.HandleFunc("/api/v1/aircraft", a.handleAircraft)
+	mux.HandleFunc("/api/v1/stats", a.handleStats)
+
+	// health probes go on their own port when HEALTH_LISTEN_ADDR is set,
+	// so /metrics can be firewalled separately
+	healthMux := mux
+	servers := []*http.Server{{Handler: mux}}
+	healthAddr := os.Getenv("HEALTH_LISTEN_ADDR")
+	if healthAddr != "" {
+		healthMux = http.NewServeMux()
+		servers = append(servers, &http.Server{Handler: healthMux})
+	}
+	healthMux.HandleFunc("/healthz", handleHealthz)
+	healthMux.HandleFunc("/readyz", r.handleReady)
+	mux.Handle("/", &indexPage{
+		ListenAddr:    listenAddr,
+		StatsPath:     statsPath,
+		AircraftsPath: strings.Join(aircraftsPaths, ", "),
+		Interval:      interval,
+		HealthAddr:    healthAddr,
+	})
+
+	// addresses are TCP addresses or unix:/path/to/socket
+	serve(servers[0], listenAddr, "metrics")
+	if healthAddr != "" {
+		serve(servers[1], healthAddr, "health")
 	}
-
-	go func() {
-		log.Printf("starting metrics server on %s", listenAddr)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("metrics server failed: %v", err)
-		}
-	}()
 
 	<-ctx.Done()
 	log.Printf("shutdown signal received, shutting down")
 
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
-	if err := server.Shutdown(shutdownCtx); err != nil {
-		log.Printf("graceful shutdown failed: %v", err)
+	var shutdown sync.WaitGroup
+	for _, server := range servers {
+		shutdown.Add(1)
+		go func() {
+			defer shutdown.Done()
+			if err := server.Shutdown(shutdownCtx); err != nil {
+				log.Printf("graceful shutdown failed: %v", err)
+			}
+		}()
 	}
+	shutdown.Wait()
+	// the ticker goroutine has returned once background is done, so no
+	// reload can start after wait
+	background.Wait()
+	r.wait()
 	log.Printf("exited")
 }
@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestParseInterval(t *testing.T) {
+	for _, tt := range []struct {
+		s       string
+		max     int
+		want    int
+		problem bool
+	}{
+		{"5", 300, 5, false},
+		{"1", 300, 1, false},
+		{"300", 300, 300, false},
+		{"50000", 300, 300, true},
+		{"600", 900, 600, false},
+		{"0", 300, 5, true},
+		{"-3", 300, 5, true},
+		{"1.5", 300, 5, true},
+		{"soon", 300, 5, true},
+		// a maximum under the default also bounds the fallback
+		{"x", 2, 2, true},
+		// no usable maximum: the default one
+		{"50000", 0, 300, true},
+	} {
+		got, problem := parseInterval(tt.s, tt.max)
+		if got != tt.want || (problem != "") != tt.problem {
+			t.Errorf("parseInterval(%q, %d) = %d, %q; want %d, problem %v", tt.s, tt.max, got, problem, tt.want, tt.problem)
+		}
+	}
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Kentaro1043/adsb-exporter/internal/collector"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var refreshSkipped = promauto.With(registry).NewCounterVec(prometheus.CounterOpts{
+	Name: "adsb_exporter_refresh_skipped_total",
+	Help: "Refresh cycles skipped because the previous reload of the source was still running",
+}, []string{"source"})
+
+var updatesSkipped = promauto.With(registry).NewCounterVec(prometheus.CounterOpts{
+	Name: "adsb_exporter_updates_skipped_total",
+	Help: "Reloads skipped because the source file's size and modification time were unchanged since the last successful one",
+}, []string{"source"})
+
+var consecutiveFailures = promauto.With(registry).NewGaugeVec(prometheus.GaugeOpts{
+	Name: "adsb_exporter_consecutive_failures",
+	Help: "Consecutive failed reloads of the source; reset to 0 by a successful one",
+}, []string{"source"})
+
+var readTimeouts = promauto.With(registry).NewCounterVec(prometheus.CounterOpts{
+	Name: "adsb_exporter_read_timeouts_total",
+	Help: "Reloads of the source abandoned after READ_TIMEOUT_SECONDS, such as reads hanging on a stalled network mount",
+}, []string{"source"})
+
+var up = promauto.With(registry).NewGaugeVec(prometheus.GaugeOpts{
+	Name: "adsb_up",
+	Help: "Whether the last read and parse of the source file succeeded (1) or not (0); file is the source name",
+}, []string{"file"})
+
+// failureLogEvery is how often a source that keeps failing is logged again
+// after its first failure, so a feeder without stats.json doesn't fill the
+// log. The failure count is always visible in adsb_exporter_consecutive_failures.
+const failureLogEvery = 60
+
+// sourceStatus is a source's state after its last reload, as served on
+// /readyz.
+type sourceStatus struct {
+	OK                  bool      `json:"ok"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	LastError           string    `json:"last_error,omitempty"`
+	LastSuccess         time.Time `json:"last_success,omitzero"`
+}
+
+// fileVersion identifies a file's content by what stat reports, which is
+// enough to notice a rewrite as long as the filesystem's mtimes are fine
+// grained.
+type fileVersion struct {
+	size    int64
+	modTime int64 // UnixNano
+}
+
+// source is one input reloaded on every tick.
+type source struct {
+	name string
+	// update reloads the source; ctx is cancelled on shutdown.
+	update func(ctx context.Context) error
+	// paths are the files update reads, stat'ed first to skip unchanged
+	// content; empty to always update.
+	paths []string
+	// loaded are the versions of paths last updated successfully; only
+	// touched while busy.
+	loaded []fileVersion
+	// clear unpublishes the source's metrics once it has failed more than
+	// the grace allows.
+	clear func()
+	// busy is set while update runs; a tick that finds it set skips the
+	// source instead of queueing behind it.
+	busy atomic.Bool
+	// reading is set while a load is in flight, which may outlast busy
+	// when it times out; no other load starts until it returns.
+	reading atomic.Bool
+	// failures counts consecutive failed updates; only touched while busy.
+	failures int
+	// status is replaced after every update; nil until the first one.
+	status atomic.Pointer[sourceStatus]
+}
+
+// refresher reloads every source on each tick. Sources are reloaded
+// concurrently so a slow one doesn't hold back the others.
+type refresher struct {
+	c       *collector.Collector
+	sources []*source
+	// gatherer is snapshotted after each source finishes.
+	gatherer prometheus.Gatherer
+	// grace is how many consecutive failures keep the last-good metrics
+	// published before the source is cleared.
+	grace int
+	// alwaysReload disables skipping files whose size and mtime are
+	// unchanged, for filesystems with coarse mtimes.
+	alwaysReload bool
+	// readTimeout bounds each reload, stat included; zero waits for as
+	// long as it takes.
+	readTimeout time.Duration
+
+	// loadAircraft reloads the aircraft source and calls observeAircraft
+	// after each file it applies; newRefresher sets it to read the
+	// aircraft.json paths.
+	loadAircraft func(ctx context.Context) error
+	// onAircraft is called with every successfully parsed aircraft.json.
+	// Hooks must not block.
+	onAircraft []func(*collector.AircraftsFile)
+	// onSnapshot is called once all sources started by a refresh have
+	// finished and published.
+	onSnapshot []func()
+
+	// running counts reloads in flight, for wait.
+	running sync.WaitGroup
+}
+
+func newRefresher(c *collector.Collector, statsPath string, aircraftsPaths []string, grace int) *refresher {
+	r := &refresher{c: c, gatherer: c.Gatherer(registry), grace: grace}
+	r.loadAircraft = func(ctx context.Context) error {
+		if err := c.UpdateAircraftsFromFilesContext(ctx, aircraftsPaths...); err != nil {
+			return err
+		}
+		// a load that timed out after applying has been reported failed
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		r.observeAircraft()
+		return nil
+	}
+	for _, s := range []*source{
+		{name: "stats", paths: []string{statsPath}, clear: c.ClearStats, update: func(ctx context.Context) error {
+			return c.UpdateStatsFromFileContext(ctx, statsPath)
+		}},
+		{name: "aircraft", paths: aircraftsPaths, clear: c.ClearAircraft, update: func(ctx context.Context) error {
+			return r.loadAircraft(ctx)
+		}},
+	} {
+		r.add(s)
+	}
+	return r
+}
+
+// observeAircraft passes the aircraft.json just applied to the onAircraft
+// hooks.
+func (r *refresher) observeAircraft() {
+	if file, _ := r.c.ParsedAircraft(); file != nil {
+		for _, fn := range r.onAircraft {
+			fn(file)
+		}
+	}
+}
+
+// add registers another source, reloaded from the next refresh on.
+func (r *refresher) add(s *source) {
+	r.sources = append(r.sources, s)
+	consecutiveFailures.WithLabelValues(s.name)
+	up.WithLabelValues(s.name)
+	updatesSkipped.WithLabelValues(s.name)
+	readTimeouts.WithLabelValues(s.name)
+}
+
+// refresh starts a reload of every source that is not still busy with the
+// previous one. Each source publishes a new snapshot when it finishes. The
+// returned WaitGroup is done once all started reloads have published. Once
+// ctx is cancelled no reload is started, and running ones see it cancelled.
+func (r *refresher) refresh(ctx context.Context) *sync.WaitGroup {
+	var wg sync.WaitGroup
+	for _, s := range r.sources {
+		if ctx.Err() != nil {
+			break
+		}
+		if !s.busy.CompareAndSwap(false, true) {
+			refreshSkipped.WithLabelValues(s.name).Inc()
+			log.Printf("reload %s still running, skipping cycle", s.name)
+			continue
+		}
+		wg.Add(1)
+		r.running.Add(1)
+		go func() {
+			defer r.running.Done()
+			defer wg.Done()
+			defer s.busy.Store(false)
+			r.update(ctx, s)
+			if err := snapshot.update(r.gatherer); err != nil {
+				log.Printf("gather snapshot failed: %v", err)
+			}
+		}()
+	}
+	if len(r.onSnapshot) > 0 {
+		go func() {
+			wg.Wait()
+			for _, fn := range r.onSnapshot {
+				fn()
+			}
+		}()
+	}
+	return &wg
+}
+
+// update runs one reload of s and keeps its failure count. The last-good
+// metrics stay published for up to grace consecutive failures; the next one
+// clears them so absence-based alerts fire. A later success repopulates them.
+//
+// Files whose size and mtime all match the last successful reload are not
+// read again; the status is left as it was. A reload outlasting readTimeout
+// counts as a failure; see load.
+func (r *refresher) update(ctx context.Context, s *source) {
+	res := r.load(ctx, s)
+	if res.skipped {
+		updatesSkipped.WithLabelValues(s.name).Inc()
+		return
+	}
+	vers := res.vers
+
+	st := &sourceStatus{}
+	if prev := s.status.Load(); prev != nil {
+		st.LastSuccess = prev.LastSuccess
+	}
+	defer func() {
+		st.ConsecutiveFailures = s.failures
+		s.status.Store(st)
+		consecutiveFailures.WithLabelValues(s.name).Set(float64(s.failures))
+	}()
+	if err := res.err; err != nil {
+		s.loaded = nil
+		s.failures++
+		st.LastError = err.Error()
+		up.WithLabelValues(s.name).Set(0)
+		if s.failures == 1 || s.failures%failureLogEvery == 0 {
+			log.Printf("reload %s failed (%d in a row, logged every %d): %v", s.name, s.failures, failureLogEvery, err)
+		}
+		if s.failures == r.grace+1 && s.clear != nil {
+			log.Printf("reload %s failed %d times in a row, unpublishing its metrics", s.name, s.failures)
+			s.clear()
+		}
+		return
+	}
+	if s.failures > 0 {
+		log.Printf("reload %s recovered after %d failures", s.name, s.failures)
+	}
+	s.failures = 0
+	// stat'ed before reading, so a rewrite in between is reloaded next time
+	s.loaded = vers
+	st.OK = true
+	st.LastSuccess = time.Now()
+	up.WithLabelValues(s.name).Set(1)
+}
+
+// loadResult is the outcome of one load of a source.
+type loadResult struct {
+	// versions of the source's paths, stat'ed before reading
+	vers    []fileVersion
+	skipped bool
+	err     error
+}
+
+// load stats s's files and, unless unchanged, reloads s. With readTimeout
+// set it runs in a goroutine of its own, as file reads don't take a
+// context: one still running when the timeout passes is reported as failed
+// and left to finish in the background, and until it does the source's
+// later loads fail at once rather than pile up behind it. Its context is
+// done by then, so s.update must not apply anything once it is; the
+// collector's Update*Context methods check it under applyMu.
+func (r *refresher) load(ctx context.Context, s *source) loadResult {
+	// copied here, as a load that times out may still be running when the
+	// caller next changes them
+	loaded, failures := s.loaded, s.failures
+	run := func(ctx context.Context) loadResult {
+		var res loadResult
+		if len(s.paths) > 0 && !r.alwaysReload {
+			res.vers = statFiles(s.paths)
+			if res.vers != nil && failures == 0 && slices.Equal(res.vers, loaded) {
+				res.skipped = true
+				return res
+			}
+		}
+		res.err = s.update(ctx)
+		return res
+	}
+	if r.readTimeout <= 0 {
+		return run(ctx)
+	}
+	if !s.reading.CompareAndSwap(false, true) {
+		return loadResult{err: errors.New("an earlier reload timed out and is still running")}
+	}
+	ctx, cancel := context.WithTimeout(ctx, r.readTimeout)
+	defer cancel()
+	done := make(chan loadResult, 1)
+	// tracked in running so that wait also waits for a timed-out load
+	r.running.Add(1)
+	go func() {
+		defer r.running.Done()
+		defer s.reading.Store(false)
+		done <- run(ctx)
+	}()
+	select {
+	case res := <-done:
+		return res
+	case <-ctx.Done():
+		if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return loadResult{err: ctx.Err()}
+		}
+		readTimeouts.WithLabelValues(s.name).Inc()
+		return loadResult{err: fmt.Errorf("timed out after %v", r.readTimeout)}
+	}
+}
+
+// statFiles returns the version of each of paths, or nil if any can't be
+// stat'ed.
+func statFiles(paths []string) []fileVersion {
+	vers := make([]fileVersion, len(paths))
+	for i, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil
+		}
+		vers[i] = fileVersion{size: fi.Size(), modTime: fi.ModTime().UnixNano()}
+	}
+	return vers
+}
+
+// wait blocks until every reload started by refresh has finished, timed-out
+// ones left running in the background included. Call it only once no more
+// refreshes will be started.
+func (r *refresher) wait() {
+	r.running.Wait()
+}
+
+// handleReady reports every source's status. It answers 200 while at least
+// one source is healthy, so a feeder without stats.json is still ready on
+// aircraft data alone, and 503 otherwise.
+func (r *refresher) handleReady(w http.ResponseWriter, req *http.Request) {
+	statuses := make(map[string]*sourceStatus, len(r.sources))
+	ready := false
+	for _, s := range r.sources {
+		st := s.status.Load()
+		if st == nil {
+			st = &sourceStatus{}
+		}
+		statuses[s.name] = st
+		ready = ready || st.OK
+	}
+	if !ready {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	writeJSON(w, statuses)
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Kentaro1043/adsb-exporter/internal/collector"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRefreshSkipsBusySource(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	fastGauge := prometheus.NewGauge(prometheus.GaugeOpts{Name: "fast_updates"})
+	reg.MustRegister(fastGauge)
+
+	release := make(chan struct{})
+	var slowRuns, fastRuns atomic.Int32
+	slow := &source{name: "slow", update: func(context.Context) error {
+		slowRuns.Add(1)
+		<-release
+		return nil
+	}}
+	fast := &source{name: "fast", update: func(context.Context) error {
+		fastGauge.Set(float64(fastRuns.Add(1)))
+		return nil
+	}}
+	r := &refresher{gatherer: reg, sources: []*source{slow, fast}}
+	skippedBefore := testutil.ToFloat64(refreshSkipped.WithLabelValues("slow"))
+
+	first := r.refresh(t.Context())
+	waitFor(t, func() bool { return fastRuns.Load() == 1 && !fast.busy.Load() })
+	second := r.refresh(t.Context())
+
+	// the fast source publishes while the slow one is still reading
+	waitFor(t, func() bool { return snapshotValue(t, "fast_updates") == 2 })
+
+	close(release)
+	first.Wait()
+	second.Wait()
+
+	if n := slowRuns.Load(); n != 1 {
+		t.Errorf("slow source ran %d times, want 1", n)
+	}
+	if n := fastRuns.Load(); n != 2 {
+		t.Errorf("fast source ran %d times, want 2", n)
+	}
+	if d := testutil.ToFloat64(refreshSkipped.WithLabelValues("slow")) - skippedBefore; d != 1 {
+		t.Errorf("skipped counter for slow source increased by %v, want 1", d)
+	}
+}
+
+// snapshotValue returns the first sample of the named family in the current
+// snapshot, or -1 if absent.
+func snapshotValue(t *testing.T, name string) float64 {
+	t.Helper()
+	mfs, err := snapshot.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() == name && len(mf.GetMetric()) > 0 {
+			return mf.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+	return -1
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for i := 0; i < 1000; i++ {
+		if cond() {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("condition not met within 1s")
+}
+
+func TestRefreshFailureGrace(t *testing.T) {
+	fail := true
+	var clears int
+	s := &source{
+		name: "flaky",
+		update: func(context.Context) error {
+			if fail {
+				return errors.New("read failed")
+			}
+			return nil
+		},
+		clear: func() { clears++ },
+	}
+	r := &refresher{gatherer: prometheus.NewRegistry(), grace: 2, sources: []*source{s}}
+	failures := func() float64 { return testutil.ToFloat64(consecutiveFailures.WithLabelValues("flaky")) }
+	isUp := func() float64 { return testutil.ToFloat64(up.WithLabelValues("flaky")) }
+
+	for i, wantClears := range []int{0, 0, 1, 1} {
+		r.refresh(t.Context()).Wait()
+		if clears != wantClears {
+			t.Errorf("after failure %d: cleared %d times, want %d", i+1, clears, wantClears)
+		}
+		if got := failures(); got != float64(i+1) {
+			t.Errorf("after failure %d: consecutive failures = %v", i+1, got)
+		}
+		if got := isUp(); got != 0 {
+			t.Errorf("after failure %d: adsb_up = %v, want 0", i+1, got)
+		}
+	}
+
+	fail = false
+	r.refresh(t.Context()).Wait()
+	if got := failures(); got != 0 {
+		t.Errorf("after recovery: consecutive failures = %v, want 0", got)
+	}
+	if got := isUp(); got != 1 {
+		t.Errorf("after recovery: adsb_up = %v, want 1", got)
+	}
+}
+
+func TestRefreshReadTimeout(t *testing.T) {
+	release := make(chan struct{})
+	var calls atomic.Int32
+	s := &source{name: "hung", update: func(context.Context) error {
+		// a read stuck in the kernel doesn't notice ctx
+		if calls.Add(1) == 1 {
+			<-release
+		}
+		return nil
+	}}
+	r := &refresher{gatherer: prometheus.NewRegistry(), grace: 5, readTimeout: 10 * time.Millisecond, sources: []*source{s}}
+	timeoutsBefore := testutil.ToFloat64(readTimeouts.WithLabelValues("hung"))
+
+	r.refresh(t.Context()).Wait()
+	if st := s.status.Load(); st.OK || st.LastError != "timed out after 10ms" {
+		t.Errorf("after timeout: status %+v", st)
+	}
+	if d := testutil.ToFloat64(readTimeouts.WithLabelValues("hung")) - timeoutsBefore; d != 1 {
+		t.Errorf("timeout counter increased by %v, want 1", d)
+	}
+
+	// the hung read is still there: fail without starting another
+	r.refresh(t.Context()).Wait()
+	if n := calls.Load(); n != 1 {
+		t.Errorf("%d reads started while the first hung, want 1", n)
+	}
+	if st := s.status.Load(); st.OK || st.ConsecutiveFailures != 2 {
+		t.Errorf("while hung: status %+v", st)
+	}
+
+	close(release)
+	waitFor(t, func() bool { return !s.reading.Load() })
+	r.refresh(t.Context()).Wait()
+	if st := s.status.Load(); !st.OK || st.ConsecutiveFailures != 0 {
+		t.Errorf("after the read returned: status %+v", st)
+	}
+}
+
+func TestRefreshDiscardsTimedOutLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.json")
+	if err := os.WriteFile(path, []byte(`{"latest": {"messages": 5}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := collector.New(prometheus.NewRegistry(), collector.Options{})
+	release := make(chan struct{})
+	s := &source{name: "late", update: func(ctx context.Context) error {
+		<-release
+		return c.UpdateStatsFromFileContext(ctx, path)
+	}}
+	r := &refresher{gatherer: prometheus.NewRegistry(), grace: 5, readTimeout: 10 * time.Millisecond, sources: []*source{s}}
+
+	r.refresh(t.Context()).Wait()
+	close(release)
+	// returns only once the timed-out load has finished
+	r.wait()
+	if s.reading.Load() {
+		t.Error("wait returned while the timed-out load was running")
+	}
+	if stats, _ := c.ParsedStats(); stats != nil {
+		t.Errorf("timed-out load applied %+v", stats)
+	}
+}
+
+func TestRefreshStopsOnCancel(t *testing.T) {
+	var calls atomic.Int32
+	var seen context.Context
+	s := &source{name: "cancel", update: func(ctx context.Context) error {
+		calls.Add(1)
+		seen = ctx
+		return nil
+	}}
+	r := &refresher{gatherer: prometheus.NewRegistry(), sources: []*source{s}}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	r.refresh(ctx).Wait()
+	if seen != ctx {
+		t.Error("update did not get the refresh context")
+	}
+	cancel()
+	r.refresh(ctx).Wait()
+	r.wait()
+	if got := calls.Load(); got != 1 {
+		t.Errorf("updates = %d, want 1 (none after cancel)", got)
+	}
+}
+
+func TestRefreshSkipsUnchangedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.json")
+	if err := os.WriteFile(path, []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var runs int
+	s := &source{name: "unchanged", paths: []string{path}, update: func(context.Context) error {
+		runs++
+		return nil
+	}}
+	r := &refresher{gatherer: prometheus.NewRegistry(), sources: []*source{s}}
+
+	r.refresh(t.Context()).Wait()
+	r.refresh(t.Context()).Wait()
+	if runs != 1 {
+		t.Errorf("unchanged file read %d times, want 1", runs)
+	}
+	if got := testutil.ToFloat64(updatesSkipped.WithLabelValues("unchanged")); got != 1 {
+		t.Errorf("updates skipped = %v, want 1", got)
+	}
+
+	// a rewrite is picked up even when the size is the same
+	if err := os.WriteFile(path, []byte("[]"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Second)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	r.refresh(t.Context()).Wait()
+	if runs != 2 {
+		t.Errorf("rewritten file read %d times in total, want 2", runs)
+	}
+
+	r.alwaysReload = true
+	r.refresh(t.Context()).Wait()
+	if runs != 3 {
+		t.Errorf("with alwaysReload read %d times in total, want 3", runs)
+	}
+}
+
+func TestHandleReady(t *testing.T) {
+	statsErr := errors.New("open stats.json: no such file or directory")
+	aircraftOK := true
+	r := &refresher{gatherer: prometheus.NewRegistry(), grace: 3, sources: []*source{
+		{name: "stats", update: func(context.Context) error { return statsErr }},
+		{name: "aircraft", update: func(context.Context) error {
+			if !aircraftOK {
+				return errors.New("read failed")
+			}
+			return nil
+		}},
+	}}
+	ready := func() (int, map[string]sourceStatus) {
+		rec := httptest.NewRecorder()
+		r.handleReady(rec, httptest.NewRequest("GET", "/readyz", nil))
+		var body map[string]sourceStatus
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		return rec.Code, body
+	}
+
+	if code, _ := ready(); code != http.StatusServiceUnavailable {
+		t.Errorf("before first load: status %d, want 503", code)
+	}
+
+	r.refresh(t.Context()).Wait()
+	code, body := ready()
+	if code != http.StatusOK {
+		t.Errorf("with aircraft only: status %d, want 200", code)
+	}
+	if st := body["stats"]; st.OK || st.ConsecutiveFailures != 1 || st.LastError != statsErr.Error() {
+		t.Errorf("stats status = %+v", st)
+	}
+	if st := body["aircraft"]; !st.OK || st.LastSuccess.IsZero() {
+		t.Errorf("aircraft status = %+v", st)
+	}
+
+	aircraftOK = false
+	r.refresh(t.Context()).Wait()
+	if code, _ := ready(); code != http.StatusServiceUnavailable {
+		t.Errorf("with both failing: status %d, want 503", code)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Kentaro1043/adsb-exporter/internal/collector"
+)
+
+// replay feeds archived aircraft.json snapshots through the collector in
+// place of the live files, for looking back at past events. Snapshots are
+// applied in name order, paced by their now field: at speed 1 one recorded
+// second takes one second. Only touched by the aircraft source's reload.
+type replay struct {
+	c     *collector.Collector
+	files []string
+	// speed 0 applies one snapshot per refresh regardless of now
+	speed float64
+	next  int
+	// wall clock and snapshot time the replay started at
+	start    time.Time
+	startNow float64
+	// now is time.Now, swapped in tests
+	now func() time.Time
+}
+
+// newReplay lists the .json and .json.gz files in dir.
+func newReplay(c *collector.Collector, dir string, speed float64) (*replay, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	// ReadDir returns them sorted by name
+	for _, e := range entries {
+		name := e.Name()
+		if !e.IsDir() && (strings.HasSuffix(name, ".json") || strings.HasSuffix(name, ".json.gz")) {
+			files = append(files, filepath.Join(dir, name))
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no .json or .json.gz files in %s", dir)
+	}
+	return &replay{c: c, files: files, speed: speed, now: time.Now}, nil
+}
+
+// update applies every snapshot that has come due since the last call,
+// calling applied after each one. A snapshot that fails is reported and
+// passed over, so the replay doesn't stall on it. Once the last one has been
+// applied its metrics stay.
+func (p *replay) update(ctx context.Context, applied func()) error {
+	for p.next < len(p.files) && ctx.Err() == nil {
+		path := p.files[p.next]
+		if p.speed > 0 {
+			ts, err := snapshotNow(path)
+			if err != nil {
+				p.next++
+				return fmt.Errorf("replay %s: %w", path, err)
+			}
+			if p.start.IsZero() {
+				p.start, p.startNow = p.now(), ts
+			}
+			due := p.start.Add(time.Duration((ts - p.startNow) / p.speed * float64(time.Second)))
+			if p.now().Before(due) {
+				return nil
+			}
+		}
+		p.next++
+		if p.next == len(p.files) {
+			log.Printf("replay reached its last file, %s", path)
+		}
+		if err := p.c.UpdateAircraftsFromFilesContext(ctx, path); err != nil {
+			return fmt.Errorf("replay %s: %w", path, err)
+		}
+		// a load that timed out after applying has been reported failed
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		applied()
+		if p.speed <= 0 {
+			return nil
+		}
+	}
+	return nil
+}
+
+// snapshotNow reads just the now field of an aircraft.json, gunzipped if
+// path ends in .gz.
+func snapshotNow(path string) (float64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return 0, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	var a struct {
+		Now float64 `json:"now"`
+	}
+	if err := json.NewDecoder(r).Decode(&a); err != nil {
+		return 0, err
+	}
+	return a.Now, nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Kentaro1043/adsb-exporter/internal/collector"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestReplay(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a.json", `{"now": 1000, "aircraft": [{"hex": "aaaaaa"}]}`)
+	f, err := os.Create(filepath.Join(dir, "b.json.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := gzip.NewWriter(f)
+	if _, err := zw.Write([]byte(`{"now": 1010, "aircraft": [{"hex": "bbbbbb"}]}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	write("c.json", `{"now": 1030, "aircraft": []}`)
+	write("notes.txt", "not a snapshot")
+
+	c := collector.New(prometheus.NewRegistry(), collector.Options{})
+	p, err := newReplay(c, dir, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(0, 0)
+	p.now = func() time.Time { return now }
+	var seen []float64
+	applied := func() {
+		a, _ := c.ParsedAircraft()
+		seen = append(seen, a.Now)
+	}
+	for i, tt := range []struct {
+		elapsed time.Duration
+		want    []float64
+	}{
+		{0, []float64{1000}},
+		{500 * time.Millisecond, []float64{1000}},
+		// ten recorded seconds take one
+		{500 * time.Millisecond, []float64{1000, 1010}},
+		{5 * time.Second, []float64{1000, 1010, 1030}},
+		// finished: nothing more
+		{time.Second, []float64{1000, 1010, 1030}},
+	} {
+		now = now.Add(tt.elapsed)
+		if err := p.update(t.Context(), applied); err != nil {
+			t.Fatalf("update %d: %v", i, err)
+		}
+		if !slices.Equal(seen, tt.want) {
+			t.Errorf("update %d: applied %v, want %v", i, seen, tt.want)
+		}
+	}
+}
+
+func TestReplayCancelled(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.json"), []byte(`{"now": 1000, "aircraft": [{"hex": "aaaaaa"}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	c := collector.New(prometheus.NewRegistry(), collector.Options{})
+	p, err := newReplay(c, dir, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the load's context runs out once the snapshot is due, as a read
+	// timeout would while it is being read
+	ctx, cancel := context.WithCancel(t.Context())
+	p.now = func() time.Time {
+		cancel()
+		return time.Unix(0, 0)
+	}
+	var hooks int
+	if err := p.update(ctx, func() { hooks++ }); err == nil {
+		t.Error("cancelled update succeeded")
+	}
+	if a, _ := c.ParsedAircraft(); a != nil {
+		t.Errorf("cancelled update applied %+v", a)
+	}
+	if hooks != 0 {
+		t.Errorf("applied called %d times, want 0", hooks)
+	}
+}
+
+func TestReplayEmptyDir(t *testing.T) {
+	if _, err := newReplay(nil, t.TempDir(), 1); err == nil {
+		t.Error("newReplay of an empty directory succeeded")
+	}
+}
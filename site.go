@@ -0,0 +1,44 @@
+package main
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// siteGatherer adds a site label to every metric g gathers, so feeders
+// scraped by one Prometheus can be told apart without target relabeling.
+// A metric that already has a site label keeps it.
+type siteGatherer struct {
+	g    prometheus.Gatherer
+	site string
+}
+
+func (s siteGatherer) Gather() ([]*dto.MetricFamily, error) {
+	mfs, err := s.g.Gather()
+	name := "site"
+	label := &dto.LabelPair{Name: &name, Value: &s.site}
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			// labels are sorted by name
+			i, found := slices.BinarySearchFunc(m.Label, name, func(l *dto.LabelPair, name string) int {
+				return strings.Compare(l.GetName(), name)
+			})
+			if !found {
+				m.Label = slices.Insert(m.Label, i, label)
+			}
+		}
+	}
+	return mfs, err
+}
+
+// withSite wraps g in a siteGatherer, or returns it as it is for an empty
+// site.
+func withSite(g prometheus.Gatherer, site string) prometheus.Gatherer {
+	if site == "" {
+		return g
+	}
+	return siteGatherer{g: g, site: site}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSiteGatherer(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	g := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test_gauge", Help: "Test gauge"}, []string{"period", "type"})
+	g.WithLabelValues("latest", "a").Set(1)
+	own := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test_own_site", Help: "Test gauge with its own site"}, []string{"site"})
+	own.WithLabelValues("other").Set(2)
+	plain := prometheus.NewGauge(prometheus.GaugeOpts{Name: "test_plain", Help: "Test gauge without labels"})
+	reg.MustRegister(g, own, plain)
+
+	expected := `
+# HELP test_gauge Test gauge
+# TYPE test_gauge gauge
+test_gauge{period="latest",site="home",type="a"} 1
+# HELP test_own_site Test gauge with its own site
+# TYPE test_own_site gauge
+test_own_site{site="other"} 2
+# HELP test_plain Test gauge without labels
+# TYPE test_plain gauge
+test_plain{site="home"} 0
+`
+	if err := testutil.GatherAndCompare(withSite(reg, "home"), strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+	if withSite(reg, "") != prometheus.Gatherer(reg) {
+		t.Error("withSite with an empty site wrapped the gatherer")
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Kentaro1043/adsb-exporter/internal/collector"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+// validate runs a single update of the stats and aircraft files, writes the resulting exporter
+// metrics to out in the Prometheus text format and reports problems to
+// errOut. It returns the process exit code: non-zero if either file failed
+// to parse or the metrics could not be gathered.
+func validate(c *collector.Collector, g prometheus.Gatherer, statsPath string, aircraftsPaths []string, out, errOut io.Writer) int {
+	code := 0
+	if err := c.UpdateStatsFromFile(statsPath); err != nil {
+		fmt.Fprintf(errOut, "stats %s: %v\n", statsPath, err)
+		code = 1
+	}
+	if err := c.UpdateAircraftsFromFiles(aircraftsPaths...); err != nil {
+		fmt.Fprintf(errOut, "aircraft %s: %v\n", strings.Join(aircraftsPaths, ","), err)
+		code = 1
+	}
+	mfs, err := c.Gatherer(g).Gather()
+	if err != nil {
+		fmt.Fprintf(errOut, "gather: %v\n", err)
+		return 1
+	}
+	for _, mf := range mfs {
+		if _, err := expfmt.MetricFamilyToText(out, mf); err != nil {
+			fmt.Fprintf(errOut, "write metrics: %v\n", err)
+			return 1
+		}
+	}
+	return code
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/Kentaro1043/adsb-exporter/internal/collector"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestValidate(t *testing.T) {
+	const fixtures = "internal/collector/testdata/"
+	tests := []struct {
+		name         string
+		stats        string
+		aircraft     string
+		wantCode     int
+		wantOut      string
+		wantErrorOut string
+	}{
+		{"good files", "stats.json", "aircraft.json", 0, `adsb_aircraft_alt_baro_feet{category="A3",flight="SWA123",hex="abc123"} 35000`, ""},
+		{"broken aircraft", "stats.json", "invalid.json", 1, `adsb_stats_messages_total{period="latest"} 300`, "aircraft " + fixtures + "invalid.json"},
+		{"missing stats", "missing.json", "aircraft.json", 1, "adsb_aircraft_alt_baro_feet", "stats " + fixtures + "missing.json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			c := collector.New(reg, collector.Options{})
+			var out, errOut bytes.Buffer
+			code := validate(c, reg, fixtures+tt.stats, []string{fixtures + tt.aircraft}, &out, &errOut)
+			if code != tt.wantCode {
+				t.Errorf("exit code = %d, want %d (stderr: %s)", code, tt.wantCode, errOut.String())
+			}
+			if !strings.Contains(out.String(), tt.wantOut) {
+				t.Errorf("stdout lacks %q", tt.wantOut)
+			}
+			switch got := errOut.String(); {
+			case tt.wantErrorOut == "" && got != "":
+				t.Errorf("stderr = %q, want nothing", got)
+			case !strings.Contains(got, tt.wantErrorOut):
+				t.Errorf("stderr = %q, want it to mention %q", got, tt.wantErrorOut)
+			}
+		})
+	}
+}